@@ -2,12 +2,18 @@ package ast
 
 import (
 	"bytes"
+	"dot/token"
 	"fmt"
+	"math/big"
 	"strings"
 )
 
 type Node interface {
 	String() string
+	// Pos returns the position of the first character of the node.
+	Pos() token.Position
+	// End returns the position immediately after the node.
+	End() token.Position
 }
 
 type Expression interface {
@@ -21,6 +27,7 @@ type Statement interface {
 }
 
 type ExpressionStatement struct {
+	Token      token.Token // first token of the expression
 	Expression Expression
 }
 
@@ -30,8 +37,12 @@ func (e *ExpressionStatement) String() string {
 	return e.Expression.String() + ";\n"
 }
 
+func (e *ExpressionStatement) Pos() token.Position { return e.Token.Pos }
+func (e *ExpressionStatement) End() token.Position { return e.Expression.End() }
+
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // the comments in the source, in order
 }
 
 func (p *Program) String() string {
@@ -42,17 +53,84 @@ func (p *Program) String() string {
 	return out
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) == 0 {
+		return token.Position{}
+	}
+	return p.Statements[0].Pos()
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) == 0 {
+		return token.Position{}
+	}
+	return p.Statements[len(p.Statements)-1].End()
+}
+
+// Exports returns the names of the variables the program exports, in the
+// order they are declared.
+func (p *Program) Exports() []string {
+	var names []string
+	for _, s := range p.Statements {
+		if export, ok := s.(*ExportStatement); ok {
+			names = append(names, export.Let.Identifier.Value)
+		}
+	}
+	return names
+}
+
+// Comment is a comment, which runs from // to the end of its line. Comments
+// are not part of the statements of a program, which lists them apart.
+type Comment struct {
+	Token token.Token
+}
+
+// Text returns the comment without its // and surrounding whitespace.
+func (c *Comment) Text() string {
+	return strings.TrimSpace(strings.TrimPrefix(c.Token.Literal, "//"))
+}
+
+func (c *Comment) String() string      { return c.Token.Literal }
+func (c *Comment) Pos() token.Position { return c.Token.Pos }
+func (c *Comment) End() token.Position { return c.Token.End }
+
+// Integer is an integer literal. Big holds its value instead of Value if it
+// does not fit in 64 bits.
 type Integer struct {
-	Value float64
+	Token token.Token
+	Value int64
+	Big   *big.Int
 }
 
 func (i *Integer) expressionNode() {}
 
 func (i *Integer) String() string {
-	return fmt.Sprintf("%g", i.Value)
+	if i.Big != nil {
+		return i.Big.String()
+	}
+	return fmt.Sprintf("%d", i.Value)
+}
+
+func (i *Integer) Pos() token.Position { return i.Token.Pos }
+func (i *Integer) End() token.Position { return i.Token.End }
+
+// Float is a number literal with a fractional part, such as 1.5 or .25.
+type Float struct {
+	Token token.Token
+	Value float64
 }
 
+func (f *Float) expressionNode() {}
+
+func (f *Float) String() string {
+	return f.Token.Literal
+}
+
+func (f *Float) Pos() token.Position { return f.Token.Pos }
+func (f *Float) End() token.Position { return f.Token.End }
+
 type Identifier struct {
+	Token token.Token
 	Value string
 }
 
@@ -62,7 +140,11 @@ func (i *Identifier) String() string {
 	return i.Value
 }
 
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
+
 type String struct {
+	Token token.Token
 	Value string
 }
 
@@ -72,7 +154,35 @@ func (i *String) String() string {
 	return i.Value
 }
 
+func (i *String) Pos() token.Position { return i.Token.Pos }
+func (i *String) End() token.Position { return i.Token.End }
+
+// InterpolatedString is a string with expressions in ${...}. Strings holds
+// the text around the expressions, so it has one more element than Values,
+// and the tokens of its elements are the STRING_HEAD, STRING_MIDDLE and
+// STRING_TAIL tokens of the string.
+type InterpolatedString struct {
+	Strings []*String
+	Values  []Expression
+}
+
+func (is *InterpolatedString) expressionNode() {}
+
+func (is *InterpolatedString) String() string {
+	var out strings.Builder
+	for i, value := range is.Values {
+		out.WriteString(is.Strings[i].Value)
+		out.WriteString("${" + value.String() + "}")
+	}
+	out.WriteString(is.Strings[len(is.Values)].Value)
+	return out.String()
+}
+
+func (is *InterpolatedString) Pos() token.Position { return is.Strings[0].Pos() }
+func (is *InterpolatedString) End() token.Position { return is.Strings[len(is.Strings)-1].End() }
+
 type Boolean struct {
+	Token token.Token
 	Value bool
 }
 
@@ -82,7 +192,11 @@ func (i *Boolean) String() string {
 	return fmt.Sprintf("%t", i.Value)
 }
 
+func (i *Boolean) Pos() token.Position { return i.Token.Pos }
+func (i *Boolean) End() token.Position { return i.Token.End }
+
 type LetStatement struct {
+	Token      token.Token // 'let'
 	Identifier Identifier
 	Value      Expression
 }
@@ -93,7 +207,43 @@ func (l *LetStatement) String() string {
 	return fmt.Sprintf("let %s = %s;\n", l.Identifier.String(), l.Value.String())
 }
 
+func (l *LetStatement) Pos() token.Position { return l.Token.Pos }
+func (l *LetStatement) End() token.Position { return l.Value.End() }
+
+// ImportStatement binds Name to the module run from the file at Path.
+type ImportStatement struct {
+	Token token.Token // 'import'
+	Path  *String
+	Name  *Identifier
+}
+
+func (i *ImportStatement) statementNode() {}
+
+func (i *ImportStatement) String() string {
+	return fmt.Sprintf("import %q as %s;\n", i.Path.Value, i.Name.String())
+}
+
+func (i *ImportStatement) Pos() token.Position { return i.Token.Pos }
+func (i *ImportStatement) End() token.Position { return i.Name.End() }
+
+// ExportStatement is a let statement at the top level of a file whose
+// variable the files importing it can read.
+type ExportStatement struct {
+	Token token.Token // 'export'
+	Let   *LetStatement
+}
+
+func (e *ExportStatement) statementNode() {}
+
+func (e *ExportStatement) String() string {
+	return "export " + e.Let.String()
+}
+
+func (e *ExportStatement) Pos() token.Position { return e.Token.Pos }
+func (e *ExportStatement) End() token.Position { return e.Let.End() }
+
 type ReturnStatement struct {
+	Token       token.Token // 'return'
 	ReturnValue Expression
 }
 
@@ -103,7 +253,11 @@ func (r *ReturnStatement) String() string {
 	return fmt.Sprintf("return %s;\n", r.ReturnValue.String())
 }
 
+func (r *ReturnStatement) Pos() token.Position { return r.Token.Pos }
+func (r *ReturnStatement) End() token.Position { return r.ReturnValue.End() }
+
 type WhileStatement struct {
+	Token     token.Token // 'while'
 	Condition Expression
 	Body      *BlockStatement
 }
@@ -120,7 +274,84 @@ func (w *WhileStatement) String() string {
 	return out.String()
 }
 
+func (w *WhileStatement) Pos() token.Position { return w.Token.Pos }
+func (w *WhileStatement) End() token.Position { return w.Body.End() }
+
+// TryStatement runs Block and, if it fails, Catch with the error bound to
+// Parameter. Finally, if present, runs after both. Either Catch or Finally
+// may be nil, but not both.
+type TryStatement struct {
+	Token     token.Token // 'try'
+	Block     *BlockStatement
+	Parameter *Identifier
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+}
+
+func (t *TryStatement) statementNode() {}
+
+func (t *TryStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("try {\n")
+	out.WriteString(t.Block.String())
+	out.WriteString("}")
+	if t.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(t.Parameter.String())
+		out.WriteString(") {\n")
+		out.WriteString(t.Catch.String())
+		out.WriteString("}")
+	}
+	if t.Finally != nil {
+		out.WriteString(" finally {\n")
+		out.WriteString(t.Finally.String())
+		out.WriteString("}")
+	}
+	return out.String()
+}
+
+func (t *TryStatement) Pos() token.Position { return t.Token.Pos }
+func (t *TryStatement) End() token.Position {
+	if t.Finally != nil {
+		return t.Finally.End()
+	}
+	return t.Catch.End()
+}
+
+type ThrowStatement struct {
+	Token token.Token // 'throw'
+	Value Expression
+}
+
+func (t *ThrowStatement) statementNode() {}
+
+func (t *ThrowStatement) String() string {
+	return fmt.Sprintf("throw %s;\n", t.Value.String())
+}
+
+func (t *ThrowStatement) Pos() token.Position { return t.Token.Pos }
+func (t *ThrowStatement) End() token.Position { return t.Value.End() }
+
+type BreakStatement struct {
+	Token token.Token // 'break'
+}
+
+func (b *BreakStatement) statementNode()      {}
+func (b *BreakStatement) String() string      { return "break;\n" }
+func (b *BreakStatement) Pos() token.Position { return b.Token.Pos }
+func (b *BreakStatement) End() token.Position { return b.Token.End }
+
+type ContinueStatement struct {
+	Token token.Token // 'continue'
+}
+
+func (c *ContinueStatement) statementNode()      {}
+func (c *ContinueStatement) String() string      { return "continue;\n" }
+func (c *ContinueStatement) Pos() token.Position { return c.Token.Pos }
+func (c *ContinueStatement) End() token.Position { return c.Token.End }
+
 type ForStatement struct {
+	Token       token.Token // 'for'
 	Initializer Statement
 	Condition   Expression
 	Incrementer Statement
@@ -142,7 +373,44 @@ func (f *ForStatement) String() string {
 	return out.String()
 }
 
+func (f *ForStatement) Pos() token.Position { return f.Token.Pos }
+func (f *ForStatement) End() token.Position { return f.Body.End() }
+
+// ForInStatement runs Body once for every element of Iterable, binding
+// Value to the element. If Key is present it is bound to the element's
+// index, or to its key when iterating over a hash; without it, a loop over
+// a hash binds Value to the keys.
+type ForInStatement struct {
+	Token    token.Token // 'for'
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (f *ForInStatement) statementNode() {}
+
+func (f *ForInStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for (")
+	if f.Key != nil {
+		out.WriteString(f.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(f.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(f.Iterable.String())
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("}")
+	return out.String()
+}
+
+func (f *ForInStatement) Pos() token.Position { return f.Token.Pos }
+func (f *ForInStatement) End() token.Position { return f.Body.End() }
+
 type PrefixExpression struct {
+	Token    token.Token // the operator
 	Operator string
 	Right    Expression
 }
@@ -153,7 +421,11 @@ func (i PrefixExpression) String() string {
 
 func (i PrefixExpression) expressionNode() {}
 
+func (i PrefixExpression) Pos() token.Position { return i.Token.Pos }
+func (i PrefixExpression) End() token.Position { return i.Right.End() }
+
 type InfixExpression struct {
+	Token    token.Token // the operator
 	Left     Expression
 	Operator string
 	Right    Expression
@@ -165,8 +437,13 @@ func (i InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", i.Left.String(), i.Operator, i.Right.String())
 }
 
+func (i InfixExpression) Pos() token.Position { return i.Left.Pos() }
+func (i InfixExpression) End() token.Position { return i.Right.End() }
+
 type BlockStatement struct {
+	Token      token.Token // '{'
 	Statements []Statement
+	Rbrace     token.Token // '}'
 }
 
 func (b *BlockStatement) statementNode() {}
@@ -179,7 +456,11 @@ func (b *BlockStatement) String() string {
 	return out
 }
 
+func (b *BlockStatement) Pos() token.Position { return b.Token.Pos }
+func (b *BlockStatement) End() token.Position { return b.Rbrace.End }
+
 type IfExpression struct {
+	Token       token.Token // 'if'
 	Condition   Expression
 	Consequence *BlockStatement
 	Alternative *BlockStatement
@@ -202,7 +483,18 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
+
 type Function struct {
+	Token      token.Token // 'fn'
+	Name       string      // the name given by an enclosing let, if any
 	Parameters []*Identifier
 	Body       *BlockStatement
 }
@@ -223,9 +515,14 @@ func (f *Function) String() string {
 	return out.String()
 }
 
+func (f *Function) Pos() token.Position { return f.Token.Pos }
+func (f *Function) End() token.Position { return f.Body.End() }
+
 type CallExpression struct {
+	Token     token.Token // '('
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token // ')'
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -243,8 +540,13 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+func (ce *CallExpression) Pos() token.Position { return ce.Function.Pos() }
+func (ce *CallExpression) End() token.Position { return ce.Rparen.End }
+
 type ArrayLiteral struct {
+	Token    token.Token // '['
 	Elements []Expression
+	Rbracket token.Token // ']'
 }
 
 func (al *ArrayLiteral) expressionNode() {}
@@ -261,9 +563,14 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position { return al.Rbracket.End }
+
 type IndexExpression struct {
-	Left  Expression
-	Index Expression
+	Token    token.Token // '['
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token // ']'
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -272,8 +579,62 @@ func (ie *IndexExpression) String() string {
 	return fmt.Sprintf("(%s[%s])", ie.Left.String(), ie.Index.String())
 }
 
+func (ie *IndexExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *IndexExpression) End() token.Position { return ie.Rbracket.End }
+
+// SliceExpression is Left[Low:High]. Low and High are nil if they were
+// left out.
+type SliceExpression struct {
+	Token    token.Token // '['
+	Left     Expression
+	Low      Expression
+	High     Expression
+	Rbracket token.Token // ']'
+}
+
+func (se *SliceExpression) expressionNode() {}
+
+func (se *SliceExpression) String() string {
+	var low, high string
+	if se.Low != nil {
+		low = se.Low.String()
+	}
+	if se.High != nil {
+		high = se.High.String()
+	}
+	return fmt.Sprintf("(%s[%s:%s])", se.Left.String(), low, high)
+}
+
+func (se *SliceExpression) Pos() token.Position { return se.Left.Pos() }
+func (se *SliceExpression) End() token.Position { return se.Rbracket.End }
+
+// MemberExpression reads the member called Member of Left, that is an
+// export of a module or the value of a string key of a hash.
+type MemberExpression struct {
+	Token  token.Token // '.'
+	Left   Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+
+func (me *MemberExpression) String() string {
+	return fmt.Sprintf("(%s.%s)", me.Left.String(), me.Member.String())
+}
+
+func (me *MemberExpression) Pos() token.Position { return me.Left.Pos() }
+func (me *MemberExpression) End() token.Position { return me.Member.End() }
+
+// HashPair is a key and its value in a hash literal.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
 type HashLiteral struct {
-	Pairs map[Expression]Expression
+	Token  token.Token // '{'
+	Pairs  []HashPair  // in source order
+	Rbrace token.Token // '}'
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -281,11 +642,14 @@ func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for k, v := range hl.Pairs {
-		pairs = append(pairs, k.String()+": "+v.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
 	out.WriteString("}")
 	return out.String()
 }
+
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position { return hl.Rbrace.End }
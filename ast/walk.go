@@ -0,0 +1,111 @@
+package ast
+
+// Inspect traverses the tree rooted at node depth first, calling f for
+// each node in source order. If f returns false for a node, Inspect does
+// not visit its children.
+func Inspect(node Node, f func(Node) bool) {
+	if !f(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *Program:
+		inspectStatements(n.Statements, f)
+	case *BlockStatement:
+		inspectStatements(n.Statements, f)
+	case *ExpressionStatement:
+		Inspect(n.Expression, f)
+	case *LetStatement:
+		Inspect(&n.Identifier, f)
+		Inspect(n.Value, f)
+	case *ImportStatement:
+		Inspect(n.Path, f)
+		Inspect(n.Name, f)
+	case *ExportStatement:
+		Inspect(n.Let, f)
+	case *ReturnStatement:
+		Inspect(n.ReturnValue, f)
+	case *ThrowStatement:
+		Inspect(n.Value, f)
+	case *WhileStatement:
+		Inspect(n.Condition, f)
+		Inspect(n.Body, f)
+	case *ForStatement:
+		Inspect(n.Initializer, f)
+		Inspect(n.Condition, f)
+		Inspect(n.Incrementer, f)
+		Inspect(n.Body, f)
+	case *ForInStatement:
+		if n.Key != nil {
+			Inspect(n.Key, f)
+		}
+		Inspect(n.Value, f)
+		Inspect(n.Iterable, f)
+		Inspect(n.Body, f)
+	case *TryStatement:
+		Inspect(n.Block, f)
+		if n.Catch != nil {
+			Inspect(n.Parameter, f)
+			Inspect(n.Catch, f)
+		}
+		if n.Finally != nil {
+			Inspect(n.Finally, f)
+		}
+	case *InterpolatedString:
+		for i, s := range n.Strings {
+			Inspect(s, f)
+			if i < len(n.Values) {
+				Inspect(n.Values[i], f)
+			}
+		}
+	case *PrefixExpression:
+		Inspect(n.Right, f)
+	case *InfixExpression:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *IfExpression:
+		Inspect(n.Condition, f)
+		Inspect(n.Consequence, f)
+		if n.Alternative != nil {
+			Inspect(n.Alternative, f)
+		}
+	case *Function:
+		for _, parameter := range n.Parameters {
+			Inspect(parameter, f)
+		}
+		Inspect(n.Body, f)
+	case *CallExpression:
+		Inspect(n.Function, f)
+		for _, argument := range n.Arguments {
+			Inspect(argument, f)
+		}
+	case *IndexExpression:
+		Inspect(n.Left, f)
+		Inspect(n.Index, f)
+	case *SliceExpression:
+		Inspect(n.Left, f)
+		if n.Low != nil {
+			Inspect(n.Low, f)
+		}
+		if n.High != nil {
+			Inspect(n.High, f)
+		}
+	case *MemberExpression:
+		Inspect(n.Left, f)
+		Inspect(n.Member, f)
+	case *ArrayLiteral:
+		for _, element := range n.Elements {
+			Inspect(element, f)
+		}
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			Inspect(pair.Key, f)
+			Inspect(pair.Value, f)
+		}
+	}
+}
+
+func inspectStatements(statements []Statement, f func(Node) bool) {
+	for _, s := range statements {
+		Inspect(s, f)
+	}
+}
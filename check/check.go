@@ -0,0 +1,217 @@
+// Package check finds likely mistakes in Dot programs without running
+// them: identifiers that are not defined, calls with too few arguments,
+// variables that are never used and parameters hidden by other variables.
+//
+// It resolves every identifier to the variable it names the way the
+// interpreter does. Functions, for loops and catch blocks have scopes of
+// their own, while the blocks of if, while and try share the scope around
+// them, and assigning to a name that is not defined defines it. A function
+// can use variables defined after it, since it only looks them up when it
+// is called.
+package check
+
+import (
+	"dot/ast"
+	"dot/eval"
+	"dot/lexer"
+	"dot/parser"
+	"dot/token"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Severity is how serious a diagnostic is.
+type Severity int
+
+const (
+	Off Severity = iota // the rule is not checked
+	Warning
+	Error
+)
+
+var severities = []string{Off: "off", Warning: "warning", Error: "error"}
+
+func (s Severity) String() string {
+	return severities[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseSeverity returns the severity called name.
+func ParseSeverity(name string) (Severity, error) {
+	for s, n := range severities {
+		if n == name {
+			return Severity(s), nil
+		}
+	}
+	return Off, fmt.Errorf("unknown severity %q, want error, warning or off", name)
+}
+
+// Rule is a kind of mistake the checker looks for.
+type Rule struct {
+	Name     string
+	Severity Severity // the severity of its diagnostics unless configured
+	Doc      string
+}
+
+// The names of the rules.
+const (
+	Syntax         = "syntax" // the syntax errors of a file, always errors
+	Undefined      = "undefined"
+	Arguments      = "arguments"
+	ExtraArguments = "extra-arguments"
+	Unused         = "unused"
+	Shadow         = "shadow"
+)
+
+// Rules lists the rules the checker applies.
+var Rules = []Rule{
+	{Undefined, Error, "an identifier that names no variable, builtin or global where it is used"},
+	{Arguments, Error, "a call giving a function fewer arguments than it has parameters"},
+	{ExtraArguments, Warning, "a call giving a function more arguments than it has parameters, which are ignored"},
+	{Unused, Warning, "a variable declared with let in a function or loop, or a module imported, that is never used"},
+	{Shadow, Warning, "a variable or parameter with the name of a parameter of its function or an enclosing one"},
+}
+
+// Diagnostic is a mistake found in a program, between Pos and End.
+type Diagnostic struct {
+	Pos, End token.Position
+	Rule     string
+	Severity Severity
+	Message  string
+}
+
+// String returns the diagnostic as "file:line:column: severity: message
+// (rule)".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", d.Pos, d.Severity, d.Message, d.Rule)
+}
+
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File      string   `json:"file"`
+		Line      int      `json:"line"`
+		Column    int      `json:"column"`
+		EndLine   int      `json:"endLine"`
+		EndColumn int      `json:"endColumn"`
+		Severity  Severity `json:"severity"`
+		Rule      string   `json:"rule"`
+		Message   string   `json:"message"`
+	}{d.Pos.File, d.Pos.Line, d.Pos.Column, d.End.Line, d.End.Column, d.Severity, d.Rule, d.Message})
+}
+
+// Option configures a check.
+type Option func(*checker)
+
+// WithSeverity reports the diagnostics of the rule called rule with
+// severity s, or not at all if s is Off.
+func WithSeverity(rule string, s Severity) Option {
+	return func(c *checker) { c.severity[rule] = s }
+}
+
+// WithGlobals defines variables that the host sets before running the
+// program, such as args for programs run by the dot command.
+func WithGlobals(names ...string) Option {
+	return func(c *checker) {
+		for _, name := range names {
+			c.globals[name] = true
+		}
+	}
+}
+
+// WithBuiltins replaces the standard builtins by those called names, for
+// programs run by a host that changes them.
+func WithBuiltins(names ...string) Option {
+	return func(c *checker) {
+		c.builtins = make(map[string]bool)
+		for _, name := range names {
+			c.builtins[name] = true
+		}
+	}
+}
+
+// Source parses src, the contents of the file called filename, and checks
+// it. If src does not parse it returns its syntax errors only, since the
+// statements the parser skipped would lead to more diagnostics that are
+// not real.
+func Source(filename, src string, opts ...Option) []Diagnostic {
+	p := parser.NewParser(lexer.NewFileLexer(filename, src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		diagnostics := make([]Diagnostic, len(errs))
+		for i, err := range errs {
+			diagnostics[i] = Diagnostic{Pos: err.Pos, End: err.Pos, Rule: Syntax, Severity: Error, Message: err.Msg}
+		}
+		return diagnostics
+	}
+	return Program(program, opts...)
+}
+
+// Program checks program and returns its diagnostics in source order.
+func Program(program *ast.Program, opts ...Option) []Diagnostic {
+	c := newChecker(opts)
+	c.program(program)
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		return c.diagnostics[i].Pos.Offset < c.diagnostics[j].Pos.Offset
+	})
+	return c.diagnostics
+}
+
+// Definitions resolves the identifiers of program and returns, for each
+// one that names a variable, the identifier the variable is declared by.
+// A declaration maps to itself, or to the first declaration of the
+// variable if it is declared again. Identifiers naming builtins, globals
+// or nothing are left out.
+func Definitions(program *ast.Program) map[*ast.Identifier]*ast.Identifier {
+	c := newChecker(nil)
+	c.program(program)
+	return c.definitions
+}
+
+func newChecker(opts []Option) *checker {
+	c := &checker{
+		severity:    make(map[string]Severity),
+		globals:     make(map[string]bool),
+		definitions: make(map[*ast.Identifier]*ast.Identifier),
+	}
+	for _, rule := range Rules {
+		c.severity[rule.Name] = rule.Severity
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.builtins == nil {
+		c.builtins = make(map[string]bool)
+		for name := range eval.Builtins() {
+			c.builtins[name] = true
+		}
+	}
+	return c
+}
+
+type checker struct {
+	severity    map[string]Severity
+	globals     map[string]bool
+	builtins    map[string]bool
+	scope       *scope
+	calls       []call // the calls to check once all assignments are known
+	diagnostics []Diagnostic
+	// definitions maps the identifiers resolved so far to the declarations
+	// of their variables
+	definitions map[*ast.Identifier]*ast.Identifier
+}
+
+func (c *checker) report(rule string, node ast.Node, format string, args ...any) {
+	if s := c.severity[rule]; s != Off {
+		c.diagnostics = append(c.diagnostics, Diagnostic{
+			Pos:      node.Pos(),
+			End:      node.End(),
+			Rule:     rule,
+			Severity: s,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+}
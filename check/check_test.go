@@ -0,0 +1,101 @@
+package check
+
+import (
+	"dot/lexer"
+	"dot/parser"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1\nprint(x + y)", []string{"2:11: error: identifier not found: y (undefined)"}},
+		{"count += 1", []string{"1:1: error: identifier not found: count (undefined)"}},
+		// functions look variables up when they are called
+		{"let f = fn() { g() }\nlet g = fn() { total }\ntotal = 1", nil},
+		{"let f = fn() { fresh = 1; fresh }\nfresh", []string{"2:1: error: identifier not found: fresh (undefined)"}},
+		{"let f = fn() { if (true) { let y = 1 }; y }", nil},
+		{"for (let i = 0; i < 3; i += 1) { let sq = i * i; print(sq) }\ni", []string{"2:1: error: identifier not found: i (undefined)"}},
+		{"for (k, v in {}) { print(k) }\nv", []string{"2:1: error: identifier not found: v (undefined)"}},
+		{"try { throw 1 } catch (e) {}\ne", []string{"2:1: error: identifier not found: e (undefined)"}},
+		{"let add = fn(a, b) { a + b }\nadd(1)\nadd(1, 2)\nadd(1, 2, 3)", []string{
+			"2:1: error: not enough arguments in call to add: want 2, got 1 (arguments)",
+			"4:1: warning: too many arguments in call to add: want 2, got 3, the rest are ignored (extra-arguments)",
+		}},
+		{"fn(x) { x }()", []string{"1:1: error: not enough arguments in call to function literal: want 1, got 0 (arguments)"}},
+		// the variable may hold another function when it is called
+		{"let f = fn(a) { a }\nf = fn() { 0 }\nf()", nil},
+		{"let f = fn() {\n  let a = 1\n  let b = 2\n  b\n}", []string{"2:7: warning: a declared and not used (unused)"}},
+		{"import \"lib.dot\" as lib\nlet top = 1", []string{"1:21: warning: lib imported and not used (unused)"}},
+		{"let f = fn(x) { let x = 1; x }", []string{"1:21: warning: x is already a parameter of this function (shadow)"}},
+		{"let f = fn(x) { fn(x) { x } }", []string{"1:20: warning: x shadows the parameter declared at line 1, column 12 (shadow)"}},
+		{"let f = fn(x) { for (x in [1]) { print(x) } }", []string{"1:22: warning: x shadows the parameter declared at line 1, column 12 (shadow)"}},
+		{"print(len(args), {a: 1})", []string{"1:19: error: identifier not found: a (undefined)"}},
+		{"let = 1", []string{"1:5: error: expected identifier after 'let' (syntax)"}},
+	}
+
+	for i, tt := range tests {
+		var got []string
+		for _, d := range Source("", tt.input, WithGlobals("args")) {
+			got = append(got, d.String())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("tests[%d] - wrong diagnostics for %q.\nexpected=%q\ngot=%q", i, tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	input := "let f = fn(a) { let b = 1; len(a) + size(a) }\nf()"
+	diagnostics := Source("main.dot", input,
+		WithSeverity(Unused, Off),
+		WithSeverity(Arguments, Warning),
+		WithBuiltins("size"),
+	)
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	expected := []string{
+		"main.dot:1:28: error: identifier not found: len (undefined)",
+		"main.dot:2:1: warning: not enough arguments in call to f: want 1, got 0 (arguments)",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong diagnostics.\nexpected=%q\ngot=%q", expected, got)
+	}
+
+	out, err := json.Marshal(diagnostics[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"file":"main.dot","line":1,"column":28,"endLine":1,"endColumn":31,"severity":"error","rule":"undefined","message":"identifier not found: len"}`; string(out) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=%s", expected, out)
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	input := "let f = fn(x) { x + y }\nlet y = 1\nf(y)\ny = 2\nprint(len(z))"
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	got := make(map[string]string)
+	for use, decl := range Definitions(program) {
+		got[use.Pos().String()] = decl.Pos().String()
+	}
+	expected := map[string]string{
+		"1:5":  "1:5",  // f declared
+		"1:12": "1:12", // the parameter x
+		"1:17": "1:12",
+		"1:21": "2:5", // y is looked up when f is called
+		"2:5":  "2:5",
+		"3:1":  "1:5",
+		"3:3":  "2:5",
+		"4:1":  "2:5",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong definitions.\nexpected=%v\ngot=%v", expected, got)
+	}
+}
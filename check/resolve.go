@@ -0,0 +1,278 @@
+package check
+
+import (
+	"dot/ast"
+	"dot/parser"
+)
+
+// kind is how a variable is declared.
+type kind int
+
+const (
+	letVariable kind = iota
+	parameter
+	imported
+	bound    // a variable of a for-in loop or the error of a catch block
+	assigned // defined by assigning to a name that was not defined
+)
+
+type binding struct {
+	name  string
+	kind  kind
+	ident *ast.Identifier // where the variable is declared
+	reads int
+	// assignments counts the assignments after the declaration
+	assignments int
+	// function is the function literal the variable is declared with, if
+	// it is declared once
+	function *ast.Function
+}
+
+// scope holds the variables of a program, a function, a for loop or a
+// catch block.
+type scope struct {
+	parent *scope
+	names  map[string]*binding
+	order  []*binding // the variables in the order they are declared
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.parent {
+		if b, ok := s.names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// call is a call of a known function, checked once the assignments of the
+// whole program are known.
+type call struct {
+	node     *ast.CallExpression
+	name     string
+	binding  *binding // the variable holding the function, nil for a literal
+	function *ast.Function
+}
+
+func (c *checker) program(program *ast.Program) {
+	c.open()
+	c.declare(program)
+	c.walk(program)
+	c.close()
+	c.checkCalls()
+}
+
+func (c *checker) open() {
+	c.scope = &scope{parent: c.scope, names: make(map[string]*binding)}
+}
+
+// close leaves the current scope, reporting the variables in it that were
+// never used. Variables declared with let at the top level are left out,
+// since the host or the files importing the program may use them.
+func (c *checker) close() {
+	s := c.scope
+	for _, b := range s.order {
+		switch {
+		case b.reads > 0:
+		case b.kind == imported:
+			c.report(Unused, b.ident, "%s imported and not used", b.name)
+		case b.kind == letVariable && s.parent != nil:
+			c.report(Unused, b.ident, "%s declared and not used", b.name)
+		}
+	}
+	c.scope = s.parent
+}
+
+// declare defines the variables declared by node in the current scope,
+// leaving out those of the scopes inside it. It runs before the scope is
+// walked, as a variable can be used in a function before it is declared.
+func (c *checker) declare(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Function, *ast.ForStatement:
+			return false
+		case *ast.ForInStatement:
+			c.declare(n.Iterable)
+			return false
+		case *ast.TryStatement:
+			c.declare(n.Block)
+			if n.Finally != nil {
+				c.declare(n.Finally)
+			}
+			return false
+		case *ast.LetStatement:
+			b := c.define(letVariable, &n.Identifier)
+			if b.ident != &n.Identifier {
+				// declared again, so its value is not known
+				b.function = nil
+				b.assignments++
+			} else if function, ok := n.Value.(*ast.Function); ok {
+				b.function = function
+			}
+		case *ast.ImportStatement:
+			c.define(imported, n.Name)
+		case *ast.InfixExpression:
+			// assigning to a name defined nowhere defines it here
+			ident, ok := n.Left.(*ast.Identifier)
+			if ok && n.Operator == "=" && c.scope.lookup(ident.Value) == nil {
+				c.define(assigned, ident)
+			}
+		}
+		return true
+	})
+}
+
+// define declares the variable ident in the current scope, or returns the
+// variable if the scope already has one of that name.
+func (c *checker) define(k kind, ident *ast.Identifier) *binding {
+	if b, ok := c.scope.names[ident.Value]; ok {
+		c.definitions[ident] = b.ident
+		if b.kind == parameter && (k == letVariable || k == parameter) {
+			c.report(Shadow, ident, "%s is already a parameter of this function", ident.Value)
+		}
+		return b
+	}
+	if k == letVariable || k == parameter || k == bound {
+		c.checkShadow(ident)
+	}
+	b := &binding{name: ident.Value, kind: k, ident: ident}
+	c.definitions[ident] = ident
+	c.scope.names[ident.Value] = b
+	c.scope.order = append(c.scope.order, b)
+	return b
+}
+
+// checkShadow reports the variable ident if it hides a parameter of an
+// enclosing function.
+func (c *checker) checkShadow(ident *ast.Identifier) {
+	for s := c.scope.parent; s != nil; s = s.parent {
+		if b, ok := s.names[ident.Value]; ok {
+			if b.kind == parameter {
+				pos := b.ident.Pos()
+				c.report(Shadow, ident, "%s shadows the parameter declared at line %d, column %d", ident.Value, pos.Line, pos.Column)
+			}
+			return
+		}
+	}
+}
+
+// walk resolves the identifiers used in node.
+func (c *checker) walk(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			c.use(n)
+		case *ast.LetStatement:
+			c.walk(n.Value)
+			return false
+		case *ast.ImportStatement:
+			return false
+		case *ast.MemberExpression:
+			c.walk(n.Left)
+			return false
+		case *ast.InfixExpression:
+			ident, ok := n.Left.(*ast.Identifier)
+			if !ok || parser.Precedence(n.Token.Type) != parser.ASSIGNMENT {
+				return true
+			}
+			if n.Operator != "=" {
+				c.use(ident)
+			}
+			if b := c.scope.lookup(ident.Value); b != nil {
+				b.assignments++
+				c.definitions[ident] = b.ident
+			}
+			c.walk(n.Right)
+			return false
+		case *ast.CallExpression:
+			c.call(n)
+		case *ast.Function:
+			c.open()
+			for _, param := range n.Parameters {
+				c.define(parameter, param)
+			}
+			c.declare(n.Body)
+			c.walk(n.Body)
+			c.close()
+			return false
+		case *ast.ForStatement:
+			c.open()
+			for _, part := range []ast.Node{n.Initializer, n.Condition, n.Incrementer, n.Body} {
+				c.declare(part)
+			}
+			for _, part := range []ast.Node{n.Initializer, n.Condition, n.Incrementer, n.Body} {
+				c.walk(part)
+			}
+			c.close()
+			return false
+		case *ast.ForInStatement:
+			c.walk(n.Iterable)
+			c.open()
+			if n.Key != nil {
+				c.define(bound, n.Key)
+			}
+			c.define(bound, n.Value)
+			c.declare(n.Body)
+			c.walk(n.Body)
+			c.close()
+			return false
+		case *ast.TryStatement:
+			c.walk(n.Block)
+			if n.Catch != nil {
+				c.open()
+				c.define(bound, n.Parameter)
+				c.declare(n.Catch)
+				c.walk(n.Catch)
+				c.close()
+			}
+			if n.Finally != nil {
+				c.walk(n.Finally)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// use resolves ident where it is read.
+func (c *checker) use(ident *ast.Identifier) {
+	if b := c.scope.lookup(ident.Value); b != nil {
+		b.reads++
+		c.definitions[ident] = b.ident
+		return
+	}
+	if !c.globals[ident.Value] && !c.builtins[ident.Value] {
+		c.report(Undefined, ident, "identifier not found: %s", ident.Value)
+	}
+}
+
+// call keeps n to be checked if it calls a function literal or a variable
+// declared with one.
+func (c *checker) call(n *ast.CallExpression) {
+	switch function := n.Function.(type) {
+	case *ast.Identifier:
+		if b := c.scope.lookup(function.Value); b != nil && b.function != nil {
+			c.calls = append(c.calls, call{node: n, name: function.Value, binding: b, function: b.function})
+		}
+	case *ast.Function:
+		c.calls = append(c.calls, call{node: n, name: "function literal", function: function})
+	}
+}
+
+// checkCalls reports the calls giving their function the wrong number of
+// arguments, leaving out the calls of variables that are assigned another
+// value.
+func (c *checker) checkCalls() {
+	for _, call := range c.calls {
+		if call.binding != nil && call.binding.assignments > 0 {
+			continue
+		}
+		want, got := len(call.function.Parameters), len(call.node.Arguments)
+		switch {
+		case got < want:
+			c.report(Arguments, call.node, "not enough arguments in call to %s: want %d, got %d", call.name, want, got)
+		case got > want:
+			c.report(ExtraArguments, call.node, "too many arguments in call to %s: want %d, got %d, the rest are ignored", call.name, want, got)
+		}
+	}
+}
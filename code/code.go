@@ -0,0 +1,343 @@
+// Package code defines the bytecode instruction set run by the virtual
+// machine.
+package code
+
+import (
+	"bytes"
+	"dot/token"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant at the given index of the pool.
+	OpConstant Opcode = iota
+	OpPop
+	OpNull
+	OpTrue
+	OpFalse
+	// OpEmpty pushes the empty string, the value of loops.
+	OpEmpty
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+	OpLessEqual
+	OpGreaterEqual
+	OpAnd
+	OpOr
+
+	OpMinus
+	OpPlus
+	OpBang
+
+	OpJump
+	OpJumpNotTruthy
+
+	// OpGetLocal, OpGetCell, OpGetFree and OpGetGlobal push the variable
+	// in the given stack slot of the call, cell of the call, cell of the
+	// closure or slot of the global environment, the places a Location
+	// names. A global variable that is not defined refers to the builtin
+	// of the same name, if there is one.
+	OpGetLocal
+	OpGetCell
+	OpGetFree
+	OpGetGlobal
+	// OpSetLocal, OpSetCell, OpSetFree and OpSetGlobal store the top of
+	// the stack in a variable, leaving it on the stack.
+	OpSetLocal
+	OpSetCell
+	OpSetFree
+	OpSetGlobal
+	// OpClearLocal and OpNewCell give a variable of a scope being entered
+	// no value, so that each time a scope is entered its variables start
+	// out undefined and closures capture new ones.
+	OpClearLocal
+	OpNewCell
+	// OpGetName pushes the first defined variable along the path of the
+	// given Chain of the function, for a name that may be defined in any
+	// of several scopes.
+	OpGetName
+	// OpAssignName stores the top of the stack in the first defined
+	// variable along the path of a Chain, leaving it on the stack.
+	OpAssignName
+	// OpSetName stores like OpAssignName, or in the first variable of the
+	// path if none is defined.
+	OpSetName
+
+	OpArray
+	OpHash
+	OpIndex
+	// OpSetIndex pops a value, an index and a container, stores the value
+	// in the container and pushes it back.
+	OpSetIndex
+	// OpSlice pops the high and low bounds of a slice, either of which is
+	// null if it was left out, and the value to slice, and pushes the
+	// slice.
+	OpSlice
+	// OpInterpolate pops the given number of values and pushes the string
+	// joining their text.
+	OpInterpolate
+
+	OpClosure
+	OpCall
+	OpReturnValue
+
+	// OpTry installs an error handler at the given offset, used until the
+	// matching OpEndTry. When an error is raised the stack and frames are
+	// restored to what they were at OpTry, the error is pushed
+	// and execution continues at the handler.
+	OpTry
+	OpEndTry
+	// OpCatch replaces the error on top of the stack with the value a
+	// catch block binds for it.
+	OpCatch
+	// OpThrow pops a value and raises it as an error.
+	OpThrow
+
+	// OpIter replaces the value on top of the stack with an iterator over
+	// it, for a for-in loop.
+	OpIter
+	// OpIterNext advances the iterator on top of the stack, leaving it
+	// there. Once it is exhausted it jumps to the first operand; otherwise
+	// it pushes the key and the value of the next element, or just the
+	// value a single loop variable binds if the second operand is 1.
+	OpIterNext
+	// OpImport pushes the module whose file has the absolute path named by
+	// the first operand. The first time the module is imported it runs the
+	// function or raises the error given by the second operand, the result
+	// of compiling the file, which pushes the module when it returns.
+	OpImport
+)
+
+// Definition names an opcode and gives the width of each of its operands
+// in bytes. Indexes into the constant pool, jump targets and counts take
+// four bytes, so that no program small enough to compile overflows them.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{4}},
+	OpPop:      {"OpPop", []int{}},
+	OpNull:     {"OpNull", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpEmpty:    {"OpEmpty", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpAnd:          {"OpAnd", []int{}},
+	OpOr:           {"OpOr", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpPlus:  {"OpPlus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJump:          {"OpJump", []int{4}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{4}},
+
+	OpGetLocal:   {"OpGetLocal", []int{4}},
+	OpGetCell:    {"OpGetCell", []int{4}},
+	OpGetFree:    {"OpGetFree", []int{4}},
+	OpGetGlobal:  {"OpGetGlobal", []int{4}},
+	OpSetLocal:   {"OpSetLocal", []int{4}},
+	OpSetCell:    {"OpSetCell", []int{4}},
+	OpSetFree:    {"OpSetFree", []int{4}},
+	OpSetGlobal:  {"OpSetGlobal", []int{4}},
+	OpClearLocal: {"OpClearLocal", []int{4}},
+	OpNewCell:    {"OpNewCell", []int{4}},
+	OpGetName:    {"OpGetName", []int{4}},
+	OpAssignName: {"OpAssignName", []int{4}},
+	OpSetName:    {"OpSetName", []int{4}},
+
+	OpArray:    {"OpArray", []int{4}},
+	OpHash:     {"OpHash", []int{4}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+	OpSlice:    {"OpSlice", []int{}},
+
+	OpInterpolate: {"OpInterpolate", []int{4}},
+
+	OpClosure:     {"OpClosure", []int{4}},
+	OpCall:        {"OpCall", []int{4}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	OpTry:    {"OpTry", []int{4}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpCatch:  {"OpCatch", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{4, 1}},
+
+	OpImport: {"OpImport", []int{4, 4}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes op and its operands as a single instruction.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def and
+// returns them with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// String disassembles the instructions, one per line.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// Scope is the kind of place a variable is kept in.
+type Scope byte
+
+const (
+	// LocalScope is a stack slot of the call, numbered from the first
+	// parameter.
+	LocalScope Scope = iota
+	// CellScope is a cell of the call, which closures created in it share.
+	CellScope
+	// FreeScope is a cell the closure being run captured from the call
+	// that created it.
+	FreeScope
+	// GlobalScope is a numbered slot of the global environment.
+	GlobalScope
+)
+
+// Location is where a variable is kept: the place of number Index among
+// those of its Scope.
+type Location struct {
+	Scope Scope
+	Index int
+}
+
+// Chain is a name that may be defined in any of the places in Path, which
+// lists the scopes that define it or may define it, innermost first, as
+// when a function refers to a variable that a statement of it defines only
+// sometimes. The innermost defined variable is the one meant.
+type Chain struct {
+	Name string
+	Path []Location
+}
+
+// SourcePos records that the instructions starting at Offset were compiled
+// from the node spanning Pos to End.
+type SourcePos struct {
+	Offset int
+	Pos    token.Position
+	End    token.Position
+}
+
+// SourceMap maps instruction offsets back to source positions. Entries are
+// sorted by offset.
+type SourceMap []SourcePos
+
+// Lookup returns the source span of the instruction at offset.
+func (m SourceMap) Lookup(offset int) (pos, end token.Position) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}, token.Position{}
+	}
+	return m[i-1].Pos, m[i-1].End
+}
@@ -0,0 +1,84 @@
+package code
+
+import (
+	"dot/token"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 0, 0, 255, 254}},
+		{OpConstant, []int{70000}, []byte{byte(OpConstant), 0, 1, 17, 112}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpCall, []int{300}, []byte{byte(OpCall), 0, 0, 1, 44}},
+		{OpIterNext, []int{65534, 2}, []byte{byte(OpIterNext), 0, 0, 255, 254, 2}},
+		{OpImport, []int{1, 258}, []byte{byte(OpImport), 0, 0, 0, 1, 0, 0, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Fatalf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetName, 2),
+		Make(OpConstant, 65535),
+		Make(OpCall, 3),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetName 2
+0006 OpConstant 65535
+0011 OpCall 3
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestSourceMapLookup(t *testing.T) {
+	m := SourceMap{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 3, Pos: token.Position{Line: 2, Column: 5}},
+		{Offset: 7, Pos: token.Position{Line: 4, Column: 1}},
+	}
+
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "1:1"},
+		{2, "1:1"},
+		{3, "2:5"},
+		{6, "2:5"},
+		{12, "4:1"},
+	}
+
+	for _, tt := range tests {
+		if pos, _ := m.Lookup(tt.offset); pos.String() != tt.expected {
+			t.Errorf("wrong position for offset %d. want=%s, got=%s", tt.offset, tt.expected, pos)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+// Package compiler lowers a parsed Dot program to bytecode for the virtual
+// machine in package vm.
+package compiler
+
+import (
+	"dot/ast"
+	"dot/code"
+	"dot/object"
+	"dot/token"
+	"fmt"
+)
+
+// Bytecode is the result of compiling a program: its top-level instructions,
+// the constant pool shared by every function in it and the source map of the
+// top-level instructions. Locals, Cells and Chains describe the variables
+// of the top-level code like the fields of object.CompiledFunction, and
+// Globals names the global variables by number.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	Positions    code.SourceMap
+	Locals       int
+	Cells        int
+	Chains       []code.Chain
+	Globals      []string
+}
+
+// CompilationScope holds the instructions of the function being compiled.
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    code.SourceMap
+	fn           *function
+	chains       []code.Chain
+	// depth is the number of values on the stack after the instructions
+	// emitted so far, relative to the start of the function
+	depth int
+	// exits are the try statements entered at the code being compiled and
+	// loops the loops it is in, innermost last
+	exits []exit
+	loops []loop
+}
+
+type Compiler struct {
+	constants []object.Object
+	// globals numbers the global variables of the program or module being
+	// compiled; refs and scopeVars are what resolve found out about its
+	// identifiers and the scopes that nodes create
+	globals   *globalTable
+	refs      map[*ast.Identifier][]*binding
+	scopeVars map[ast.Node]*scope
+	// modules maps the absolute path of every module file compiled so far
+	// to the index of its function in the constant pool
+	modules map[string]int
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos and end span the node being compiled, recorded in the source
+	// map for every instruction emitted
+	pos token.Position
+	end token.Position
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+	"&&": code.OpAnd,
+	"||": code.OpOr,
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+}
+
+var prefixOpcodes = map[string]code.Opcode{
+	"!": code.OpBang,
+	"-": code.OpMinus,
+	"+": code.OpPlus,
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants: []object.Object{},
+		globals:   newGlobalTable(),
+		refs:      make(map[*ast.Identifier][]*binding),
+		scopeVars: make(map[ast.Node]*scope),
+		modules:   make(map[string]int),
+		scopes:    []CompilationScope{{}},
+	}
+}
+
+// NewWithState returns a compiler that adds to the constant pool of prev, so
+// that functions compiled by either one can run on the same virtual
+// machine, and numbers global variables the way prev does, so that both
+// can run in the same environment, as when a REPL compiles one line at a
+// time.
+func NewWithState(prev *Compiler) *Compiler {
+	c := New()
+	c.constants = prev.constants
+	c.globals = prev.globals
+	c.modules = prev.modules
+	return c
+}
+
+// Compile compiles node, which is a program or a part of the program being
+// compiled.
+func (c *Compiler) Compile(node ast.Node) error {
+	prevPos, prevEnd := c.pos, c.end
+	c.pos, c.end = node.Pos(), node.End()
+	defer func() { c.pos, c.end = prevPos, prevEnd }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		c.scopes[c.scopeIndex].fn = c.resolve(node)
+		if err := c.compileStatements(node.Statements); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.ExpressionStatement:
+		return c.Compile(node.Expression)
+	case *ast.BlockStatement:
+		return c.compileStatements(node.Statements)
+	case *ast.LetStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.defineVariable(&node.Identifier)
+	case *ast.ImportStatement:
+		return c.compileImportStatement(node)
+	case *ast.ExportStatement:
+		return c.Compile(node.Let)
+	case *ast.ReturnStatement:
+		start := c.depth()
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveExits(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+		c.setDepth(start + 1)
+	case *ast.TryStatement:
+		return c.compileTryStatement(node)
+	case *ast.ThrowStatement:
+		start := c.depth()
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+		c.setDepth(start + 1)
+	case *ast.BreakStatement:
+		return c.compileLoopJump(node, true)
+	case *ast.ContinueStatement:
+		return c.compileLoopJump(node, false)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+	case *ast.Integer:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value, Big: node.Big}))
+	case *ast.Float:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.String:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.Identifier:
+		c.loadVariable(node)
+	case *ast.PrefixExpression:
+		op, ok := prefixOpcodes[node.Operator]
+		if !ok {
+			return compileError(node, "unknown operator %s", node.Operator)
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		elseJump := c.emit(code.OpJumpNotTruthy, 9999)
+		start := c.depth()
+		if err := c.Compile(node.Consequence); err != nil {
+			return err
+		}
+		endJump := c.emit(code.OpJump, 9999)
+		c.changeOperand(elseJump, len(c.currentInstructions()))
+		c.setDepth(start)
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.Compile(node.Alternative); err != nil {
+			return err
+		}
+		c.changeOperand(endJump, len(c.currentInstructions()))
+	case *ast.Function:
+		return c.compileFunction(node)
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+			} else if err := c.Compile(bound); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+	case *ast.InterpolatedString:
+		return c.compileInterpolatedString(node)
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Member.Value}))
+		c.emit(code.OpIndex)
+	default:
+		return compileError(node, "cannot compile %T", node)
+	}
+	return nil
+}
+
+// compileFunction compiles a function literal, which creates a closure
+// capturing the variables of enclosing calls the function refers to.
+func (c *Compiler) compileFunction(node *ast.Function) error {
+	s := c.scopeVars[node]
+	c.enterScope()
+	c.scopes[c.scopeIndex].fn = s.fn
+	// the arguments are in the stack slots of the parameters; those
+	// captured are moved to cells
+	c.initScope(s, node.Parameters...)
+	for _, b := range s.fn.params {
+		if b.cell >= 0 {
+			c.emit(code.OpGetLocal, b.index)
+			c.emit(code.OpSetCell, b.cell)
+			c.emit(code.OpPop)
+		}
+	}
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	scope := c.leaveScope()
+	params := make([]string, len(node.Parameters))
+	for i, p := range node.Parameters {
+		params[i] = p.Value
+	}
+	captures := make([]code.Location, len(s.fn.free))
+	for i, b := range s.fn.free {
+		captures[i] = c.location(b)
+	}
+	fn := &object.CompiledFunction{
+		Name:         node.Name,
+		Instructions: scope.instructions,
+		Parameters:   params,
+		Positions:    scope.positions,
+		Locals:       s.fn.locals,
+		Cells:        s.fn.cells,
+		Captures:     captures,
+		Chains:       scope.chains,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+// compileStatements compiles a list of statements so that exactly the value
+// of the last one is left on the stack, or null if there are none.
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	if len(statements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+	for i, s := range statements {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+		if i < len(statements)-1 {
+			c.emit(code.OpPop)
+		}
+	}
+	return nil
+}
+
+// compileInterpolatedString pushes the text and the values of a string
+// with expressions in order, leaving out empty text, and joins them.
+func (c *Compiler) compileInterpolatedString(node *ast.InterpolatedString) error {
+	parts := 0
+	for i, str := range node.Strings {
+		if str.Value != "" {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: str.Value}))
+			parts++
+		}
+		if i == len(node.Values) {
+			break
+		}
+		if err := c.Compile(node.Values[i]); err != nil {
+			return err
+		}
+		parts++
+	}
+	c.emit(code.OpInterpolate, parts)
+	return nil
+}
+
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	switch node.Operator {
+	case "=":
+		switch left := node.Left.(type) {
+		case *ast.Identifier:
+			if err := c.Compile(node.Right); err != nil {
+				return err
+			}
+			c.storeVariable(left, true)
+		case *ast.IndexExpression:
+			if err := c.Compile(left.Left); err != nil {
+				return err
+			}
+			if err := c.Compile(left.Index); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Right); err != nil {
+				return err
+			}
+			c.pos, c.end = left.Index.Pos(), left.Index.End()
+			c.emit(code.OpSetIndex)
+		case *ast.MemberExpression:
+			if err := c.Compile(left.Left); err != nil {
+				return err
+			}
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: left.Member.Value}))
+			if err := c.Compile(node.Right); err != nil {
+				return err
+			}
+			c.pos, c.end = left.Member.Pos(), left.Member.End()
+			c.emit(code.OpSetIndex)
+		default:
+			return compileError(node, "cannot assign to %s", node.Left.String())
+		}
+		return nil
+	case "+=", "-=", "*=", "/=":
+		left, ok := node.Left.(*ast.Identifier)
+		if !ok {
+			return compileError(node, "cannot assign to %s", node.Left.String())
+		}
+		if err := c.Compile(left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(infixOpcodes[node.Operator])
+		c.storeVariable(left, false)
+		return nil
+	}
+
+	op, ok := infixOpcodes[node.Operator]
+	if !ok {
+		return compileError(node, "unknown operator %s", node.Operator)
+	}
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(op)
+	return nil
+}
+
+func compileError(node ast.Node, format string, a ...any) error {
+	pos := node.Pos()
+	return fmt.Errorf(format+" - at line %d, column %d", append(a, pos.Line, pos.Column)...)
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+	bytecode := &Bytecode{
+		Instructions: scope.instructions,
+		Constants:    c.constants,
+		Positions:    scope.positions,
+		Chains:       scope.chains,
+		Globals:      c.globals.names,
+	}
+	if scope.fn != nil {
+		bytecode.Locals, bytecode.Cells = scope.fn.locals, scope.fn.cells
+	}
+	return bytecode
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction to the current scope and returns its offset.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	scope := &c.scopes[c.scopeIndex]
+	pos := len(scope.instructions)
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Pos != c.pos || scope.positions[n-1].End != c.end {
+		scope.positions = append(scope.positions, code.SourcePos{Offset: pos, Pos: c.pos, End: c.end})
+	}
+	scope.instructions = append(scope.instructions, code.Make(op, operands...)...)
+	scope.depth += stackEffect(op, operands)
+	return pos
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// changeOperand rewrites the first operand of the instruction at opPos,
+// used to patch jumps once their target is known.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[opPos])
+	def, _ := code.Lookup(ins[opPos])
+	operands, _ := code.ReadOperands(def, ins[opPos+1:])
+	operands[0] = operand
+	copy(ins[opPos:], code.Make(op, operands...))
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+}
+
+func (c *Compiler) leaveScope() CompilationScope {
+	scope := c.scopes[c.scopeIndex]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	return scope
+}
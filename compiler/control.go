@@ -0,0 +1,309 @@
+package compiler
+
+import (
+	"dot/ast"
+	"dot/code"
+)
+
+// exit is something a break, continue or return has to leave on its way
+// out: a try statement, whose handler is removed and finally block run.
+type exit struct {
+	finally *ast.BlockStatement
+}
+
+// loop is a loop being compiled. depth and exits are the stack depth and
+// the number of exits at the start of its body; breaks and continues are
+// the jumps to patch once their targets are known.
+type loop struct {
+	depth     int
+	exits     int
+	breaks    []int
+	continues []int
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	loopStart := len(c.currentInstructions())
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exitJump := c.emit(code.OpJumpNotTruthy, 9999)
+	c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, loopStart)
+	loopEnd := len(c.currentInstructions())
+	c.changeOperand(exitJump, loopEnd)
+	c.leaveLoop(loopEnd, loopStart)
+	c.emit(code.OpEmpty)
+	return nil
+}
+
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	c.initScope(c.scopeVars[node])
+	if err := c.Compile(node.Initializer); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	loopStart := len(c.currentInstructions())
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exitJump := c.emit(code.OpJumpNotTruthy, 9999)
+	c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	incrementer := len(c.currentInstructions())
+	if err := c.Compile(node.Incrementer); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, loopStart)
+	loopEnd := len(c.currentInstructions())
+	c.changeOperand(exitJump, loopEnd)
+	c.leaveLoop(loopEnd, incrementer)
+	c.emit(code.OpEmpty)
+	return nil
+}
+
+// compileForInStatement lays out a for-in loop as
+//
+//	iterable; OpIter
+//	next: OpIterNext end; start scope; bind variables; body; OpPop; OpJump next
+//	end:  OpPop; OpEmpty
+//
+// keeping the iterator on the stack and giving every element a fresh scope.
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	pos, end := c.pos, c.end
+	c.pos, c.end = node.Iterable.Pos(), node.Iterable.End()
+	c.emit(code.OpIter)
+	c.pos, c.end = pos, end
+
+	loopStart := len(c.currentInstructions())
+	// the value is pushed last, so it is bound first
+	vars := []*ast.Identifier{node.Value}
+	if node.Key != nil {
+		vars = append(vars, node.Key)
+	}
+	exitJump := c.emit(code.OpIterNext, 9999, len(vars))
+	c.initScope(c.scopeVars[node], vars...)
+	for _, v := range vars {
+		c.defineVariable(v)
+		c.emit(code.OpPop)
+	}
+	c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, loopStart)
+	loopEnd := len(c.currentInstructions())
+	c.changeOperand(exitJump, loopEnd)
+	c.leaveLoop(loopEnd, loopStart)
+	c.emit(code.OpPop)
+	c.emit(code.OpEmpty)
+	return nil
+}
+
+// compileLoopJump compiles a break or continue: it drops the values pending
+// on the stack since the start of the loop body, leaves the exits entered
+// in it and jumps to a target patched by leaveLoop.
+func (c *Compiler) compileLoopJump(node ast.Node, isBreak bool) error {
+	scope := c.scopeIndex
+	n := len(c.scopes[scope].loops)
+	if n == 0 {
+		if isBreak {
+			return compileError(node, "'break' outside loop")
+		}
+		return compileError(node, "'continue' outside loop")
+	}
+	l := c.scopes[scope].loops[n-1]
+	start := c.depth()
+	for d := start; d > l.depth; d-- {
+		c.emit(code.OpPop)
+	}
+	if err := c.leaveExits(l.exits); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 9999)
+	if isBreak {
+		c.scopes[scope].loops[n-1].breaks = append(c.scopes[scope].loops[n-1].breaks, jump)
+	} else {
+		c.scopes[scope].loops[n-1].continues = append(c.scopes[scope].loops[n-1].continues, jump)
+	}
+	c.setDepth(start + 1)
+	return nil
+}
+
+func (c *Compiler) enterLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, loop{depth: scope.depth, exits: len(scope.exits)})
+}
+
+// leaveLoop patches the breaks and continues of the innermost loop to jump
+// to breakTarget and continueTarget.
+func (c *Compiler) leaveLoop(breakTarget int, continueTarget int) {
+	scope := &c.scopes[c.scopeIndex]
+	l := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	for _, jump := range l.breaks {
+		c.changeOperand(jump, breakTarget)
+	}
+	for _, jump := range l.continues {
+		c.changeOperand(jump, continueTarget)
+	}
+	c.setDepth(l.depth)
+}
+
+// compileTryStatement lays out a try statement as
+//
+//	OpTry catch; block; OpEndTry; finally; OpJump end
+//	catch:   OpTry rethrow; bind error; catch block; OpEndTry; finally; OpJump end
+//	rethrow: finally; OpThrow
+//	end:
+//
+// leaving out the parts for a missing catch or finally block.
+func (c *Compiler) compileTryStatement(node *ast.TryStatement) error {
+	var endJumps []int
+	start := c.depth()
+
+	catch := c.emit(code.OpTry, 9999)
+	c.pushExit(exit{finally: node.Finally})
+	if err := c.Compile(node.Block); err != nil {
+		return err
+	}
+	c.popExit()
+	c.emit(code.OpEndTry)
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+	c.changeOperand(catch, len(c.currentInstructions()))
+	// the handler starts with the error on the stack
+	c.setDepth(start + 1)
+
+	if node.Catch != nil {
+		rethrow := -1
+		if node.Finally != nil {
+			rethrow = c.emit(code.OpTry, 9999)
+			c.pushExit(exit{finally: node.Finally})
+		}
+		c.emit(code.OpCatch)
+		c.initScope(c.scopeVars[node], node.Parameter)
+		c.defineVariable(node.Parameter)
+		c.emit(code.OpPop)
+		if err := c.Compile(node.Catch); err != nil {
+			return err
+		}
+		if rethrow < 0 {
+			c.patchJumps(endJumps)
+			return nil
+		}
+		c.popExit()
+		c.emit(code.OpEndTry)
+		if err := c.compileFinally(node.Finally); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(rethrow, len(c.currentInstructions()))
+		c.setDepth(start + 1)
+	}
+
+	// the error is on the stack; run the finally block and raise it again
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+	c.patchJumps(endJumps)
+	c.setDepth(start + 1)
+	return nil
+}
+
+// compileFinally compiles a finally block, if there is one, dropping its
+// value.
+func (c *Compiler) compileFinally(finally *ast.BlockStatement) error {
+	if finally == nil {
+		return nil
+	}
+	if err := c.Compile(finally); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	return nil
+}
+
+// leaveExits emits the code that leaves the exits entered since there were
+// n of them, innermost first.
+func (c *Compiler) leaveExits(n int) error {
+	scope := c.scopeIndex
+	exits := c.scopes[scope].exits
+	for i := len(exits) - 1; i >= n; i-- {
+		c.emit(code.OpEndTry)
+		// the finally block runs outside of its try statement
+		c.scopes[scope].exits = exits[:i:i]
+		err := c.compileFinally(exits[i].finally)
+		c.scopes[scope].exits = exits
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) pushExit(e exit) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.exits = append(scope.exits, e)
+}
+
+func (c *Compiler) popExit() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.exits = scope.exits[:len(scope.exits)-1]
+}
+
+func (c *Compiler) patchJumps(jumps []int) {
+	for _, jump := range jumps {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+}
+
+func (c *Compiler) depth() int {
+	return c.scopes[c.scopeIndex].depth
+}
+
+// setDepth sets the stack depth at a jump target or after an instruction
+// that does not fall through.
+func (c *Compiler) setDepth(depth int) {
+	c.scopes[c.scopeIndex].depth = depth
+}
+
+// stackEffect returns how many values an instruction adds to the stack, or
+// removes from it if negative.
+func stackEffect(op code.Opcode, operands []int) int {
+	switch op {
+	case code.OpConstant, code.OpNull, code.OpTrue, code.OpFalse, code.OpEmpty,
+		code.OpGetLocal, code.OpGetCell, code.OpGetFree, code.OpGetGlobal, code.OpGetName,
+		code.OpClosure, code.OpImport:
+		return 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpIndex, code.OpReturnValue, code.OpThrow,
+		code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+		code.OpLessEqual, code.OpGreaterEqual, code.OpAnd, code.OpOr:
+		return -1
+	case code.OpSetIndex, code.OpSlice:
+		return -2
+	case code.OpArray, code.OpHash, code.OpInterpolate:
+		return 1 - operands[0]
+	case code.OpCall:
+		return -operands[0]
+	case code.OpIterNext:
+		return operands[1]
+	default:
+		return 0
+	}
+}
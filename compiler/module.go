@@ -0,0 +1,64 @@
+package compiler
+
+import (
+	"dot/ast"
+	"dot/code"
+	"dot/eval"
+	"dot/object"
+)
+
+// compileImportStatement compiles an import, compiling the file it imports
+// first if this is the first import of it. Whether the module has been
+// imported before, and whether importing it now would close a circle of
+// imports, is decided when the program runs.
+func (c *Compiler) compileImportStatement(node *ast.ImportStatement) error {
+	path := eval.ResolveImport(node.Path.Value, node.Token.Pos.File)
+	idx, ok := c.modules[path]
+	if !ok {
+		var err error
+		if idx, err = c.compileModule(node.Path.Value, path); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpImport, c.addConstant(&object.String{Value: path}), idx)
+	c.defineVariable(node.Name)
+	return nil
+}
+
+// compileModule compiles the file at path, imported as name, to a function
+// and returns its index in the constant pool. If the file cannot be read or
+// parsed, the constant is the ImportError to raise instead.
+func (c *Compiler) compileModule(name string, path string) (int, error) {
+	// the slot is reserved first, so that imports of the module by the
+	// modules it imports refer to it instead of compiling it again
+	idx := c.addConstant(nil)
+	c.modules[path] = idx
+	program, importErr := eval.ParseModule(name, path)
+	if importErr != nil {
+		c.constants[idx] = importErr
+		return idx, nil
+	}
+
+	// the module has global variables of its own
+	globals := c.globals
+	c.globals = newGlobalTable()
+	c.enterScope()
+	err := c.Compile(program)
+	scope := c.leaveScope()
+	moduleGlobals := c.globals
+	c.globals = globals
+	if err != nil {
+		return 0, err
+	}
+	c.constants[idx] = &object.CompiledFunction{
+		Name:         object.ModuleFunction,
+		Instructions: scope.instructions,
+		Positions:    scope.positions,
+		Locals:       scope.fn.locals,
+		Cells:        scope.fn.cells,
+		Chains:       scope.chains,
+		Globals:      moduleGlobals.names,
+		Exports:      program.Exports(),
+	}
+	return idx, nil
+}
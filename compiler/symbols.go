@@ -0,0 +1,421 @@
+package compiler
+
+import (
+	"dot/ast"
+	"dot/code"
+)
+
+// The compiler gives every variable a place of its own before compiling a
+// program: a stack slot of the call it belongs to, a cell if closures
+// capture it, or a numbered slot of the global environment. Names still
+// follow the evaluator's rules, under which a scope defines a variable only
+// once a statement binding it has run, so an identifier may mean different
+// variables at different times. resolve finds, for each identifier, the
+// variables of the scopes around it that may be the one it means, innermost
+// first, stopping at one that is sure to be defined or at the global one.
+
+// binding is a variable of a function, or a global variable if fn is nil.
+type binding struct {
+	fn *function
+	// index is the number of a global variable or the stack slot of a
+	// variable of a function that no closure captures
+	index int
+	// cell is the cell of a variable that closures capture, or -1
+	cell int
+}
+
+// function holds the variables of a function, or of the top-level code of
+// a program or module, where only those of nested scopes are not global.
+type function struct {
+	parent   *function
+	params   []*binding
+	bindings []*binding
+	// free are the variables of enclosing functions that the function's
+	// closures capture, numbered by freeIndex
+	free      []*binding
+	freeIndex map[*binding]int
+	locals    int
+	cells     int
+}
+
+// scope is a scope the evaluator creates: that of a program, of a call, of
+// a for loop, of an iteration of a for-in loop or of a catch block.
+type scope struct {
+	fn     *function
+	parent *scope
+	// names maps the names the scope may define to their variables, which
+	// vars lists in the order they were found; it is nil for the global
+	// scope
+	names map[string]*binding
+	vars  []*binding
+}
+
+// globalTable numbers the global variables of a program or module.
+type globalTable struct {
+	names    []string
+	bindings map[string]*binding
+}
+
+func newGlobalTable() *globalTable {
+	return &globalTable{bindings: make(map[string]*binding)}
+}
+
+func (g *globalTable) binding(name string) *binding {
+	if b, ok := g.bindings[name]; ok {
+		return b
+	}
+	b := &binding{index: len(g.names), cell: -1}
+	g.bindings[name] = b
+	g.names = append(g.names, name)
+	return b
+}
+
+type resolver struct {
+	c *Compiler
+	// definite holds the variables sure to be defined at the code being
+	// resolved
+	definite  map[*binding]bool
+	functions []*function
+}
+
+// resolve finds the variables of program and what its identifiers may
+// refer to, and returns the function of its top-level code.
+func (c *Compiler) resolve(program *ast.Program) *function {
+	r := &resolver{c: c, definite: make(map[*binding]bool)}
+	fn := &function{}
+	r.functions = append(r.functions, fn)
+	r.statements(program.Statements, &scope{fn: fn})
+	for _, fn := range r.functions {
+		fn.number()
+	}
+	return fn
+}
+
+// number gives the variables of fn their stack slots and cells. The
+// parameters come first, in the slots the arguments of a call are pushed
+// to.
+func (fn *function) number() {
+	fn.locals = len(fn.params)
+	for i, b := range fn.params {
+		b.index = i
+	}
+	for _, b := range fn.bindings {
+		if b.cell >= 0 {
+			b.cell = fn.cells
+			fn.cells++
+		}
+		if b.index < 0 && b.cell < 0 {
+			b.index = fn.locals
+			fn.locals++
+		}
+	}
+}
+
+// capture returns the number of b, a variable of an enclosing function,
+// among the variables fn captures, capturing it in the functions in
+// between too.
+func (fn *function) capture(b *binding) int {
+	if i, ok := fn.freeIndex[b]; ok {
+		return i
+	}
+	if fn.parent == b.fn {
+		// numbered later; any cell marks it captured
+		b.cell = 0
+	} else {
+		fn.parent.capture(b)
+	}
+	if fn.freeIndex == nil {
+		fn.freeIndex = make(map[*binding]int)
+	}
+	fn.freeIndex[b] = len(fn.free)
+	fn.free = append(fn.free, b)
+	return fn.freeIndex[b]
+}
+
+func (r *resolver) newScope(parent *scope, fn *function, node ast.Node) *scope {
+	s := &scope{fn: fn, parent: parent, names: make(map[string]*binding)}
+	r.c.scopeVars[node] = s
+	return s
+}
+
+// declare returns the variable name of s, adding it if it is new.
+func (r *resolver) declare(s *scope, name string) *binding {
+	if s.names == nil {
+		return r.c.globals.binding(name)
+	}
+	if b, ok := s.names[name]; ok {
+		return b
+	}
+	b := &binding{fn: s.fn, index: -1, cell: -1}
+	s.names[name] = b
+	s.vars = append(s.vars, b)
+	s.fn.bindings = append(s.fn.bindings, b)
+	return b
+}
+
+// define records that id, which a statement binds in s, means the variable
+// of s.
+func (r *resolver) define(id *ast.Identifier, s *scope) *binding {
+	b := r.declare(s, id.Value)
+	r.c.refs[id] = []*binding{b}
+	return b
+}
+
+// refer records the variables that id, used in s, may refer to.
+func (r *resolver) refer(id *ast.Identifier, s *scope) {
+	var path []*binding
+	for sc := s; sc.names != nil; sc = sc.parent {
+		b, ok := sc.names[id.Value]
+		if !ok {
+			continue
+		}
+		if b.fn != s.fn {
+			s.fn.capture(b)
+		}
+		path = append(path, b)
+		if r.definite[b] {
+			r.c.refs[id] = path
+			return
+		}
+	}
+	r.c.refs[id] = append(path, r.c.globals.binding(id.Value))
+}
+
+// markDefinite records that b is sure to be defined until the returned
+// function is called.
+func (r *resolver) markDefinite(b *binding) func() {
+	if b.fn == nil || r.definite[b] {
+		return func() {}
+	}
+	r.definite[b] = true
+	return func() { delete(r.definite, b) }
+}
+
+// hoist declares in s the variables that node may define in it, so that
+// identifiers used before the statements defining them are resolved
+// knowing about them too.
+func (r *resolver) hoist(node ast.Node, s *scope) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			r.declare(s, n.Identifier.Value)
+		case *ast.ImportStatement:
+			r.declare(s, n.Name.Value)
+		case *ast.InfixExpression:
+			if id, ok := n.Left.(*ast.Identifier); ok && n.Operator == "=" {
+				r.declare(s, id.Value)
+			}
+		case *ast.ForInStatement:
+			r.hoist(n.Iterable, s)
+			return false
+		case *ast.TryStatement:
+			r.hoist(n.Block, s)
+			if n.Finally != nil {
+				r.hoist(n.Finally, s)
+			}
+			return false
+		case *ast.Function, *ast.ForStatement:
+			return false
+		}
+		return true
+	})
+}
+
+// statements resolves a list of statements run in order in s, the
+// variables each one defines being sure to be defined in the ones after.
+func (r *resolver) statements(statements []ast.Statement, s *scope) {
+	var unmark []func()
+	for _, st := range statements {
+		if b := r.statement(st, s); b != nil {
+			unmark = append(unmark, r.markDefinite(b))
+		}
+	}
+	for _, f := range unmark {
+		f()
+	}
+}
+
+// statement resolves st and returns the variable it defines, if any.
+func (r *resolver) statement(st ast.Statement, s *scope) *binding {
+	switch st := st.(type) {
+	case *ast.LetStatement:
+		r.walk(st.Value, s)
+		return r.define(&st.Identifier, s)
+	case *ast.ExportStatement:
+		return r.statement(st.Let, s)
+	case *ast.ImportStatement:
+		return r.define(st.Name, s)
+	}
+	r.walk(st, s)
+	return nil
+}
+
+func (r *resolver) walk(node ast.Node, s *scope) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			r.refer(n, s)
+		case *ast.BlockStatement:
+			r.statements(n.Statements, s)
+		case *ast.LetStatement, *ast.ImportStatement, *ast.ExportStatement:
+			r.statement(n.(ast.Statement), s)
+		case *ast.MemberExpression:
+			r.walk(n.Left, s)
+		case *ast.Function:
+			r.function(n, s)
+		case *ast.ForStatement:
+			r.forStatement(n, s)
+		case *ast.ForInStatement:
+			r.forInStatement(n, s)
+		case *ast.TryStatement:
+			r.tryStatement(n, s)
+		default:
+			return true
+		}
+		return false
+	})
+}
+
+func (r *resolver) function(node *ast.Function, s *scope) {
+	fn := &function{parent: s.fn}
+	r.functions = append(r.functions, fn)
+	inner := r.newScope(s, fn, node)
+	for _, p := range node.Parameters {
+		b := r.define(p, inner)
+		fn.params = append(fn.params, b)
+		defer r.markDefinite(b)()
+	}
+	r.hoist(node.Body, inner)
+	r.statements(node.Body.Statements, inner)
+}
+
+func (r *resolver) forStatement(node *ast.ForStatement, s *scope) {
+	inner := r.newScope(s, s.fn, node)
+	for _, part := range []ast.Node{node.Initializer, node.Condition, node.Incrementer, node.Body} {
+		r.hoist(part, inner)
+	}
+	if b := r.statement(node.Initializer, inner); b != nil {
+		defer r.markDefinite(b)()
+	}
+	r.walk(node.Condition, inner)
+	r.walk(node.Body, inner)
+	r.walk(node.Incrementer, inner)
+}
+
+func (r *resolver) forInStatement(node *ast.ForInStatement, s *scope) {
+	r.walk(node.Iterable, s)
+	inner := r.newScope(s, s.fn, node)
+	defer r.markDefinite(r.define(node.Value, inner))()
+	if node.Key != nil {
+		defer r.markDefinite(r.define(node.Key, inner))()
+	}
+	r.hoist(node.Body, inner)
+	r.walk(node.Body, inner)
+}
+
+func (r *resolver) tryStatement(node *ast.TryStatement, s *scope) {
+	r.walk(node.Block, s)
+	if node.Catch != nil {
+		inner := r.newScope(s, s.fn, node)
+		defer r.markDefinite(r.define(node.Parameter, inner))()
+		r.hoist(node.Catch, inner)
+		r.walk(node.Catch, inner)
+	}
+	if node.Finally != nil {
+		r.walk(node.Finally, s)
+	}
+}
+
+// location returns where the function being compiled keeps b.
+func (c *Compiler) location(b *binding) code.Location {
+	fn := c.scopes[c.scopeIndex].fn
+	switch {
+	case b.fn == nil:
+		return code.Location{Scope: code.GlobalScope, Index: b.index}
+	case b.fn != fn:
+		return code.Location{Scope: code.FreeScope, Index: fn.freeIndex[b]}
+	case b.cell >= 0:
+		return code.Location{Scope: code.CellScope, Index: b.cell}
+	default:
+		return code.Location{Scope: code.LocalScope, Index: b.index}
+	}
+}
+
+var getOpcodes = [...]code.Opcode{
+	code.LocalScope:  code.OpGetLocal,
+	code.CellScope:   code.OpGetCell,
+	code.FreeScope:   code.OpGetFree,
+	code.GlobalScope: code.OpGetGlobal,
+}
+
+var setOpcodes = [...]code.Opcode{
+	code.LocalScope:  code.OpSetLocal,
+	code.CellScope:   code.OpSetCell,
+	code.FreeScope:   code.OpSetFree,
+	code.GlobalScope: code.OpSetGlobal,
+}
+
+// chain adds the chain of places path leads through to the function being
+// compiled and returns its index.
+func (c *Compiler) chain(name string, path []*binding) int {
+	chain := code.Chain{Name: name}
+	for _, b := range path {
+		chain.Path = append(chain.Path, c.location(b))
+	}
+	scope := &c.scopes[c.scopeIndex]
+	scope.chains = append(scope.chains, chain)
+	return len(scope.chains) - 1
+}
+
+// loadVariable pushes the variable id refers to.
+func (c *Compiler) loadVariable(id *ast.Identifier) {
+	path := c.refs[id]
+	if len(path) > 1 {
+		c.emit(code.OpGetName, c.chain(id.Value, path))
+		return
+	}
+	loc := c.location(path[0])
+	c.emit(getOpcodes[loc.Scope], loc.Index)
+}
+
+// defineVariable stores the top of the stack in the variable id, which a
+// statement binds, leaving it on the stack.
+func (c *Compiler) defineVariable(id *ast.Identifier) {
+	loc := c.location(c.refs[id][0])
+	c.emit(setOpcodes[loc.Scope], loc.Index)
+}
+
+// storeVariable stores the top of the stack in the variable id refers to,
+// leaving it on the stack. If none is defined, an assignment defines the
+// variable of the innermost scope and a compound assignment raises a
+// NameError.
+func (c *Compiler) storeVariable(id *ast.Identifier, define bool) {
+	path := c.refs[id]
+	last := path[len(path)-1]
+	switch {
+	case len(path) == 1 && (define || last.fn != nil):
+		c.defineVariable(id)
+	case define:
+		c.emit(code.OpSetName, c.chain(id.Value, path))
+	default:
+		c.emit(code.OpAssignName, c.chain(id.Value, path))
+	}
+}
+
+// initScope emits the code that starts the variables s declares out
+// undefined, except those in skip, which the code that follows defines
+// straight away.
+func (c *Compiler) initScope(s *scope, skip ...*ast.Identifier) {
+	defined := make(map[*binding]bool)
+	for _, id := range skip {
+		defined[c.refs[id][0]] = true
+	}
+	for _, b := range s.vars {
+		switch {
+		case b.cell >= 0:
+			c.emit(code.OpNewCell, b.cell)
+		case !defined[b]:
+			c.emit(code.OpClearLocal, b.index)
+		}
+	}
+}
@@ -2,34 +2,44 @@ package eval
 
 import (
 	"dot/object"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 var builtins = map[string]*object.Builtin{
 	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError(fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(args)), 0, 0)
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 1); err != nil {
+				return err
 			}
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: float64(len(arg.Value))}
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			case *object.Array:
-				return &object.Integer{Value: float64(len(arg.Elements))}
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Keys))}
+			case *object.Range:
+				return &object.Integer{Value: arg.Len()}
 			default:
-				return newError(fmt.Sprintf("argument to `len` not supported, got %s", args[0].Type()), 0, 0)
+				return object.CheckType("len", arg, object.STRING_OBJ, object.ARRAY_OBJ, object.HASH_OBJ, object.RANGE_OBJ)
 			}
 		},
 	},
 	"first": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError(fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(args)), 0, 0)
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError(fmt.Sprintf("argument to `first` must be ARRAY, got %s", args[0].Type()), 0, 0)
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("first", args, object.ARRAY_OBJ); err != nil {
+				return err
 			}
 
 			arr := args[0].(*object.Array)
@@ -41,12 +51,9 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError(fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(args)), 0, 0)
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError(fmt.Sprintf("argument to `last` must be ARRAY, got %s", args[0].Type()), 0, 0)
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("last", args, object.ARRAY_OBJ); err != nil {
+				return err
 			}
 
 			arr := args[0].(*object.Array)
@@ -59,12 +66,9 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"rest": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError(fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(args)), 0, 0)
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError(fmt.Sprintf("argument to `rest` must be ARRAY, got %s", args[0].Type()), 0, 0)
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("rest", args, object.ARRAY_OBJ); err != nil {
+				return err
 			}
 
 			arr := args[0].(*object.Array)
@@ -79,12 +83,9 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError(fmt.Sprintf("wrong number of arguments. got=%d, want=2", len(args)), 0, 0)
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError(fmt.Sprintf("argument to `push` must be ARRAY, got %s", args[0].Type()), 0, 0)
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("push", args, object.ARRAY_OBJ, object.ANY_OBJ); err != nil {
+				return err
 			}
 
 			arr := args[0].(*object.Array)
@@ -98,39 +99,772 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"print": {
-		Fn: func(args ...object.Object) object.Object {
+		Capability: object.CapIO,
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 			for _, arg := range args {
-				println(arg.String())
+				fmt.Fprintln(rt.Stdout, arg.String())
 			}
 			return EMPTY
 		},
 	},
 	"ask": {
-		Fn: func(args ...object.Object) object.Object {
+		Capability: object.CapIO,
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
 			for _, arg := range args {
-				print(arg.String())
+				fmt.Fprint(rt.Stdout, arg.String())
+			}
+			input, err := rt.Stdin.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return object.NewError(object.RuntimeError, "failed to read input: %s", err)
 			}
-			var input string
-			fmt.Scanln(&input)
-			return &object.String{Value: input}
+			return &object.String{Value: strings.TrimRight(input, "\r\n")}
+		},
+	},
+	"copy": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 1); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				elements := make([]object.Object, len(arg.Elements))
+				copy(elements, arg.Elements)
+				return &object.Array{Elements: elements}
+			case *object.Hash:
+				hash := object.NewHash()
+				for _, key := range arg.Keys {
+					hash.Set(key, arg.Pairs[key])
+				}
+				return hash
+			default:
+				// every other value is immutable
+				return arg
+			}
+		},
+	},
+	"deepcopy": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 1); err != nil {
+				return err
+			}
+			return deepCopy(args[0], make(map[object.Object]object.Object))
+		},
+	},
+	"range": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 3); err != nil {
+				return err
+			}
+			bounds := make([]int64, len(args))
+			for i, arg := range args {
+				if err := object.CheckType("range", arg, object.INTEGER_OBJ); err != nil {
+					return err
+				}
+				n := arg.(*object.Integer)
+				if n.IsBig() {
+					return object.NewError(object.ValueError, "argument to `range` too large: %s", n.String())
+				}
+				bounds[i] = n.Value
+			}
+			r := &object.Range{Step: 1}
+			switch len(bounds) {
+			case 1:
+				r.Stop = bounds[0]
+			case 2:
+				r.Start, r.Stop = bounds[0], bounds[1]
+			case 3:
+				r.Start, r.Stop, r.Step = bounds[0], bounds[1], bounds[2]
+			}
+			if r.Step == 0 {
+				return object.NewError(object.ValueError, "`range` step must not be zero")
+			}
+			return r
 		},
 	},
 	"int": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError(fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(args)), 0, 0)
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 1); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.Float:
+				return floatToInteger(arg)
+			case *object.String:
+				str := strings.TrimSpace(arg.Value)
+				value, err := strconv.ParseInt(str, 10, 64)
+				if errors.Is(err, strconv.ErrRange) {
+					if value, ok := new(big.Int).SetString(str, 10); ok {
+						return object.NewBigInteger(value)
+					}
+				}
+				if err != nil {
+					return object.NewError(object.ValueError, "cannot convert %q to INTEGER", arg.Value)
+				}
+				return &object.Integer{Value: value}
+			default:
+				return object.CheckType("int", arg, object.INTEGER_OBJ, object.FLOAT_OBJ, object.STRING_OBJ)
 			}
-			if args[0].Type() != object.STRING_OBJ {
-				return newError(fmt.Sprintf("argument to `int` must be STRING, got %s", args[0].Type()), 0, 0)
+		},
+	},
+	"float": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 1); err != nil {
+				return err
 			}
 
-			str := args[0].(*object.String).Value
-			value, err := strconv.Atoi(str)
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return &object.Float{Value: arg.Float()}
+			case *object.Float:
+				return arg
+			case *object.String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if errors.Is(err, strconv.ErrRange) {
+					return object.NewError(object.ValueError, "cannot convert %q to FLOAT: out of range", arg.Value)
+				}
+				if err != nil {
+					return object.NewError(object.ValueError, "cannot convert %q to FLOAT", arg.Value)
+				}
+				return &object.Float{Value: value}
+			default:
+				return object.CheckType("float", arg, object.INTEGER_OBJ, object.FLOAT_OBJ, object.STRING_OBJ)
+			}
+		},
+	},
+	"str": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 1); err != nil {
+				return err
+			}
+			if str, ok := args[0].(*object.String); ok {
+				return str
+			}
+			return &object.String{Value: args[0].String()}
+		},
+	},
+	"split": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("split", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+				return err
+			}
+			return stringArray(strings.Split(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		},
+	},
+	"join": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 2); err != nil {
+				return err
+			}
+			if err := object.CheckType("join", args[0], object.ARRAY_OBJ); err != nil {
+				return err
+			}
+			var sep string
+			if len(args) == 2 {
+				if err := object.CheckType("join", args[1], object.STRING_OBJ); err != nil {
+					return err
+				}
+				sep = args[1].(*object.String).Value
+			}
+			elements := args[0].(*object.Array).Elements
+			parts := make([]string, len(elements))
+			for i, el := range elements {
+				parts[i] = el.String()
+			}
+			return &object.String{Value: strings.Join(parts, sep)}
+		},
+	},
+	"chars": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("chars", args, object.STRING_OBJ); err != nil {
+				return err
+			}
+			return stringArray(strings.Split(args[0].(*object.String).Value, ""))
+		},
+	},
+	"trim":       stringFunc("trim", strings.TrimSpace),
+	"upper":      stringFunc("upper", strings.ToUpper),
+	"lower":      stringFunc("lower", strings.ToLower),
+	"contains":   stringTest("contains", strings.Contains),
+	"startsWith": stringTest("startsWith", strings.HasPrefix),
+	"endsWith":   stringTest("endsWith", strings.HasSuffix),
+	"indexOf": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("indexOf", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+				return err
+			}
+			s := args[0].(*object.String).Value
+			i := strings.Index(s, args[1].(*object.String).Value)
+			if i < 0 {
+				return &object.Integer{Value: -1}
+			}
+			return &object.Integer{Value: int64(utf8.RuneCountInString(s[:i]))}
+		},
+	},
+	"replace": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("replace", args, object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+				return err
+			}
+			s, old, new := args[0].(*object.String), args[1].(*object.String), args[2].(*object.String)
+			return &object.String{Value: strings.ReplaceAll(s.Value, old.Value, new.Value)}
+		},
+	},
+	"repeat": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("repeat", args, object.STRING_OBJ, object.INTEGER_OBJ); err != nil {
+				return err
+			}
+			s, n := args[0].(*object.String), args[1].(*object.Integer)
+			if n.BigInt().Sign() < 0 {
+				return object.NewError(object.ValueError, "`repeat` count must not be negative, got %s", n.String())
+			}
+			if n.IsBig() || len(s.Value) > 0 && n.Value > math.MaxInt32/int64(len(s.Value)) {
+				return object.NewError(object.ValueError, "result of `repeat` too large")
+			}
+			if err := rt.CheckLength(object.STRING_OBJ, len(s.Value)*int(n.Value)); err != nil {
+				return err
+			}
+			return &object.String{Value: strings.Repeat(s.Value, int(n.Value))}
+		},
+	},
+	"padLeft": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			return pad(rt, "padLeft", args, func(s, padding string) string { return padding + s })
+		},
+	},
+	"padRight": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			return pad(rt, "padRight", args, func(s, padding string) string { return s + padding })
+		},
+	},
+	"map": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			elements, f, err := callbackArgs(rt, "map", args)
 			if err != nil {
-				return newError(fmt.Sprintf("failed to convert string to integer: %s", err.Error()), 0, 0)
+				return err
 			}
-
-			return &object.Integer{Value: float64(value)}
+			result := make([]object.Object, len(elements))
+			for i, el := range elements {
+				if result[i] = rt.Call(f, el); isError(result[i]) {
+					return result[i]
+				}
+			}
+			return &object.Array{Elements: result}
+		},
+	},
+	"filter": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			elements, f, err := callbackArgs(rt, "filter", args)
+			if err != nil {
+				return err
+			}
+			result := []object.Object{}
+			for _, el := range elements {
+				keep := rt.Call(f, el)
+				if isError(keep) {
+					return keep
+				}
+				if IsTruthy(keep) {
+					result = append(result, el)
+				}
+			}
+			return &object.Array{Elements: result}
+		},
+	},
+	"reduce": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 2, 3); err != nil {
+				return err
+			}
+			elements, f, err := callbackArgs(rt, "reduce", args[:2])
+			if err != nil {
+				return err
+			}
+			var acc object.Object
+			switch {
+			case len(args) == 3:
+				acc = args[2]
+			case len(elements) == 0:
+				return object.NewError(object.ValueError, "`reduce` of an empty collection with no initial value")
+			default:
+				acc, elements = elements[0], elements[1:]
+			}
+			for _, el := range elements {
+				if acc = rt.Call(f, acc, el); isError(acc) {
+					return acc
+				}
+			}
+			return acc
+		},
+	},
+	"find": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			elements, f, err := callbackArgs(rt, "find", args)
+			if err != nil {
+				return err
+			}
+			for _, el := range elements {
+				found := rt.Call(f, el)
+				if isError(found) {
+					return found
+				}
+				if IsTruthy(found) {
+					return el
+				}
+			}
+			return NULL
+		},
+	},
+	"any": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			return testElements(rt, "any", args, true)
 		},
 	},
+	"all": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			return testElements(rt, "all", args, false)
+		},
+	},
+	"sort": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 2); err != nil {
+				return err
+			}
+			elements, err := elementsOf(rt, "sort", args[0])
+			if err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				return sortElements(elements, func(a, b object.Object) object.Object {
+					return InfixOperation("<", a, b)
+				})
+			}
+			if err := object.CheckType("sort", args[1], object.FUNCTION_OBJ); err != nil {
+				return err
+			}
+			return sortElements(elements, func(a, b object.Object) object.Object {
+				return comparison(rt.Call(args[1], a, b))
+			})
+		},
+	},
+	"sortBy": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			elements, f, err := callbackArgs(rt, "sortBy", args)
+			if err != nil {
+				return err
+			}
+			keys, err := callEach(rt, f, elements)
+			if err != nil {
+				return err
+			}
+			// sort the positions of the elements, so that each is compared
+			// by the key computed for it once
+			order := make([]object.Object, len(elements))
+			for i := range order {
+				order[i] = &object.Integer{Value: int64(i)}
+			}
+			sorted := sortElements(order, func(a, b object.Object) object.Object {
+				return InfixOperation("<", keys[a.(*object.Integer).Value], keys[b.(*object.Integer).Value])
+			})
+			if isError(sorted) {
+				return sorted
+			}
+			for i, pos := range sorted.(*object.Array).Elements {
+				order[i] = elements[pos.(*object.Integer).Value]
+			}
+			return &object.Array{Elements: order}
+		},
+	},
+	"groupBy": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			elements, f, err := callbackArgs(rt, "groupBy", args)
+			if err != nil {
+				return err
+			}
+			keys, err := callEach(rt, f, elements)
+			if err != nil {
+				return err
+			}
+			groups := object.NewHash()
+			for i, key := range keys {
+				hashable, ok := key.(object.Hashable)
+				if !ok {
+					return object.NewError(object.TypeError, "unusable as hash key: %s", key.Type())
+				}
+				pair, ok := groups.Pairs[hashable.HashKey()]
+				if !ok {
+					pair = object.HashPair{Key: key, Value: &object.Array{}}
+					groups.Set(hashable.HashKey(), pair)
+				}
+				group := pair.Value.(*object.Array)
+				group.Elements = append(group.Elements, elements[i])
+			}
+			return groups
+		},
+	},
+	"zip": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 2, -1); err != nil {
+				return err
+			}
+			columns := make([][]object.Object, len(args))
+			length := -1
+			for i, arg := range args {
+				elements, err := elementsOf(rt, "zip", arg)
+				if err != nil {
+					return err
+				}
+				columns[i] = elements
+				if length < 0 || len(elements) < length {
+					length = len(elements)
+				}
+			}
+			rows := make([]object.Object, length)
+			for i := range rows {
+				row := make([]object.Object, len(columns))
+				for j, column := range columns {
+					row[j] = column[i]
+				}
+				rows[i] = &object.Array{Elements: row}
+			}
+			return &object.Array{Elements: rows}
+		},
+	},
+	"enumerate": {
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 1, 1); err != nil {
+				return err
+			}
+			it, ok := object.Iterate(args[0])
+			if !ok {
+				return object.CheckType("enumerate", args[0], object.ARRAY_OBJ, object.STRING_OBJ, object.HASH_OBJ, object.RANGE_OBJ)
+			}
+			if err := checkRange(rt, args[0]); err != nil {
+				return err
+			}
+			pairs := []object.Object{}
+			for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+				if err := rt.Step(); err != nil {
+					return err
+				}
+				pairs = append(pairs, &object.Array{Elements: []object.Object{key, value}})
+			}
+			return &object.Array{Elements: pairs}
+		},
+	},
+	"readfile": {
+		Capability: object.CapFS,
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("readfile", args, object.STRING_OBJ); err != nil {
+				return err
+			}
+			content, err := os.ReadFile(args[0].(*object.String).Value)
+			if err != nil {
+				return object.NewError(object.RuntimeError, "failed to read file: %s", err)
+			}
+			return &object.String{Value: string(content)}
+		},
+	},
+	"writefile": {
+		Capability: object.CapFS,
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("writefile", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+				return err
+			}
+			if err := os.WriteFile(args[0].(*object.String).Value, []byte(args[1].(*object.String).Value), 0o644); err != nil {
+				return object.NewError(object.RuntimeError, "failed to write file: %s", err)
+			}
+			return NULL
+		},
+	},
+	"getenv": {
+		Capability: object.CapEnv,
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArgs("getenv", args, object.STRING_OBJ); err != nil {
+				return err
+			}
+			value, ok := os.LookupEnv(args[0].(*object.String).Value)
+			if !ok {
+				return NULL
+			}
+			return &object.String{Value: value}
+		},
+	},
+	"now": {
+		Capability: object.CapTime,
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 0, 0); err != nil {
+				return err
+			}
+			// seconds since the Unix epoch
+			return &object.Float{Value: float64(time.Now().UnixNano()) / 1e9}
+		},
+	},
+	"exit": {
+		Capability: object.CapProcess,
+		Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 0, 1); err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				return rt.Exit(0)
+			}
+			if err := object.CheckType("exit", args[0], object.INTEGER_OBJ); err != nil {
+				return err
+			}
+			code := args[0].(*object.Integer)
+			if code.IsBig() || code.Value < 0 || code.Value > 255 {
+				return object.NewError(object.ValueError, "exit status must be between 0 and 255, got %s", code.String())
+			}
+			return rt.Exit(int(code.Value))
+		},
+	},
+}
+
+func init() {
+	for name, fn := range builtins {
+		fn.Name = name
+	}
+}
+
+func stringArray(parts []string) *object.Array {
+	elements := make([]object.Object, len(parts))
+	for i, part := range parts {
+		elements[i] = &object.String{Value: part}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// stringFunc returns the builtin called name, which applies f to a string.
+func stringFunc(name string, f func(string) string) *object.Builtin {
+	return &object.Builtin{Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+		if err := object.CheckArgs(name, args, object.STRING_OBJ); err != nil {
+			return err
+		}
+		return &object.String{Value: f(args[0].(*object.String).Value)}
+	}}
+}
+
+// stringTest returns the builtin called name, which reports whether f holds
+// for two strings.
+func stringTest(name string, f func(string, string) bool) *object.Builtin {
+	return &object.Builtin{Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+		if err := object.CheckArgs(name, args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+			return err
+		}
+		return getBooleanObject(f(args[0].(*object.String).Value, args[1].(*object.String).Value))
+	}}
+}
+
+// pad implements padLeft and padRight, which add copies of a character,
+// a space unless another is given, to a string until it is width
+// characters long. join adds the padding to the string.
+func pad(rt *object.Runtime, name string, args []object.Object, join func(s, padding string) string) object.Object {
+	if err := object.CheckArity(args, 2, 3); err != nil {
+		return err
+	}
+	types := []object.ObjectType{object.STRING_OBJ, object.INTEGER_OBJ, object.STRING_OBJ}
+	for i, arg := range args {
+		if err := object.CheckType(name, arg, types[i]); err != nil {
+			return err
+		}
+	}
+	s, width := args[0].(*object.String).Value, args[1].(*object.Integer)
+	padding := " "
+	if len(args) == 3 {
+		padding = args[2].(*object.String).Value
+		if utf8.RuneCountInString(padding) != 1 {
+			return object.NewError(object.ValueError, "`%s` padding must be one character, got %q", name, padding)
+		}
+	}
+	missing := width.Float() - float64(utf8.RuneCountInString(s))
+	if missing <= 0 {
+		return args[0]
+	}
+	if missing > math.MaxInt32 {
+		return object.NewError(object.ValueError, "result of `%s` too large", name)
+	}
+	if err := rt.CheckLength(object.STRING_OBJ, len(s)+int(missing)*len(padding)); err != nil {
+		return err
+	}
+	return &object.String{Value: join(s, strings.Repeat(padding, int(missing)))}
+}
+
+func isError(obj object.Object) bool {
+	return obj.Type() == object.ERROR_OBJ
+}
+
+// elementsOf returns the elements of arg, an array, string, hash or range,
+// as a for-in loop with one variable binds them. name is the builtin arg
+// was passed to.
+func elementsOf(rt *object.Runtime, name string, arg object.Object) ([]object.Object, *object.Error) {
+	if arr, ok := arg.(*object.Array); ok {
+		return arr.Elements, nil
+	}
+	it, ok := object.Iterate(arg)
+	if !ok {
+		return nil, object.CheckType(name, arg, object.ARRAY_OBJ, object.STRING_OBJ, object.HASH_OBJ, object.RANGE_OBJ)
+	}
+	if err := checkRange(rt, arg); err != nil {
+		return nil, err
+	}
+	var elements []object.Object
+	for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+		if err := rt.Step(); err != nil {
+			return nil, err
+		}
+		elements = append(elements, it.Single(key, value))
+	}
+	return elements, nil
+}
+
+// checkRange returns a LimitError if arg is a range with more elements than
+// rt allows in an array, as a range takes no room until it is made into one.
+func checkRange(rt *object.Runtime, arg object.Object) *object.Error {
+	if r, ok := arg.(*object.Range); ok {
+		return rt.CheckLength(object.RANGE_OBJ, int(r.Len()))
+	}
+	return nil
+}
+
+// callbackArgs checks the arguments of a builtin called with a collection
+// and a function, and returns the elements of the collection and the
+// function.
+func callbackArgs(rt *object.Runtime, name string, args []object.Object) ([]object.Object, object.Object, *object.Error) {
+	if err := object.CheckArity(args, 2, 2); err != nil {
+		return nil, nil, err
+	}
+	elements, err := elementsOf(rt, name, args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := object.CheckType(name, args[1], object.FUNCTION_OBJ); err != nil {
+		return nil, nil, err
+	}
+	return elements, args[1], nil
+}
+
+// callEach returns f(x) for every element x.
+func callEach(rt *object.Runtime, f object.Object, elements []object.Object) ([]object.Object, *object.Error) {
+	results := make([]object.Object, len(elements))
+	for i, el := range elements {
+		results[i] = rt.Call(f, el)
+		if err, ok := results[i].(*object.Error); ok {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// testElements implements any and all, which look for an element for which
+// the function given, or the element itself if there is none, is truthy or
+// falsy respectively.
+func testElements(rt *object.Runtime, name string, args []object.Object, want bool) object.Object {
+	if err := object.CheckArity(args, 1, 2); err != nil {
+		return err
+	}
+	elements, err := elementsOf(rt, name, args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 {
+		if err := object.CheckType(name, args[1], object.FUNCTION_OBJ); err != nil {
+			return err
+		}
+	}
+	for _, el := range elements {
+		result := el
+		if len(args) == 2 {
+			if result = rt.Call(args[1], el); isError(result) {
+				return result
+			}
+		}
+		if IsTruthy(result) == want {
+			return getBooleanObject(want)
+		}
+	}
+	return getBooleanObject(!want)
+}
+
+// sortElements returns a new array of elements in the order given by less,
+// which returns TRUE if its first argument goes before its second. The
+// sort is stable, and stops at the first error less returns.
+func sortElements(elements []object.Object, less func(a, b object.Object) object.Object) object.Object {
+	sorted := append([]object.Object(nil), elements...)
+	var err object.Object
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		result := less(sorted[i], sorted[j])
+		if isError(result) {
+			err = result
+			return false
+		}
+		return result == TRUE
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Array{Elements: sorted}
+}
+
+// comparison converts the result of a comparator given to sort, a number
+// that is negative if a goes before b or a boolean that is true if it
+// does, to TRUE or FALSE.
+func comparison(result object.Object) object.Object {
+	switch result := result.(type) {
+	case *object.Boolean, *object.Error:
+		return result
+	case *object.Integer:
+		return getBooleanObject(result.BigInt().Sign() < 0)
+	case *object.Float:
+		return getBooleanObject(result.Value < 0)
+	default:
+		return object.NewError(object.TypeError, "`sort` comparator must return a number or a boolean, got %s", result.Type())
+	}
+}
+
+// floatToInteger converts f to an integer, dropping its fraction.
+func floatToInteger(f *object.Float) object.Object {
+	if math.IsNaN(f.Value) || math.IsInf(f.Value, 0) {
+		return object.NewError(object.ValueError, "cannot convert %s to integer", f.String())
+	}
+	if f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return &object.Integer{Value: int64(f.Value)}
+	}
+	value, _ := big.NewFloat(f.Value).Int(nil)
+	return object.NewBigInteger(value)
+}
+
+// deepCopy copies obj and every array and hash inside it. copies maps the
+// containers copied so far to their copy, so that a container reached twice
+// is copied once and cycles are preserved.
+func deepCopy(obj object.Object, copies map[object.Object]object.Object) object.Object {
+	if c, ok := copies[obj]; ok {
+		return c
+	}
+	switch obj := obj.(type) {
+	case *object.Array:
+		array := &object.Array{Elements: make([]object.Object, len(obj.Elements))}
+		copies[obj] = array
+		for i, el := range obj.Elements {
+			array.Elements[i] = deepCopy(el, copies)
+		}
+		return array
+	case *object.Hash:
+		hash := object.NewHash()
+		copies[obj] = hash
+		for _, key := range obj.Keys {
+			pair := obj.Pairs[key]
+			hash.Set(key, object.HashPair{Key: pair.Key, Value: deepCopy(pair.Value, copies)})
+		}
+		return hash
+	default:
+		return obj
+	}
 }
@@ -1,10 +1,11 @@
 package eval
 
 import (
+	"context"
 	"dot/ast"
-	"dot/lexer"
 	"dot/object"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -12,275 +13,324 @@ var (
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
 	EMPTY = &object.String{Value: ""}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-func Eval(node ast.Node, env *object.Environment, lexer lexer.Lexer) object.Object {
+// EvalContext starts a run of node in env under ctx, returning a LimitError
+// once ctx is done or the run exceeds the limits of env's runtime.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	env.Runtime().Start(ctx)
+	return Eval(node, env)
+}
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Runtime().Step(); err != nil {
+		return withPos(err, node)
+	}
 	switch node := node.(type) {
 	case *ast.Integer:
-		return &object.Integer{Value: node.Value}
+		return &object.Integer{Value: node.Value, Big: node.Big}
+	case *ast.Float:
+		return &object.Float{Value: node.Value}
 	case *ast.Identifier:
-		if fn, ok := builtins[node.Value]; ok {
-			return fn
+		// variables shadow builtins of the same name
+		if val, ok := env.Get(node.Value); ok {
+			return val
 		}
-		val, ok := env.Get(node.Value)
-		if !ok {
-			return newError("identifier not found: "+node.Value, lexer.Line(), lexer.Column())
+		if fn, ok := LookupBuiltin(env.Runtime(), node.Value); ok {
+			return fn
 		}
-		return val
+		return newError(node, object.NameError, "identifier not found: %s", node.Value)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env, lexer)
+		return Eval(node.Expression, env)
 	case *ast.Boolean:
-		return &object.Boolean{Value: node.Value}
+		return getBooleanObject(node.Value)
 	case *ast.String:
 		return &object.String{Value: node.Value}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env, lexer)
+		val := Eval(node.Value, env)
 		if val == nil {
 			return nil
 		}
+		if isAbrupt(val) {
+			return val
+		}
 		env.Set(node.Identifier.Value, val)
 		return val
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.ExportStatement:
+		return Eval(node.Let, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env, lexer)
+		val := Eval(node.ReturnValue, env)
 		if val == nil {
 			return nil
 		}
+		if isAbrupt(val) {
+			return val
+		}
 		return &object.ReturnValue{Value: val}
 	case *ast.PrefixExpression:
-		switch node.Operator {
-		case "!":
-			right, ok := Eval(node.Right, env, lexer).(*object.Boolean)
-			if !ok {
-				return newError("invalid operation: "+node.String(), lexer.Line(), lexer.Column())
-			}
-			return &object.Boolean{Value: !right.Value}
-		case "-":
-			right, ok := Eval(node.Right, env, lexer).(*object.Integer)
-			if !ok {
-				return newError("invalid operation: "+node.String(), lexer.Line(), lexer.Column())
-			}
-			return &object.Integer{Value: -right.Value}
-		case "+":
-			right, ok := Eval(node.Right, env, lexer).(*object.Integer)
-			if !ok {
-				return newError("invalid operation: "+node.String(), lexer.Line(), lexer.Column())
-			}
-			return &object.Integer{Value: right.Value}
-		default:
-			return newError("unknown operator: "+node.Operator, lexer.Line(), lexer.Column())
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
 		}
+		return withPos(PrefixOperation(node.Operator, right), node)
 	case *ast.InfixExpression:
 		switch node.Operator {
 		case "+=", "-=", "*=", "/=":
-			left := node.Left.(*ast.Identifier)
-			val := Eval(node.Right, env, lexer)
+			left, ok := node.Left.(*ast.Identifier)
+			if !ok {
+				return newError(node, object.TypeError, "cannot assign to %s", node.Left.String())
+			}
+			current := Eval(left, env)
+			if isAbrupt(current) {
+				return current
+			}
+			val := Eval(node.Right, env)
 			if val == nil {
 				return nil
 			}
-			ident, ok := env.Get(left.Value)
-			if !ok {
-				return newError("identifier not found: "+left.Value, lexer.Line(), lexer.Column())
+			if isAbrupt(val) {
+				return val
 			}
-			if ident.Type() != val.Type() {
-				return newError(fmt.Sprintf("type mismatch: %s node.Operator %s", ident.Type(), val.Type()), lexer.Line(), lexer.Column())
+			result := checkSize(InfixOperation(strings.TrimSuffix(node.Operator, "="), current, val), env.Runtime())
+			if isAbrupt(result) {
+				return withPos(result, node)
 			}
-			switch node.Operator {
-			case "+=":
-				switch ident := ident.(type) {
-				case *object.Integer:
-					ident.Value += val.(*object.Integer).Value
-					return ident
-				case *object.String:
-					ident.Value += val.(*object.String).Value
-					return ident
-				default:
-					return newError(fmt.Sprintf("invalid operation: %s node.Operator %s", ident.Type(), val.Type()), lexer.Line(), lexer.Column())
-				}
-			case "-=":
-				ident.(*object.Integer).Value -= val.(*object.Integer).Value
-				return ident
-			case "*=":
-				ident.(*object.Integer).Value *= val.(*object.Integer).Value
-				return ident
-			case "/=":
-				ident.(*object.Integer).Value /= val.(*object.Integer).Value
-				return ident
+			if !env.Assign(left.Value, result) {
+				return newError(node, object.NameError, "identifier not found: %s", left.Value)
 			}
+			return result
 		case "=":
-			// reassigning the value of a variable
-			if _, ok := node.Left.(*ast.IndexExpression); !ok {
-				val := Eval(node.Right, env, lexer)
+			// reassigning the value of a variable where it is defined, or
+			// defining it here if it is new
+			if _, ok := node.Left.(*ast.Identifier); ok {
+				val := Eval(node.Right, env)
 				if val == nil {
 					return NULL
 				}
-				env.Set(node.Left.(*ast.Identifier).Value, val)
+				if isAbrupt(val) {
+					return val
+				}
+				name := node.Left.(*ast.Identifier).Value
+				if !env.Assign(name, val) {
+					env.Set(name, val)
+				}
 				return val
 			}
 
-			// reassigning the value of an element in an array
-			left := node.Left.(*ast.IndexExpression)
-			val := Eval(node.Right, env, lexer)
+			// reassigning the value of an element in an array or a hash,
+			// or of a member
+			var container, index object.Object
+			var indexNode ast.Node
+			switch left := node.Left.(type) {
+			case *ast.IndexExpression:
+				container = Eval(left.Left, env)
+				if isAbrupt(container) {
+					return container
+				}
+				index = Eval(left.Index, env)
+				if isAbrupt(index) {
+					return index
+				}
+				indexNode = left.Index
+			case *ast.MemberExpression:
+				container = Eval(left.Left, env)
+				if isAbrupt(container) {
+					return container
+				}
+				index = &object.String{Value: left.Member.Value}
+				indexNode = left.Member
+			}
+			val := Eval(node.Right, env)
 			if val == nil {
 				return nil
 			}
-			arrayObj, ok := env.Get(left.Left.String())
-			if !ok {
-				return newError("identifier not found: "+left.Left.String(), lexer.Line(), lexer.Column())
+			if isAbrupt(val) {
+				return val
 			}
-			array, ok := arrayObj.(*object.Array)
-			if !ok {
-				if hashObj, ok := env.Get(left.Left.String()); ok {
-					hash := hashObj.(*object.Hash)
-					key := Eval(left.Index, env, lexer)
-					if key.Type() == object.ERROR_OBJ {
-						return key
-					}
-					hash.Pairs[key.(object.Hashable).HashKey()] = object.HashPair{Key: key, Value: val}
-					return val
-				}
-				return newError(fmt.Sprintf("invalid operation: %s %s %s", arrayObj.Type(), node.Operator, val.Type()), lexer.Line(), lexer.Column())
+			result := SetIndex(container, index, val)
+			if isAbrupt(result) {
+				return withPos(result, indexNode)
 			}
-			index := int(Eval(left.Index, env, lexer).(*object.Integer).Value)
-			if index < 0 || index >= len(array.Elements) {
-				return newError("index out of range", lexer.Line(), lexer.Column())
+			// a hash grows with every new key
+			if err := env.Runtime().CheckSize(container); err != nil {
+				return withPos(err, node)
 			}
-			array.Elements[index] = val
-			return val
+			return result
+		}
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
 		}
-		left := Eval(node.Left, env, lexer)
-		right := Eval(node.Right, env, lexer)
 		if left == nil || right == nil {
 			if left == nil {
-				return newError("left operand is nil", lexer.Line(), lexer.Column())
+				return newError(node, object.RuntimeError, "left operand is nil")
 			} else {
-				return newError("right operand is nil", lexer.Line(), lexer.Column())
+				return newError(node, object.RuntimeError, "right operand is nil")
 			}
 		}
-		switch {
-		case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-			return evalIntegerInfixOperation(node.Operator, left, right, lexer, *env)
-		case node.Operator == "==":
-			return getBooleanObject(left.String() == right.String())
-		case node.Operator == "&&":
-			if left.Type() != object.BOOLEAN_OBJ || right.Type() != object.BOOLEAN_OBJ {
-				return newError(fmt.Sprintf("invalid operation: %s %s %s", left.Type(), node.Operator, right.Type()), lexer.Line(), lexer.Column())
-			}
-			return getBooleanObject(left.(*object.Boolean).Value && right.(*object.Boolean).Value)
-		case node.Operator == "||":
-			if left.Type() != object.BOOLEAN_OBJ || right.Type() != object.BOOLEAN_OBJ {
-				return newError(fmt.Sprintf("invalid operation: %s %s %s", left.Type(), node.Operator, right.Type()), lexer.Line(), lexer.Column())
-			}
-			return getBooleanObject(left.(*object.Boolean).Value || right.(*object.Boolean).Value)
-		case node.Operator == "!=":
-			return getBooleanObject(left != right)
-		case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-			if node.Operator != "+" {
-				return newError(fmt.Sprintf("unknown operator: %s %s %s", left.Type(), node.Operator, right.Type()), lexer.Line(), lexer.Column())
-			}
-			return &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}
-		case left.Type() != right.Type():
-			return newError(fmt.Sprintf("type mismatch: %s %s %s", left.Type(), node.Operator, right.Type()), lexer.Line(), lexer.Column())
-		}
+		return withPos(checkSize(InfixOperation(node.Operator, left, right), env.Runtime()), node)
 	case *ast.IfExpression:
-		condition := Eval(node.Condition, env, lexer)
+		condition := Eval(node.Condition, env)
 		if condition == nil {
 			return nil
 		}
-		if condition.String() == "true" {
-			return Eval(node.Consequence, env, lexer)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if IsTruthy(condition) {
+			return Eval(node.Consequence, env)
 		} else if node.Alternative != nil {
-			return Eval(node.Alternative, env, lexer)
+			return Eval(node.Alternative, env)
 		} else {
 			return NULL
 		}
 	case *ast.Function:
-		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+		return &object.Function{Name: node.Name, Parameters: node.Parameters, Body: node.Body, Env: env}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env, lexer)
-		if function.Type() == object.ERROR_OBJ {
+		function := Eval(node.Function, env)
+		if isAbrupt(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env, lexer)
-		if len(args) == 1 && args[0].Type() == object.ERROR_OBJ {
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args, lexer)
+		return applyFunction(function, args, node, env.Runtime())
 	case *ast.BlockStatement:
-		var result object.Object
+		var result object.Object = NULL
 		for _, statement := range node.Statements {
-			result = Eval(statement, env, lexer)
-			if result != nil {
-				rt := result.Type()
-				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-					return result
-				}
+			result = Eval(statement, env)
+			if isAbrupt(result) {
+				return result
 			}
 		}
 		return result
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env, lexer)
-		if len(elements) == 1 && elements[0].Type() == object.ERROR_OBJ {
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return withPos(checkSize(&object.Array{Elements: elements}, env.Runtime()), node)
+	case *ast.SliceExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		bounds := []object.Object{NULL, NULL}
+		for i, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				continue
+			}
+			if bounds[i] = Eval(bound, env); isAbrupt(bounds[i]) {
+				return bounds[i]
+			}
+		}
+		return withPos(SliceOperation(left, bounds[0], bounds[1]), node)
+	case *ast.InterpolatedString:
+		values := make([]object.Object, 0, len(node.Strings)+len(node.Values))
+		for i, value := range node.Values {
+			val := Eval(value, env)
+			if isAbrupt(val) {
+				return val
+			}
+			values = append(values, &object.String{Value: node.Strings[i].Value}, val)
+		}
+		values = append(values, &object.String{Value: node.Strings[len(node.Values)].Value})
+		return withPos(checkSize(Interpolate(values), env.Runtime()), node)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env, lexer)
-		if left.Type() == object.ERROR_OBJ {
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		index := Eval(node.Index, env, lexer)
-		if index.Type() == object.ERROR_OBJ {
+		index := Eval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
-		return evalIndexExpression(left, index, lexer)
-	case *ast.WhileStatement:
-		condition := Eval(node.Condition, env, lexer)
-		if condition == nil {
-			return nil
+		return withPos(IndexOperation(left, index), node)
+	case *ast.MemberExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
 		}
-		for condition.String() == "true" {
-			result := Eval(node.Body, env, lexer)
-			if result != nil {
-				rt := result.Type()
-				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-					return result
-				}
-			}
-			condition = Eval(node.Condition, env, lexer)
+		return withPos(IndexOperation(left, &object.String{Value: node.Member.Value}), node)
+	case *ast.WhileStatement:
+		for {
+			condition := Eval(node.Condition, env)
 			if condition == nil {
 				return nil
 			}
+			if isAbrupt(condition) {
+				return condition
+			}
+			if !IsTruthy(condition) {
+				break
+			}
+			result := Eval(node.Body, env)
+			if result == BREAK {
+				break
+			}
+			if result != CONTINUE && isAbrupt(result) {
+				return result
+			}
 		}
 		return EMPTY
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env, lexer)
+		return withPos(checkSize(evalHashLiteral(node, env), env.Runtime()), node)
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return withPos(ThrowError(val), node)
 	case *ast.ForStatement:
 		forLoopEnv := object.NewEnclosedEnvironment(env)
-		Eval(node.Initializer, forLoopEnv, lexer)
-		condition := Eval(node.Condition, forLoopEnv, lexer)
-		if condition == nil {
-			return nil
+		if init := Eval(node.Initializer, forLoopEnv); isAbrupt(init) {
+			return init
 		}
-		for condition.String() == "true" {
-			result :=
-				Eval(node.Body, forLoopEnv, lexer)
-			if result != nil {
-				rt := result.Type()
-				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-					return result
-				}
-			}
-			Eval(node.Incrementer, forLoopEnv, lexer)
-			condition = Eval(node.Condition, forLoopEnv, lexer)
+		for {
+			condition := Eval(node.Condition, forLoopEnv)
 			if condition == nil {
 				return nil
 			}
+			if isAbrupt(condition) {
+				return condition
+			}
+			if !IsTruthy(condition) {
+				break
+			}
+			result := Eval(node.Body, forLoopEnv)
+			if result == BREAK {
+				break
+			}
+			if result != CONTINUE && isAbrupt(result) {
+				return result
+			}
+			if incr := Eval(node.Incrementer, forLoopEnv); isAbrupt(incr) {
+				return incr
+			}
 		}
 		return EMPTY
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
 	case *ast.Program:
 		var result object.Object
 		for _, statement := range node.Statements {
-			result = Eval(statement, env, lexer)
+			result = Eval(statement, env)
 			switch result := result.(type) {
 			case *object.ReturnValue:
 				return result.Value
@@ -290,40 +340,43 @@ func Eval(node ast.Node, env *object.Environment, lexer lexer.Lexer) object.Obje
 		}
 		return result
 	}
-	return newError("unknown node type: "+node.String(), lexer.Line(), lexer.Column())
+	return newError(node, object.RuntimeError, "unknown node type: %s", node.String())
 }
 
-func newError(msg string, line int, column int) *object.Error {
-	return &object.Error{Message: msg + " - " + fmt.Sprintf("at line %d, column %d", line, column)}
+// newError returns an error of the given kind raised by node.
+func newError(node ast.Node, kind object.ErrorKind, format string, a ...any) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...), Pos: node.Pos(), End: node.End()}
 }
 
-func evalIntegerInfixOperation(operator string, l object.Object, r object.Object, lexer lexer.Lexer, env object.Environment) object.Object {
-	left := l.(*object.Integer).Value
-	right := r.(*object.Integer).Value
-	switch operator {
-	case "+":
-		return &object.Integer{Value: left + right}
-	case "-":
-		return &object.Integer{Value: left - right}
-	case "*":
-		return &object.Integer{Value: left * right}
-	case "/":
-		return &object.Integer{Value: left / right}
-	case "<":
-		return getBooleanObject(left < right)
-	case ">":
-		return getBooleanObject(left > right)
-	case "<=":
-		return getBooleanObject(left <= right)
-	case ">=":
-		return getBooleanObject(left >= right)
-	case "==":
-		return getBooleanObject(left == right)
-	case "!=":
-		return getBooleanObject(left != right)
-	default:
-		return newError(fmt.Sprintf("unknown operator: %s %s %s", l.Type(), operator, r.Type()), lexer.Line(), lexer.Column())
+// isAbrupt reports whether obj ends the block that produced it early: it is
+// a return value, an error, a break or a continue.
+func isAbrupt(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
 	}
+	return false
+}
+
+// checkSize returns obj, or a LimitError if it is larger than rt allows.
+func checkSize(obj object.Object, rt *object.Runtime) object.Object {
+	if err := rt.CheckSize(obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// withPos gives an error that was raised without knowing where it happened
+// the span of node, if there is one; other objects are returned unchanged.
+func withPos(obj object.Object, node ast.Node) object.Object {
+	if err, ok := obj.(*object.Error); ok && node != nil && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+		err.End = node.End()
+	}
+	return obj
 }
 
 func getBooleanObject(value bool) *object.Boolean {
@@ -333,14 +386,14 @@ func getBooleanObject(value bool) *object.Boolean {
 	return FALSE
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment, lexer lexer.Lexer) []object.Object {
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, e := range exps {
-		evaluated := Eval(e, env, lexer)
+		evaluated := Eval(e, env)
 		if evaluated == nil {
 			return nil
 		}
-		if evaluated.Type() == object.ERROR_OBJ {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -348,16 +401,48 @@ func evalExpressions(exps []ast.Expression, env *object.Environment, lexer lexer
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object, lexer lexer.Lexer) object.Object {
+// Apply calls fn with args for a host program rather than from a call
+// expression in Dot. Builtins get rt as their runtime.
+func Apply(fn object.Object, args []object.Object, rt *object.Runtime) object.Object {
+	return applyFunction(fn, args, nil, rt)
+}
+
+// applyFunction calls fn with args. call is the call expression, used for
+// errors that do not carry a position of their own and for the stack frame
+// added to errors raised inside fn; it is nil for calls made by the host.
+func applyFunction(fn object.Object, args []object.Object, call ast.Node, rt *object.Runtime) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) < len(fn.Parameters) {
+			return withPos(object.NewError(object.ArgumentError, "wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args)), call)
+		}
+		if err := rt.Enter(); err != nil {
+			return withPos(err, call)
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv, lexer)
+		evaluated := Eval(fn.Body, extendedEnv)
+		rt.Leave()
+		if err, ok := evaluated.(*object.Error); ok {
+			frame := object.StackFrame{Function: object.FunctionName(fn.Name)}
+			if call != nil {
+				frame.Pos = call.Pos()
+			}
+			err.PushFrame(frame)
+		}
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if err := rt.Permit(fn); err != nil {
+			return withPos(err, call)
+		}
+		// functions the builtin calls are called from where it was
+		previous := rt.SetCaller(func(fn object.Object, args []object.Object) object.Object {
+			return applyFunction(fn, args, call, rt)
+		})
+		result := fn.Fn(rt, args...)
+		rt.SetCaller(previous)
+		return withPos(checkSize(result, rt), call)
 	default:
-		return newError("not a function: "+string(fn.Type()), lexer.Line(), lexer.Column())
+		return withPos(object.NewError(object.TypeError, "not a function: %s", fn.Type()), call)
 	}
 }
 
@@ -375,57 +460,77 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalIndexExpression(left object.Object, index object.Object, lexer lexer.Lexer) object.Object {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index, lexer)
-	default:
-		return newError((fmt.Sprintf("index operator not supported: %s", left.Type())), lexer.Line(), lexer.Column())
+// evalTryStatement runs the try block, then the catch block if the try block
+// failed and finally the finally block. The finally block's own value is
+// dropped unless it ends early.
+func evalTryStatement(node *ast.TryStatement, env *object.Environment) object.Object {
+	result := Eval(node.Block, env)
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(node.Parameter.Value, CaughtValue(err))
+		result = Eval(node.Catch, catchEnv)
 	}
+	if node.Finally != nil {
+		final := Eval(node.Finally, env)
+		if isAbrupt(final) {
+			return final
+		}
+	}
+	return result
 }
 
-func evalArrayIndexExpression(array object.Object, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := float64(len(arrayObject.Elements) - 1)
-	if idx < 0 || idx > max {
-		return NULL
+// evalForInStatement runs the body of a for-in loop in a fresh scope for
+// every element, so that closures created in it keep their own copy of the
+// loop variables.
+func evalForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
 	}
-	return arrayObject.Elements[int(idx)]
+	iterator := Iterate(iterable)
+	it, ok := iterator.(*object.Iterator)
+	if !ok {
+		return withPos(iterator, node.Iterable)
+	}
+	for {
+		key, value, ok := it.Next()
+		if !ok {
+			break
+		}
+		loopEnv := object.NewEnclosedEnvironment(env)
+		if node.Key == nil {
+			loopEnv.Set(node.Value.Value, it.Single(key, value))
+		} else {
+			loopEnv.Set(node.Value.Value, value)
+			loopEnv.Set(node.Key.Value, key)
+		}
+		result := Eval(node.Body, loopEnv)
+		if result == BREAK {
+			break
+		}
+		if result != CONTINUE && isAbrupt(result) {
+			return result
+		}
+	}
+	return EMPTY
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment, lexer lexer.Lexer) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env, lexer)
-		if key.Type() == object.ERROR_OBJ {
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isAbrupt(key) {
 			return key
 		}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError(fmt.Sprintf("unusable as hash key: %s", key.Type()), lexer.Line(), lexer.Column())
+			return newError(pair.Key, object.TypeError, "unusable as hash key: %s", key.Type())
 		}
-		value := Eval(valueNode, env, lexer)
-		if value.Type() == object.ERROR_OBJ {
+		value := Eval(pair.Value, env)
+		if isAbrupt(value) {
 			return value
 		}
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
-	}
-	return &object.Hash{Pairs: pairs}
-}
-
-func evalHashIndexExpression(hash object.Object, index object.Object, lexer lexer.Lexer) object.Object {
-	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError(fmt.Sprintf("unusable as hash key: %s", index.Type()), lexer.Line(), lexer.Column())
-	}
-	pair, ok := hashObject.Pairs[key.HashKey()]
-	if !ok {
-		return NULL
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
 	}
-	return pair.Value
+	return hash
 }
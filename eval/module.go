@@ -0,0 +1,126 @@
+package eval
+
+import (
+	"dot/ast"
+	"dot/lexer"
+	"dot/object"
+	"dot/parser"
+	"dot/std"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveImport returns the absolute path of the file that an import of
+// path in the file from refers to. A relative path is relative to the
+// directory of from, or to the working directory if from is "". The path
+// of a module of the standard library is returned as it is.
+func ResolveImport(path string, from string) string {
+	if strings.HasPrefix(path, object.StdPrefix) {
+		return path
+	}
+	if !filepath.IsAbs(path) && from != "" {
+		path = filepath.Join(filepath.Dir(from), path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// ParseModule reads and parses the file at path, imported as name. A syntax
+// error in the file is returned as an ImportError at its position there.
+func ParseModule(name string, path string) (*ast.Program, *object.Error) {
+	src, err := readModule(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, object.NewError(object.ImportError, "cannot find module %q", name)
+	case err != nil:
+		return nil, object.NewError(object.ImportError, "cannot read module %q: %s", name, err)
+	}
+	p := parser.NewParser(lexer.NewFileLexer(DisplayPath(path), src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, &object.Error{Kind: object.ImportError, Message: "syntax error: " + errs[0].Msg, Pos: errs[0].Pos, End: errs[0].Pos}
+	}
+	return program, nil
+}
+
+// readModule returns the source of the module at path.
+func readModule(path string) (string, error) {
+	if name, ok := strings.CutPrefix(path, object.StdPrefix); ok {
+		src, ok := std.Source(name)
+		if !ok {
+			return "", fs.ErrNotExist
+		}
+		return src, nil
+	}
+	src, err := os.ReadFile(path)
+	return string(src), err
+}
+
+// DisplayPath returns path relative to the working directory if it is
+// inside it, for showing in errors and tracebacks. Modules of the standard
+// library are shown as the files they are bundled from.
+func DisplayPath(path string) string {
+	if strings.HasPrefix(path, object.StdPrefix) {
+		return path + ".dot"
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// ImportFailed returns err, raised while importing a module at the import
+// statement at node: an error raised inside the module gets a stack frame
+// for the import, and any other the position of node.
+func ImportFailed(err *object.Error, node ast.Node) *object.Error {
+	if !err.Pos.IsValid() {
+		return withPos(err, node).(*object.Error)
+	}
+	frame := object.StackFrame{Function: object.ModuleFunction, Pos: node.Pos()}
+	err.PushFrame(frame)
+	return err
+}
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	module := importModule(node, env.Runtime())
+	if err, ok := module.(*object.Error); ok {
+		return ImportFailed(err, node)
+	}
+	env.Set(node.Name.Value, module)
+	return module
+}
+
+// importModule returns the module node imports, running its file unless it
+// was imported before.
+func importModule(node *ast.ImportStatement, rt *object.Runtime) object.Object {
+	path := ResolveImport(node.Path.Value, node.Token.Pos.File)
+	if m, ok := rt.Imported(path); ok {
+		return m
+	}
+	if err := rt.BeginImport(path); err != nil {
+		return err
+	}
+	program, err := ParseModule(node.Path.Value, path)
+	if err != nil {
+		rt.EndImport(path, nil)
+		return err
+	}
+	env := ModuleEnvironment(rt, path)
+	if result, ok := Eval(program, env).(*object.Error); ok {
+		rt.EndImport(path, nil)
+		return result
+	}
+	m := &object.Module{Path: DisplayPath(path), Env: env, Exports: program.Exports()}
+	rt.EndImport(path, m)
+	return m
+}
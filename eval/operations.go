@@ -0,0 +1,542 @@
+package eval
+
+import (
+	"dot/object"
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// The operations in this file work on already evaluated operands and are
+// shared by the tree-walking evaluator and the bytecode virtual machine, so
+// both agree on what every operator means. Errors they return carry no
+// position; callers attach the position of the node or instruction that
+// triggered them.
+
+// LookupBuiltin returns the builtin function registered under name in rt,
+// or among the standard builtins if rt has no table of its own.
+func LookupBuiltin(rt *object.Runtime, name string) (*object.Builtin, bool) {
+	table := rt.Builtins
+	if table == nil {
+		table = builtins
+	}
+	fn, ok := table[name]
+	return fn, ok
+}
+
+// Builtins returns a new table of the standard builtin functions, for a
+// runtime whose builtins are changed by its host program.
+func Builtins() map[string]*object.Builtin {
+	table := make(map[string]*object.Builtin, len(builtins))
+	for name, fn := range builtins {
+		table[name] = fn
+	}
+	return table
+}
+
+// IsTruthy reports whether obj counts as true in a condition.
+func IsTruthy(obj object.Object) bool {
+	b, ok := obj.(*object.Boolean)
+	return ok && b.Value
+}
+
+// PrefixOperation applies a prefix operator ("!", "-" or "+") to right.
+func PrefixOperation(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		if right, ok := right.(*object.Boolean); ok {
+			return getBooleanObject(!right.Value)
+		}
+	case "-":
+		switch right := right.(type) {
+		case *object.Integer:
+			if right.IsBig() || right.Value == math.MinInt64 {
+				return object.NewBigInteger(new(big.Int).Neg(right.BigInt()))
+			}
+			return &object.Integer{Value: -right.Value}
+		case *object.Float:
+			return &object.Float{Value: -right.Value}
+		}
+	case "+":
+		switch right := right.(type) {
+		case *object.Integer:
+			return right
+		case *object.Float:
+			return &object.Float{Value: right.Value}
+		}
+	default:
+		return object.NewError(object.TypeError, "unknown operator: %s", operator)
+	}
+	return object.NewError(object.TypeError, "invalid operation: %s%s", operator, right.Type())
+}
+
+// InfixOperation applies a binary operator to left and right.
+func InfixOperation(operator string, left object.Object, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixOperation(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixOperation(operator, left, right)
+	case operator == "==":
+		return getBooleanObject(Equal(left, right))
+	case operator == "&&":
+		if left.Type() != object.BOOLEAN_OBJ || right.Type() != object.BOOLEAN_OBJ {
+			return object.NewError(object.TypeError, "invalid operation: %s %s %s", left.Type(), operator, right.Type())
+		}
+		return getBooleanObject(left.(*object.Boolean).Value && right.(*object.Boolean).Value)
+	case operator == "||":
+		if left.Type() != object.BOOLEAN_OBJ || right.Type() != object.BOOLEAN_OBJ {
+			return object.NewError(object.TypeError, "invalid operation: %s %s %s", left.Type(), operator, right.Type())
+		}
+		return getBooleanObject(left.(*object.Boolean).Value || right.(*object.Boolean).Value)
+	case operator == "!=":
+		return getBooleanObject(!Equal(left, right))
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		if operator != "+" {
+			return object.NewError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		}
+		return &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}
+	case left.Type() != right.Type():
+		return object.NewError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return object.NewError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// Equal reports whether a and b are equal for == and !=. Values of different
+// types are unequal, except numbers, which are equal if their values are.
+// Strings are equal if they hold the same text, arrays if their elements
+// are equal in order, hashes if they map the same keys to equal values in
+// any order and ranges if they count the same numbers. Functions, builtins
+// and other values are only equal to themselves.
+func Equal(a, b object.Object) bool {
+	return equal(a, b, make(map[[2]object.Object]bool))
+}
+
+// equal is Equal, with comparing holding the pairs of arrays and hashes
+// being compared. A pair met again inside itself is taken to be equal, so
+// that containers holding themselves compare without end only if some
+// other part of them differs.
+func equal(a, b object.Object, comparing map[[2]object.Object]bool) bool {
+	if isNumber(a) && isNumber(b) {
+		return InfixOperation("==", a, b) == TRUE
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a := a.(type) {
+	case *object.Null:
+		return true
+	case *object.Boolean:
+		return a.Value == b.(*object.Boolean).Value
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Range:
+		b := b.(*object.Range)
+		if a.Len() == 0 || b.Len() == 0 {
+			return a.Len() == b.Len()
+		}
+		return a.Len() == b.Len() && a.Start == b.Start && (a.Len() == 1 || a.Step == b.Step)
+	case *object.Array:
+		b := b.(*object.Array)
+		pair := [2]object.Object{a, b}
+		if a == b || comparing[pair] {
+			return true
+		}
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		b := b.(*object.Hash)
+		pair := [2]object.Object{a, b}
+		if a == b || comparing[pair] {
+			return true
+		}
+		if len(a.Keys) != len(b.Keys) {
+			return false
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for _, key := range a.Keys {
+			other, ok := b.Pairs[key]
+			if !ok || !equal(a.Pairs[key].Value, other.Value, comparing) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// evalIntegerInfixOperation applies an operator to two integers. Division
+// truncates towards zero, so that the result stays an integer. Results that
+// do not fit in 64 bits are computed with math/big instead.
+func evalIntegerInfixOperation(operator string, l object.Object, r object.Object) object.Object {
+	left := l.(*object.Integer)
+	right := r.(*object.Integer)
+	switch operator {
+	case "+", "-", "*", "/":
+		if operator == "/" && !right.IsBig() && right.Value == 0 {
+			return object.NewError(object.ZeroDivisionError, "division by zero")
+		}
+		if !left.IsBig() && !right.IsBig() {
+			if value, ok := int64Arithmetic(operator, left.Value, right.Value); ok {
+				return &object.Integer{Value: value}
+			}
+		}
+		return object.NewBigInteger(bigArithmetic(operator, left.BigInt(), right.BigInt()))
+	case "<", ">", "<=", ">=", "==", "!=":
+		return getBooleanObject(compare(operator, left.Cmp(right)))
+	default:
+		return object.NewError(object.TypeError, "unknown operator: %s %s %s", l.Type(), operator, r.Type())
+	}
+}
+
+// int64Arithmetic applies an arithmetic operator to a and b, or returns
+// false if the result overflows.
+func int64Arithmetic(operator string, a int64, b int64) (int64, bool) {
+	switch operator {
+	case "+":
+		c := a + b
+		return c, (c > a) == (b > 0)
+	case "-":
+		c := a - b
+		return c, (c < a) == (b > 0)
+	case "*":
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+		c := a * b
+		return c, c/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64)
+	default:
+		return a / b, !(a == math.MinInt64 && b == -1)
+	}
+}
+
+func bigArithmetic(operator string, a *big.Int, b *big.Int) *big.Int {
+	switch operator {
+	case "+":
+		return new(big.Int).Add(a, b)
+	case "-":
+		return new(big.Int).Sub(a, b)
+	case "*":
+		return new(big.Int).Mul(a, b)
+	default:
+		return new(big.Int).Quo(a, b)
+	}
+}
+
+// compare reports whether a comparison operator holds for two values that
+// compare as c, which is -1, 0 or +1.
+func compare(operator string, c int) bool {
+	switch operator {
+	case "<":
+		return c < 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	case ">=":
+		return c >= 0
+	case "==":
+		return c == 0
+	default:
+		return c != 0
+	}
+}
+
+// evalFloatInfixOperation applies an operator to two numbers of which at
+// least one is a float. Arithmetic converts the other one to a float, while
+// comparisons compare the exact values, so that an integer too large for a
+// float to hold does not equal the float nearest to it.
+func evalFloatInfixOperation(operator string, l object.Object, r object.Object) object.Object {
+	left := toFloat(l)
+	right := toFloat(r)
+	switch operator {
+	case "+":
+		return &object.Float{Value: left + right}
+	case "-":
+		return &object.Float{Value: left - right}
+	case "*":
+		return &object.Float{Value: left * right}
+	case "/":
+		if right == 0 {
+			return object.NewError(object.ZeroDivisionError, "division by zero")
+		}
+		return &object.Float{Value: left / right}
+	case "<", ">", "<=", ">=", "==", "!=":
+		if math.IsNaN(left) || math.IsNaN(right) {
+			// NaN is neither less than, greater than nor equal to anything
+			return getBooleanObject(operator == "!=")
+		}
+		return getBooleanObject(compare(operator, exactFloat(l).Cmp(exactFloat(r))))
+	default:
+		return object.NewError(object.TypeError, "unknown operator: %s %s %s", l.Type(), operator, r.Type())
+	}
+}
+
+// exactFloat returns the value of an integer or a float, other than NaN,
+// as a big.Float holding it exactly.
+func exactFloat(obj object.Object) *big.Float {
+	if i, ok := obj.(*object.Integer); ok {
+		return new(big.Float).SetInt(i.BigInt())
+	}
+	return big.NewFloat(obj.(*object.Float).Value)
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat returns the value of an integer or a float as a float.
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return i.Float()
+	}
+	return obj.(*object.Float).Value
+}
+
+// IndexOperation evaluates left[index].
+func IndexOperation(left object.Object, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		m := left.(*object.Module)
+		name := index.(*object.String).Value
+		if val, ok := m.Get(name); ok {
+			return val
+		}
+		return object.NewError(object.NameError, "module %s has no export %s", m.Path, name)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		r := left.(*object.Range)
+		idx := index.(*object.Integer)
+		if idx.IsBig() || idx.Value < 0 || idx.Value >= r.Len() {
+			return NULL
+		}
+		return &object.Integer{Value: r.At(idx.Value)}
+	default:
+		return object.NewError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+func evalArrayIndexExpression(array object.Object, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	i, ok := elementIndex(index.(*object.Integer), len(arrayObject.Elements))
+	if !ok {
+		return NULL
+	}
+	return arrayObject.Elements[i]
+}
+
+// elementIndex returns the index of the element that i stands for in a
+// value of length n, counting a negative i from the end like the bounds of
+// slices, and false if there is no such element.
+func elementIndex(i *object.Integer, n int) (int, bool) {
+	if i.IsBig() {
+		return 0, false
+	}
+	v := i.Value
+	if v < 0 {
+		v += int64(n)
+	}
+	if v < 0 || v >= int64(n) {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// evalStringIndexExpression returns the character of str at index, which
+// counts characters rather than bytes.
+func evalStringIndexExpression(str object.Object, index object.Object) object.Object {
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return object.NewError(object.TypeError, "string index must be INTEGER, got %s", index.Type())
+	}
+	value := str.(*object.String).Value
+	n := len(value)
+	if idx.Value < 0 {
+		// counting from the end needs the number of characters
+		n = utf8.RuneCountInString(value)
+	}
+	i, ok := elementIndex(idx, n)
+	if !ok {
+		return NULL
+	}
+	for _, ch := range value {
+		if i == 0 {
+			return &object.String{Value: string(ch)}
+		}
+		i--
+	}
+	return NULL
+}
+
+func evalHashIndexExpression(hash object.Object, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return object.NewError(object.TypeError, "unusable as hash key: %s", index.Type())
+	}
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+	return pair.Value
+}
+
+// Interpolate returns the string an interpolated string evaluates to, given
+// the values of its parts in order: the text of each value, as String
+// gives it, joined together.
+func Interpolate(values []object.Object) *object.String {
+	var out strings.Builder
+	for _, value := range values {
+		out.WriteString(value.String())
+	}
+	return &object.String{Value: out.String()}
+}
+
+// SliceOperation evaluates left[low:high], where low and high are NULL if
+// they were left out. Bounds count from the end if they are negative and
+// are clamped to the length of left, an array or a string, whose
+// characters are counted rather than its bytes.
+func SliceOperation(left object.Object, low object.Object, high object.Object) object.Object {
+	var runes []rune
+	var n int
+	switch left := left.(type) {
+	case *object.Array:
+		n = len(left.Elements)
+	case *object.String:
+		runes = []rune(left.Value)
+		n = len(runes)
+	default:
+		return object.NewError(object.TypeError, "slice operator not supported: %s", left.Type())
+	}
+	start, err := sliceBound(low, 0, n)
+	if err != nil {
+		return err
+	}
+	end, err := sliceBound(high, n, n)
+	if err != nil {
+		return err
+	}
+	start = min(start, end)
+	if arr, ok := left.(*object.Array); ok {
+		return &object.Array{Elements: append([]object.Object{}, arr.Elements[start:end]...)}
+	}
+	return &object.String{Value: string(runes[start:end])}
+}
+
+// sliceBound returns the index that bound, a bound of a slice of a value of
+// length n, stands for, or def if it is NULL.
+func sliceBound(bound object.Object, def int, n int) (int, *object.Error) {
+	if bound == NULL {
+		return def, nil
+	}
+	i, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, object.NewError(object.TypeError, "slice index must be INTEGER, got %s", bound.Type())
+	}
+	return clampIndex(i, n), nil
+}
+
+// clampIndex returns i as an index between 0 and n, counting a negative i
+// from the end.
+func clampIndex(i *object.Integer, n int) int {
+	v := i.Float()
+	if v < 0 {
+		v += float64(n)
+	}
+	return int(math.Max(0, math.Min(v, float64(n))))
+}
+
+// Iterate returns the iterator a for-in loop over obj steps through.
+func Iterate(obj object.Object) object.Object {
+	it, ok := object.Iterate(obj)
+	if !ok {
+		return object.NewError(object.TypeError, "cannot iterate over %s", obj.Type())
+	}
+	return it
+}
+
+// SetIndex evaluates container[index] = val and returns val.
+func SetIndex(container object.Object, index object.Object, val object.Object) object.Object {
+	switch container := container.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return object.NewError(object.TypeError, "array index must be INTEGER, got %s", index.Type())
+		}
+		i, ok := elementIndex(idx, len(container.Elements))
+		if !ok {
+			return object.NewError(object.IndexError, "index out of range")
+		}
+		container.Elements[i] = val
+		return val
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return object.NewError(object.TypeError, "unusable as hash key: %s", index.Type())
+		}
+		container.Set(key.HashKey(), object.HashPair{Key: index, Value: val})
+		return val
+	case *object.Module:
+		return object.NewError(object.TypeError, "cannot assign to an export of module %s", container.Path)
+	default:
+		return object.NewError(object.TypeError, "index assignment not supported: %s", container.Type())
+	}
+}
+
+// ThrowError returns the error raised by throwing val. A hash can set the
+// "kind" and "message" of the error; any other value becomes its message.
+func ThrowError(val object.Object) *object.Error {
+	err := object.NewError(object.UserError, "%s", val.String())
+	if hash, ok := val.(*object.Hash); ok {
+		if kind, ok := hashString(hash, "kind"); ok {
+			err.Kind = object.ErrorKind(kind)
+		}
+		if message, ok := hashString(hash, "message"); ok {
+			err.Message = message
+		}
+	}
+	return err
+}
+
+// CaughtValue returns the value a catch block binds for err: a hash with
+// its kind, message, line and column.
+func CaughtValue(err *object.Error) object.Object {
+	hash := object.NewHash()
+	set := func(key string, value object.Object) {
+		k := &object.String{Value: key}
+		hash.Set(k.HashKey(), object.HashPair{Key: k, Value: value})
+	}
+	set("kind", &object.String{Value: string(err.Kind)})
+	set("message", &object.String{Value: err.Message})
+	set("line", &object.Integer{Value: int64(err.Pos.Line)})
+	set("column", &object.Integer{Value: int64(err.Pos.Column)})
+	return hash
+}
+
+func hashString(hash *object.Hash, key string) (string, bool) {
+	pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+	if !ok {
+		return "", false
+	}
+	s, ok := pair.Value.(*object.String)
+	if !ok {
+		return "", false
+	}
+	return s.Value, true
+}
@@ -0,0 +1,170 @@
+package eval
+
+import (
+	"dot/object"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// maxPowBits bounds the number of bits of the integers `pow` computes, a
+// megabyte of them, whatever the limits of the runtime.
+const maxPowBits = 8 << 20
+
+// natives holds the Go functions and values given to the modules of the
+// standard library as the hash native, by module name.
+var natives = map[string]map[string]object.Object{
+	"strings": {
+		"words": object.NewBuiltin("words", func(rt *object.Runtime, args ...object.Object) object.Object {
+			return stringArray(strings.Fields(args[0].(*object.String).Value))
+		}, object.STRING_OBJ),
+	},
+	"arrays": {
+		"append": object.NewBuiltin("append", func(rt *object.Runtime, args ...object.Object) object.Object {
+			arr := args[0].(*object.Array)
+			arr.Elements = append(arr.Elements, args[1])
+			return arr
+		}, object.ARRAY_OBJ, object.ANY_OBJ),
+		"concat": object.NewBuiltin("concat", func(rt *object.Runtime, args ...object.Object) object.Object {
+			a, b := args[0].(*object.Array).Elements, args[1].(*object.Array).Elements
+			elements := make([]object.Object, 0, len(a)+len(b))
+			return &object.Array{Elements: append(append(elements, a...), b...)}
+		}, object.ARRAY_OBJ, object.ARRAY_OBJ),
+		"flatten": object.NewBuiltin("flatten", func(rt *object.Runtime, args ...object.Object) object.Object {
+			var elements []object.Object
+			for _, el := range args[0].(*object.Array).Elements {
+				if arr, ok := el.(*object.Array); ok {
+					elements = append(elements, arr.Elements...)
+				} else {
+					elements = append(elements, el)
+				}
+			}
+			return &object.Array{Elements: elements}
+		}, object.ARRAY_OBJ),
+		"reverse": object.NewBuiltin("reverse", func(rt *object.Runtime, args ...object.Object) object.Object {
+			elements := args[0].(*object.Array).Elements
+			reversed := make([]object.Object, len(elements))
+			for i, el := range elements {
+				reversed[len(elements)-1-i] = el
+			}
+			return &object.Array{Elements: reversed}
+		}, object.ARRAY_OBJ),
+		"slice": object.NewBuiltin("slice", func(rt *object.Runtime, args ...object.Object) object.Object {
+			return SliceOperation(args[0], args[1], args[2])
+		}, object.ARRAY_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ),
+	},
+	"math": {
+		"pi":    &object.Float{Value: math.Pi},
+		"e":     &object.Float{Value: math.E},
+		"sqrt":  mathFunc("sqrt", math.Sqrt),
+		"sin":   mathFunc("sin", math.Sin),
+		"cos":   mathFunc("cos", math.Cos),
+		"tan":   mathFunc("tan", math.Tan),
+		"exp":   mathFunc("exp", math.Exp),
+		"log":   mathFunc("log", math.Log),
+		"floor": roundFunc("floor", math.Floor),
+		"ceil":  roundFunc("ceil", math.Ceil),
+		"round": roundFunc("round", math.Round),
+		"pow": &object.Builtin{Name: "pow", Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+			if err := object.CheckArity(args, 2, 2); err != nil {
+				return err
+			}
+			for _, arg := range args {
+				if err := object.CheckType("pow", arg, object.INTEGER_OBJ, object.FLOAT_OBJ); err != nil {
+					return err
+				}
+			}
+			base, baseInt := args[0].(*object.Integer)
+			exp, expInt := args[1].(*object.Integer)
+			if baseInt && expInt && exp.BigInt().Sign() >= 0 {
+				if exp.IsBig() {
+					return object.NewError(object.ValueError, "exponent of `pow` too large: %s", exp.String())
+				}
+				// the result has at least exp times as many bits as base
+				// beyond the first, so refuse it before computing it
+				extra := int64(base.BigInt().BitLen() - 1)
+				if extra > 0 && exp.Value > maxPowBits/extra {
+					return object.NewError(object.ValueError, "result of `pow` too large")
+				}
+				if err := rt.CheckLength(object.INTEGER_OBJ, int((extra*exp.Value+1+7)/8)); err != nil {
+					return err
+				}
+				result := object.NewBigInteger(new(big.Int).Exp(base.BigInt(), exp.BigInt(), nil))
+				if err := rt.CheckSize(result); err != nil {
+					return err
+				}
+				return result
+			}
+			return &object.Float{Value: math.Pow(toFloat(args[0]), toFloat(args[1]))}
+		}},
+	},
+}
+
+func init() {
+	for _, module := range natives {
+		for name, native := range module {
+			if fn, ok := native.(*object.Builtin); ok {
+				fn.Name = name
+			}
+		}
+	}
+}
+
+// ModuleEnvironment returns the environment that the module at path is run
+// in. A module of the standard library finds its Go functions in the hash
+// native.
+func ModuleEnvironment(rt *object.Runtime, path string) *object.Environment {
+	env := object.NewRuntimeEnvironment(rt)
+	name, ok := strings.CutPrefix(path, object.StdPrefix)
+	if !ok || natives[name] == nil {
+		return env
+	}
+	keys := make([]string, 0, len(natives[name]))
+	for key := range natives[name] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := object.NewHash()
+	for _, key := range keys {
+		k := &object.String{Value: key}
+		hash.Set(k.HashKey(), object.HashPair{Key: k, Value: natives[name][key]})
+	}
+	env.Set("native", hash)
+	return env
+}
+
+// mathFunc returns a builtin applying f to a number, which fails with a
+// ValueError where f is undefined.
+func mathFunc(name string, f func(float64) float64) *object.Builtin {
+	return &object.Builtin{Name: name, Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+		if err := object.CheckArity(args, 1, 1); err != nil {
+			return err
+		}
+		if err := object.CheckType(name, args[0], object.INTEGER_OBJ, object.FLOAT_OBJ); err != nil {
+			return err
+		}
+		x := toFloat(args[0])
+		if y := f(x); !math.IsNaN(y) || math.IsNaN(x) {
+			return &object.Float{Value: y}
+		}
+		return object.NewError(object.ValueError, "`%s` is undefined for %s", name, args[0].String())
+	}}
+}
+
+// roundFunc returns a builtin rounding a number to an integer with f.
+func roundFunc(name string, f func(float64) float64) *object.Builtin {
+	return &object.Builtin{Name: name, Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+		if err := object.CheckArity(args, 1, 1); err != nil {
+			return err
+		}
+		switch arg := args[0].(type) {
+		case *object.Integer:
+			return arg
+		case *object.Float:
+			return floatToInteger(&object.Float{Value: f(arg.Value)})
+		default:
+			return object.CheckType(name, arg, object.INTEGER_OBJ, object.FLOAT_OBJ)
+		}
+	}}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"dot/parser"
+	"dot/printer"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// format runs dot fmt with the arguments after the subcommand. It rewrites
+// the files named by paths, and the .dot files in the directories among
+// them, formatted. With -check it lists the files that are not formatted
+// instead and fails if there are any.
+func (c *cli) format(args []string) int {
+	flags := flag.NewFlagSet("dot fmt", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: dot fmt [-check] [path...]\n\nWith no paths, dot fmt formats stdin to stdout.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	check := flags.Bool("check", false, "list the files that are not formatted and exit with status 1 if there are any, instead of rewriting them")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	paths := flags.Args()
+	if len(paths) == 0 || len(paths) == 1 && paths[0] == "-" {
+		return c.formatStdin(*check)
+	}
+
+	if !c.eachFile(paths, func(file string) bool { return c.formatFile(file, *check) }) {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// formatFile formats file in place, or lists it if check is set and it is
+// not formatted. It returns false if the file did not parse, could not be
+// rewritten or, with check, is not formatted.
+func (c *cli) formatFile(file string, check bool) bool {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return false
+	}
+	out, ok := c.formatSource(file, src)
+	if !ok || bytes.Equal(src, out) {
+		return ok
+	}
+	if check {
+		fmt.Fprintln(c.stdout, file)
+		return false
+	}
+	info, err := os.Stat(file)
+	if err == nil {
+		err = os.WriteFile(file, out, info.Mode().Perm())
+	}
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return false
+	}
+	return true
+}
+
+func (c *cli) formatStdin(check bool) int {
+	src, err := io.ReadAll(c.stdin)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+	out, ok := c.formatSource("<stdin>", src)
+	switch {
+	case !ok:
+		return exitFailure
+	case !check:
+		c.stdout.Write(out)
+	case !bytes.Equal(src, out):
+		fmt.Fprintln(c.stdout, "<stdin>")
+		return exitFailure
+	}
+	return exitOK
+}
+
+// formatSource returns src, read from the file called name, formatted. It
+// reports the syntax errors of src if it does not parse.
+func (c *cli) formatSource(name string, src []byte) ([]byte, bool) {
+	out, err := printer.Format(name, src)
+	var errs parser.ErrorList
+	if errors.As(err, &errs) {
+		for _, err := range errs {
+			fmt.Fprintf(c.stderr, "%s: %s\n", name, err)
+		}
+		return nil, false
+	}
+	if err != nil {
+		fmt.Fprintf(c.stderr, "%s: %s\n", name, err)
+		return nil, false
+	}
+	return out, true
+}
@@ -0,0 +1,153 @@
+package interp
+
+import (
+	"dot/eval"
+	"dot/object"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// ToObject converts a Go value to the Dot value it stands for:
+//
+//   - nil becomes null
+//   - bools, strings and *big.Int become booleans, strings and integers
+//   - signed and unsigned integers of any size become integers
+//   - float32 and float64 become floats
+//   - slices and arrays become arrays, converting every element
+//   - maps with string keys become hashes, in sorted key order
+//   - an object.Object is returned unchanged
+//
+// Any other value is an error.
+func ToObject(v any) (object.Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return eval.NULL, nil
+	case object.Object:
+		return v, nil
+	case bool:
+		if v {
+			return eval.TRUE, nil
+		}
+		return eval.FALSE, nil
+	case string:
+		return &object.String{Value: v}, nil
+	case *big.Int:
+		return object.NewBigInteger(new(big.Int).Set(v)), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u > math.MaxInt64 {
+			return object.NewBigInteger(new(big.Int).SetUint64(u)), nil
+		}
+		return &object.Integer{Value: int64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: rv.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: rv.String()}, nil
+	case reflect.Bool:
+		return ToObject(rv.Bool())
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, rv.Len())
+		for i := range elements {
+			el, err := ToObject(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		hash := object.NewHash()
+		for _, key := range keys {
+			value, err := ToObject(rv.MapIndex(key).Interface())
+			if err != nil {
+				return nil, err
+			}
+			k := &object.String{Value: key.String()}
+			hash.Set(k.HashKey(), object.HashPair{Key: k, Value: value})
+		}
+		return hash, nil
+	}
+	return nil, fmt.Errorf("interp: cannot convert %T to a Dot value", v)
+}
+
+// FromObject converts a Dot value to Go:
+//
+//   - null becomes nil
+//   - booleans, strings and floats become bool, string and float64
+//   - integers become int, or *big.Int if they do not fit in one
+//   - arrays become []any
+//   - hashes become map[string]any, keyed by the text of each key
+//   - anything else, such as a function, is returned as an object.Object
+//
+// An array or hash that contains itself has no Go counterpart and is an
+// error.
+func FromObject(obj object.Object) (any, error) {
+	return fromObject(obj, make(map[object.Object]bool))
+}
+
+// fromObject is FromObject, with converting holding the arrays and hashes
+// that obj is inside of.
+func fromObject(obj object.Object, converting map[object.Object]bool) (any, error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.Integer:
+		if obj.IsBig() || obj.Value < math.MinInt || obj.Value > math.MaxInt {
+			return new(big.Int).Set(obj.BigInt()), nil
+		}
+		return int(obj.Value), nil
+	case *object.Array:
+		if converting[obj] {
+			return nil, errors.New("interp: cannot convert an ARRAY that contains itself")
+		}
+		converting[obj] = true
+		defer delete(converting, obj)
+		elements := make([]any, len(obj.Elements))
+		for i, el := range obj.Elements {
+			v, err := fromObject(el, converting)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = v
+		}
+		return elements, nil
+	case *object.Hash:
+		if converting[obj] {
+			return nil, errors.New("interp: cannot convert a HASH that contains itself")
+		}
+		converting[obj] = true
+		defer delete(converting, obj)
+		m := make(map[string]any, len(obj.Keys))
+		for _, key := range obj.Keys {
+			pair := obj.Pairs[key]
+			v, err := fromObject(pair.Value, converting)
+			if err != nil {
+				return nil, err
+			}
+			m[pair.Key.String()] = v
+		}
+		return m, nil
+	default:
+		return obj, nil
+	}
+}
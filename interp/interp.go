@@ -0,0 +1,304 @@
+// Package interp embeds the Dot interpreter in Go programs. An Interpreter
+// keeps its global variables between runs, so a host can load a script,
+// read and set its variables and call its functions:
+//
+//	in := interp.New(interp.WithStdout(&buf))
+//	if _, err := in.Run(`let greet = fn(name) { "hello " + name }`); err != nil {
+//		return err
+//	}
+//	greeting, err := in.Call("greet", "world") // "hello world"
+//
+// Values cross between Go and Dot as described by ToObject and FromObject.
+package interp
+
+import (
+	"bufio"
+	"context"
+	"dot/ast"
+	"dot/compiler"
+	"dot/eval"
+	"dot/lexer"
+	"dot/object"
+	"dot/parser"
+	"dot/vm"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Interpreter runs Dot programs in a global environment shared by all of
+// them. It is not safe for concurrent use.
+type Interpreter struct {
+	runtime *object.Runtime
+	env     *object.Environment
+
+	useVM bool
+	// comp is the compiler of the last program run on the virtual machine,
+	// whose constant pool the functions defined so far refer to
+	comp *compiler.Compiler
+}
+
+// ExitError is the error of a run that ended by calling exit, holding the
+// status passed to it.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithStdout sets where print writes to. The default is os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) { in.runtime.Stdout = w }
+}
+
+// WithStderr sets where diagnostics go. The default is os.Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(in *Interpreter) { in.runtime.Stderr = w }
+}
+
+// WithStdin sets where ask reads from. The default is os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(in *Interpreter) { in.runtime.Stdin = bufio.NewReader(r) }
+}
+
+// WithLimits bounds the steps, call depth, time and memory each run of a
+// program may use. A run that exceeds a limit fails with an *object.Error of
+// kind object.LimitError.
+func WithLimits(limits object.Limits) Option {
+	return func(in *Interpreter) { in.runtime.Limits = limits }
+}
+
+// WithCapabilities allows programs to use only the builtins needing the
+// given capabilities, and those needing none. By default every capability
+// is allowed.
+func WithCapabilities(caps ...object.Capability) Option {
+	return func(in *Interpreter) {
+		in.runtime.Denied = make(map[object.Capability]bool)
+		for _, c := range object.Capabilities {
+			in.runtime.Denied[c] = true
+		}
+		for _, c := range caps {
+			delete(in.runtime.Denied, c)
+		}
+	}
+}
+
+// WithoutCapabilities denies programs the builtins needing any of the
+// given capabilities. Calling one fails with a PermissionError.
+func WithoutCapabilities(caps ...object.Capability) Option {
+	return func(in *Interpreter) {
+		if in.runtime.Denied == nil {
+			in.runtime.Denied = make(map[object.Capability]bool)
+		}
+		for _, c := range caps {
+			in.runtime.Denied[c] = true
+		}
+	}
+}
+
+// WithVM runs programs on the bytecode virtual machine instead of the
+// tree-walking evaluator.
+func WithVM() Option {
+	return func(in *Interpreter) { in.useVM = true }
+}
+
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{runtime: object.NewRuntime()}
+	in.runtime.Builtins = eval.Builtins()
+	for _, opt := range opts {
+		opt(in)
+	}
+	in.env = object.NewRuntimeEnvironment(in.runtime)
+	in.comp = compiler.New()
+	return in
+}
+
+// Run runs src and returns the value of its last statement, converted with
+// FromObject. The error is a parser.ErrorList if src does not parse, an
+// *ExitError if it calls exit, an *object.Error if it fails at runtime and
+// the error of FromObject if its value cannot be converted.
+func (in *Interpreter) Run(src string) (any, error) {
+	return in.RunContext(context.Background(), src)
+}
+
+// RunContext runs src like Run, stopping it with a LimitError once ctx is
+// done.
+func (in *Interpreter) RunContext(ctx context.Context, src string) (any, error) {
+	return in.run(ctx, lexer.NewLexer(src))
+}
+
+// RunFile runs the program in the file at path like Run, with errors
+// reporting positions in that file.
+func (in *Interpreter) RunFile(path string) (any, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return in.run(context.Background(), lexer.NewFileLexer(path, string(src)))
+}
+
+func (in *Interpreter) run(ctx context.Context, l *lexer.Lexer) (any, error) {
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	if err := p.Errors().Err(); err != nil {
+		return nil, err
+	}
+	result, err := in.eval(ctx, program)
+	if err != nil {
+		return nil, err
+	}
+	return FromObject(result)
+}
+
+// Eval runs an already parsed program and returns its value as a Dot
+// object.
+func (in *Interpreter) Eval(program *ast.Program) (object.Object, error) {
+	return in.eval(context.Background(), program)
+}
+
+func (in *Interpreter) eval(ctx context.Context, program *ast.Program) (object.Object, error) {
+	in.runtime.Start(ctx)
+	var result object.Object
+	if in.useVM {
+		comp := compiler.NewWithState(in.comp)
+		if err := comp.Compile(program); err != nil {
+			return nil, err
+		}
+		in.comp = comp
+		result = vm.New(comp.Bytecode(), in.env).Run()
+	} else {
+		result = eval.Eval(program, in.env)
+	}
+	if err := in.failure(result); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return eval.NULL, nil
+	}
+	return result, nil
+}
+
+// failure returns the error a run with result ended with: an *ExitError if
+// the program called exit, even if it went on to catch the error, or the
+// *object.Error result if it failed.
+func (in *Interpreter) failure(result object.Object) error {
+	if code, ok := in.runtime.Exited(); ok {
+		return &ExitError{Code: code}
+	}
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	return nil
+}
+
+// Call calls the function bound to name, a global variable or a builtin,
+// with args converted by ToObject, and returns its result converted by
+// FromObject.
+func (in *Interpreter) Call(name string, args ...any) (any, error) {
+	return in.CallContext(context.Background(), name, args...)
+}
+
+// CallContext calls a function like Call, stopping it with a LimitError
+// once ctx is done.
+func (in *Interpreter) CallContext(ctx context.Context, name string, args ...any) (any, error) {
+	fn, ok := in.env.Get(name)
+	if !ok {
+		fn, ok = eval.LookupBuiltin(in.runtime, name)
+	}
+	if !ok {
+		return nil, fmt.Errorf("interp: %s is not defined", name)
+	}
+	objects := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = obj
+	}
+	in.runtime.Start(ctx)
+	var result object.Object
+	if in.useVM {
+		result = vm.Call(in.comp.Bytecode().Constants, in.env, fn, objects)
+	} else {
+		result = eval.Apply(fn, objects, in.runtime)
+	}
+	if err := in.failure(result); err != nil {
+		return nil, err
+	}
+	return FromObject(result)
+}
+
+// Register makes fn a builtin function called name in the programs this
+// interpreter runs, replacing any builtin of that name. Like the standard
+// builtins, it is shadowed by variables of the same name, and it is denied
+// along with its Capability, if it has one.
+// object.NewBuiltin makes builtins that check the types of their arguments:
+//
+//	in.Register("repeat", object.NewBuiltin("repeat", func(rt *object.Runtime, args ...object.Object) object.Object {
+//		s, n := args[0].(*object.String), args[1].(*object.Integer)
+//		return &object.String{Value: strings.Repeat(s.Value, int(n.Value))}
+//	}, object.STRING_OBJ, object.INTEGER_OBJ))
+func (in *Interpreter) Register(name string, fn *object.Builtin) {
+	if fn.Name == "" {
+		fn.Name = name
+	}
+	in.runtime.Builtins[name] = fn
+}
+
+// Unregister removes the builtin function called name, standard or not,
+// from this interpreter.
+func (in *Interpreter) Unregister(name string) {
+	delete(in.runtime.Builtins, name)
+}
+
+// Get returns the value of the global variable name converted by
+// FromObject. It fails if name is not defined or its value cannot be
+// converted; Lookup returns any value as a Dot object.
+func (in *Interpreter) Get(name string) (any, error) {
+	obj, ok := in.env.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("interp: %s is not defined", name)
+	}
+	return FromObject(obj)
+}
+
+// Lookup returns the value of the global variable name as a Dot object,
+// and whether it is defined.
+func (in *Interpreter) Lookup(name string) (object.Object, bool) {
+	return in.env.Get(name)
+}
+
+// Globals returns the names of the global variables in sorted order.
+func (in *Interpreter) Globals() []string {
+	names := in.env.Names()
+	sort.Strings(names)
+	return names
+}
+
+// Builtins returns the names of the builtin functions of this interpreter
+// in sorted order.
+func (in *Interpreter) Builtins() []string {
+	names := make([]string, 0, len(in.runtime.Builtins))
+	for name := range in.runtime.Builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set defines the global variable name with value converted by ToObject.
+func (in *Interpreter) Set(name string, value any) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+	in.env.Set(name, obj)
+	return nil
+}
@@ -0,0 +1,450 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"dot/object"
+	"dot/parser"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// engines runs a test on both the evaluator and the virtual machine.
+var engines = map[string][]Option{
+	"eval": nil,
+	"vm":   {WithVM()},
+}
+
+func TestRunAndCall(t *testing.T) {
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			in := New(opts...)
+			if _, err := in.Run(`let scale = 2
+let apply = fn(xs, f) {
+  let out = []
+  for (x in xs) { out = push(out, f(x) * scale) }
+  out
+}`); err != nil {
+				t.Fatalf("Run failed: %s", err)
+			}
+			// a later run sees the functions and variables of earlier ones
+			if _, err := in.Run(`let inc = fn(x) { x + 1 }`); err != nil {
+				t.Fatalf("Run failed: %s", err)
+			}
+			got, err := in.Call("apply", []int{1, 2, 3}, mustGet(t, in, "inc"))
+			if err != nil {
+				t.Fatalf("Call failed: %s", err)
+			}
+			if want := []any{4, 6, 8}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Call returned %#v, want %#v", got, want)
+			}
+
+			if err := in.Set("scale", 10); err != nil {
+				t.Fatalf("Set failed: %s", err)
+			}
+			got, err = in.Run(`apply([1], inc)[0]`)
+			if err != nil || got != 20 {
+				t.Errorf("Run after Set returned %#v, %v, want 20", got, err)
+			}
+
+			got, err = in.Call("len", "abc")
+			if err != nil || got != 3 {
+				t.Errorf("Call of a builtin returned %#v, %v, want 3", got, err)
+			}
+			if _, err := in.Call("missing"); err == nil {
+				t.Errorf("Call of an undefined function succeeded")
+			}
+		})
+	}
+}
+
+func mustGet(t *testing.T, in *Interpreter, name string) any {
+	t.Helper()
+	v, err := in.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestErrors(t *testing.T) {
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			in := New(opts...)
+			_, err := in.Run("let x = ;")
+			var syntaxErr parser.ErrorList
+			if !errors.As(err, &syntaxErr) {
+				t.Errorf("syntax error is %T, want parser.ErrorList", err)
+			}
+
+			if _, err := in.Run(`let fail = fn(n) { n + "a" }`); err != nil {
+				t.Fatalf("Run failed: %s", err)
+			}
+			_, err = in.Call("fail", 1)
+			var runtimeErr *object.Error
+			if !errors.As(err, &runtimeErr) {
+				t.Fatalf("runtime error is %T, want *object.Error", err)
+			}
+			if runtimeErr.Kind != object.TypeError {
+				t.Errorf("error kind is %s, want TypeError", runtimeErr.Kind)
+			}
+			want := "Traceback (most recent call last):\n  at line 1, column 20, in fail\nTypeError: type mismatch: INTEGER + STRING"
+			if runtimeErr.Traceback() != want {
+				t.Errorf("wrong traceback.\nwant:\n%s\ngot:\n%s", want, runtimeErr.Traceback())
+			}
+			_, err = in.Call("fail")
+			if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.ArgumentError {
+				t.Errorf("calling with too few arguments gave %v, want an ArgumentError", err)
+			}
+		})
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.dot")
+	if err := os.WriteFile(path, []byte("let x = 1\nx + true"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := New().RunFile(path)
+	if err == nil || !strings.Contains(err.(*object.Error).Traceback(), "script.dot, line 2, column 1") {
+		t.Errorf("RunFile error does not name the file: %v", err)
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.dot":  "export let greet = fn(name) { \"hello \" + name }",
+		"main.dot": "import \"lib.dot\" as lib\nlib.greet(\"Ada\")",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := filepath.Join(dir, "main.dot")
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			if got, err := New(opts...).RunFile(main); err != nil || got != "hello Ada" {
+				t.Errorf("RunFile returned %#v, %v", got, err)
+			}
+			in := New(append([]Option{WithoutCapabilities(object.CapFS)}, opts...)...)
+			want := "PermissionError: import needs the fs capability, which is denied - at line 1, column 1"
+			if _, err := in.RunFile(main); err == nil || err.Error() != want {
+				t.Errorf("importing without the fs capability returned %v, want %q", err, want)
+			}
+			// the standard library is bundled, so it needs no capability
+			if got, err := in.Run(`import "std/strings" as strings
+strings.upper("std")`); err != nil || got != "STD" {
+				t.Errorf("importing std/strings without the fs capability returned %#v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestIO(t *testing.T) {
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			opts := append([]Option{WithStdout(&out), WithStdin(strings.NewReader("Ada\nignored\n"))}, opts...)
+			in := New(opts...)
+			if _, err := in.Run(`let name = ask("name? ")
+print("hello " + name)`); err != nil {
+				t.Fatalf("Run failed: %s", err)
+			}
+			if want := "name? hello Ada\n"; out.String() != want {
+				t.Errorf("output is %q, want %q", out.String(), want)
+			}
+		})
+	}
+}
+
+func TestConversion(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	tests := []struct {
+		in   any
+		dot  string
+		back any
+	}{
+		{nil, "NULL", nil},
+		{true, "true", true},
+		{int8(-3), "-3", -3},
+		{uint64(1 << 63), "9223372036854775808", new(big.Int).SetUint64(1 << 63)},
+		{huge, "123456789012345678901234567890", huge},
+		{2.5, "2.5", 2.5},
+		{"dot", "dot", "dot"},
+		{[]any{1, "a", []string{"b"}}, "[1, a, [b]]", []any{1, "a", []any{"b"}}},
+		{map[string]int{"b": 2, "a": 1}, "{ a: 1, b: 2,  }", map[string]any{"a": 1, "b": 2}},
+	}
+
+	for i, tt := range tests {
+		obj, err := ToObject(tt.in)
+		if err != nil {
+			t.Errorf("tests[%d] - ToObject failed: %s", i, err)
+			continue
+		}
+		if obj.String() != tt.dot {
+			t.Errorf("tests[%d] - ToObject gave %q, want %q", i, obj.String(), tt.dot)
+		}
+		if back, err := FromObject(obj); err != nil || !reflect.DeepEqual(back, tt.back) {
+			t.Errorf("tests[%d] - FromObject gave %#v, %v, want %#v", i, back, err, tt.back)
+		}
+	}
+
+	if _, err := ToObject(struct{}{}); err == nil {
+		t.Errorf("ToObject of a struct succeeded")
+	}
+}
+
+func TestCyclicValues(t *testing.T) {
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			in := New(opts...)
+			if _, err := in.Run(`let a = [1]; a[0] = a; let h = {}; h["h"] = h; let get = fn() { a }; 0`); err != nil {
+				t.Fatalf("Run failed: %s", err)
+			}
+			want := "interp: cannot convert an ARRAY that contains itself"
+			if _, err := in.Get("a"); err == nil || err.Error() != want {
+				t.Errorf("Get(a) returned error %v, want %q", err, want)
+			}
+			if _, err := in.Run(`a`); err == nil || err.Error() != want {
+				t.Errorf("Run(a) returned error %v, want %q", err, want)
+			}
+			if _, err := in.Call("get"); err == nil || err.Error() != want {
+				t.Errorf("Call(get) returned error %v, want %q", err, want)
+			}
+			want = "interp: cannot convert a HASH that contains itself"
+			if _, err := in.Get("h"); err == nil || err.Error() != want {
+				t.Errorf("Get(h) returned error %v, want %q", err, want)
+			}
+			// a value may appear twice without containing itself
+			if got, err := in.Run(`let b = [1]; [b, b]`); err != nil || !reflect.DeepEqual(got, []any{[]any{1}, []any{1}}) {
+				t.Errorf("Run([b, b]) returned %#v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			in := New(opts...)
+			in.Register("repeat", object.NewBuiltin("repeat", func(rt *object.Runtime, args ...object.Object) object.Object {
+				s, n := args[0].(*object.String), args[1].(*object.Integer)
+				return &object.String{Value: strings.Repeat(s.Value, int(n.Value))}
+			}, object.STRING_OBJ, object.INTEGER_OBJ))
+			var printed []string
+			in.Register("print", &object.Builtin{Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				for _, arg := range args {
+					printed = append(printed, arg.String())
+				}
+				return object.NewHash()
+			}})
+			in.Unregister("len")
+
+			got, err := in.Run(`print(repeat("ab", 3))`)
+			if err != nil {
+				t.Fatalf("Run failed: %s", err)
+			}
+			if !reflect.DeepEqual(printed, []string{"ababab"}) || !reflect.DeepEqual(got, map[string]any{}) {
+				t.Errorf("overridden print saw %q and returned %#v", printed, got)
+			}
+
+			tests := []struct {
+				input string
+				err   string
+			}{
+				{`repeat("ab")`, "ArgumentError: wrong number of arguments: want=2, got=1"},
+				{`repeat("ab", "c")`, "TypeError: argument to `repeat` must be INTEGER, got STRING"},
+				{`len("ab")`, "NameError: identifier not found: len"},
+				{`int([])`, "TypeError: argument to `int` must be INTEGER, FLOAT or STRING, got ARRAY"},
+				{`range(1, 2, 3, 4)`, "ArgumentError: wrong number of arguments: want=1 to 3, got=4"},
+			}
+			for _, tt := range tests {
+				_, err := in.Run(tt.input)
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err+" - ") {
+					t.Errorf("%s: got error %v, want %q", tt.input, err, tt.err)
+				}
+			}
+
+			// other interpreters keep the standard builtins
+			if got, err := New(opts...).Run(`len("ab")`); err != nil || got != 2 {
+				t.Errorf("len in a new interpreter returned %#v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			in := New(opts...)
+			in.Register("twice", object.NewBuiltin("twice", func(rt *object.Runtime, args ...object.Object) object.Object {
+				once := rt.Call(args[0], args[1])
+				if _, ok := once.(*object.Error); ok {
+					return once
+				}
+				return rt.Call(args[0], once)
+			}, object.FUNCTION_OBJ, object.ANY_OBJ))
+			if got, err := in.Run(`let triple = fn(x) { x * 3 }
+twice(triple, 2)`); err != nil || got != 18 {
+				t.Errorf("twice(triple, 2) returned %#v, %v", got, err)
+			}
+			if _, err := in.Run(`twice(fn(x) { x + "" }, 2)`); err == nil || !strings.Contains(err.Error(), "type mismatch") {
+				t.Errorf("an error inside a callback returned %v", err)
+			}
+
+			triple, _ := in.Get("triple")
+			if got, err := in.Call("map", []any{1, 2}, triple); err != nil || !reflect.DeepEqual(got, []any{3, 6}) {
+				t.Errorf("Call(map) returned %#v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		limits object.Limits
+		ctx    context.Context
+		input  string
+		err    string
+	}{
+		{object.Limits{Steps: 10000}, nil, `while (true) {}`, "step limit of 10000 exceeded"},
+		{object.Limits{Depth: 50}, nil, `let f = fn(n) { f(n + 1) }; f(0)`, "call depth limit of 50 exceeded"},
+		{object.Limits{Time: 20 * time.Millisecond}, nil, `while (true) {}`, "time limit of 20ms exceeded"},
+		{object.Limits{}, cancelled, `let n = 0; while (true) { n += 1 }`, "run stopped: context canceled"},
+		{object.Limits{Elements: 10}, nil, `let a = []; while (true) { a = push(a, 1) }`, "ARRAY of length 11 exceeds the limit of 10"},
+		{object.Limits{Elements: 10}, nil, `let s = "."; while (true) { s += s }`, "STRING of length 16 exceeds the limit of 10"},
+		{object.Limits{Elements: 2}, nil, `let h = {}; h["a"] = 1; h["b"] = 2; h["c"] = 3`, "HASH of length 3 exceeds the limit of 2"},
+		{object.Limits{Elements: 1000}, nil, `let x = 2; let i = 0; while (i < 40) { x = x * x; i += 1 }`, "INTEGER of length 1025 exceeds the limit of 1000"},
+		{object.Limits{Elements: 1000}, nil, `let x = 3; while (true) { x *= x }`, "INTEGER of length 1624 exceeds the limit of 1000"},
+		{object.Limits{Elements: 1000}, nil, `import "std/math" as m; m.pow(10, 1000000)`, "INTEGER of length 375001 exceeds the limit of 1000"},
+		{object.Limits{Elements: 20, Steps: 100000, Time: 2 * time.Second}, nil, `map(range(0, 100000000000), fn(x) { x })`, "RANGE of length 100000000000 exceeds the limit of 20"},
+		{object.Limits{Elements: 20}, nil, `enumerate(range(0, 21))`, "RANGE of length 21 exceeds the limit of 20"},
+		{object.Limits{Steps: 10000}, nil, `sort(range(0, 100000000000))`, "step limit of 10000 exceeded"},
+		// the error can be caught, but the program cannot go on
+		{object.Limits{Steps: 1000}, nil, `try { while (true) {} } catch (e) { print(e) }; "done"`, "step limit of 1000 exceeded"},
+	}
+
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range tests {
+				in := New(append([]Option{WithLimits(tt.limits), WithStdout(io.Discard)}, opts...)...)
+				ctx := tt.ctx
+				if ctx == nil {
+					ctx = context.Background()
+				}
+				_, err := in.RunContext(ctx, tt.input)
+				var limitErr *object.Error
+				if !errors.As(err, &limitErr) || limitErr.Kind != object.LimitError || limitErr.Message != tt.err {
+					t.Errorf("%s: got error %v, want LimitError: %s", tt.input, err, tt.err)
+					continue
+				}
+				// the next run starts counting afresh
+				if got, err := in.Run(`1 + 1`); err != nil || got != 2 {
+					t.Errorf("%s: the next run returned %#v, %v", tt.input, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "note.txt")
+	t.Setenv("DOT_TEST", "set")
+	program := `writefile(path, getenv("DOT_TEST"))
+let text = readfile(path)
+if (now() > 0) { text }`
+
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			in := New(opts...)
+			in.Set("path", path)
+			if got, err := in.Run(program); err != nil || got != "set" {
+				t.Fatalf("Run with every capability returned %#v, %v", got, err)
+			}
+
+			tests := []struct {
+				opts []Option
+				err  string
+			}{
+				{[]Option{WithCapabilities(object.CapEnv)}, "PermissionError: `writefile` needs the fs capability, which is denied - at line 1, column 1"},
+				{[]Option{WithCapabilities(object.CapFS, object.CapTime)}, "PermissionError: `getenv` needs the env capability, which is denied - at line 1, column 17"},
+				{[]Option{WithoutCapabilities(object.CapTime)}, "PermissionError: `now` needs the time capability, which is denied - at line 3, column 5"},
+			}
+			for i, tt := range tests {
+				in := New(append(tt.opts, opts...)...)
+				in.Set("path", path)
+				_, err := in.Run(program)
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("tests[%d] - got error %v, want %q", i, err, tt.err)
+				}
+			}
+
+			// a denied error can be caught like any other
+			var out bytes.Buffer
+			in = New(append([]Option{WithStdout(&out), WithoutCapabilities(object.CapEnv)}, opts...)...)
+			if _, err := in.Run(`try { getenv("HOME") } catch (e) { print(e["kind"]) }`); err != nil || out.String() != "PermissionError\n" {
+				t.Errorf("catching a PermissionError printed %q, %v", out.String(), err)
+			}
+
+			// host builtins are denied with their capability
+			in = New(append([]Option{WithoutCapabilities(object.CapProcess)}, opts...)...)
+			in.Register("pid", &object.Builtin{Capability: object.CapProcess, Fn: func(rt *object.Runtime, args ...object.Object) object.Object {
+				return &object.Integer{Value: int64(os.Getpid())}
+			}})
+			if _, err := in.Call("pid"); err == nil || !strings.Contains(err.Error(), "`pid` needs the process capability") {
+				t.Errorf("calling a denied host builtin returned %v", err)
+			}
+		})
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input  string
+		code   int
+		output string
+	}{
+		{`print("a"); exit(3); print("b")`, 3, "a\n"},
+		{`let f = fn() { exit() }; f(); print("b")`, 0, ""},
+		{`try { exit(4) } catch (e) { print("caught") } finally { print("finally") }`, 4, ""},
+		{`map([1, 2], fn(x) { print(x); exit(x) })`, 1, "1\n"},
+	}
+
+	for name, opts := range engines {
+		t.Run(name, func(t *testing.T) {
+			for i, tt := range tests {
+				var out bytes.Buffer
+				in := New(append([]Option{WithStdout(&out)}, opts...)...)
+				_, err := in.Run(tt.input)
+				var exit *ExitError
+				if !errors.As(err, &exit) || exit.Code != tt.code {
+					t.Errorf("tests[%d] - got error %v, want exit status %d", i, err, tt.code)
+				}
+				if out.String() != tt.output {
+					t.Errorf("tests[%d] - printed %q, want %q", i, out.String(), tt.output)
+				}
+				// the next run starts afresh
+				if got, err := in.Run(`1 + 1`); err != nil || got != 2 {
+					t.Errorf("tests[%d] - run after exit returned %#v, %v", i, got, err)
+				}
+			}
+
+			in := New(opts...)
+			if _, err := in.Run(`exit(256)`); err == nil || err.Error() != "ValueError: exit status must be between 0 and 255, got 256 - at line 1, column 1" {
+				t.Errorf("exit(256) returned %v", err)
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package lexer
 
-import "dot/token"
+import (
+	"dot/token"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 func isAlphabet(ch byte) bool {
 	if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_' {
@@ -16,14 +22,176 @@ func isDigitBetween0and9(ch byte) bool {
 	return false
 }
 
-func isDigit(ch byte, previousChar byte, nextChar byte) bool {
-	if ch == '.' && (isDigitBetween0and9(previousChar) || isDigitBetween0and9(nextChar)) {
-		return true
+// readNumber reads an integer literal, or a float literal if the digits
+// are followed by a '.' and more digits.
+func (l *Lexer) readNumber() token.Token {
+	initialPosition := l.currentPosition
+	tokType := token.TokenType(token.INTEGER)
+	for isDigitBetween0and9(l.currentChar) {
+		l.readChar()
 	}
-	if isDigitBetween0and9(ch) {
-		return true
+	if l.currentChar == '.' && isDigitBetween0and9(l.peekChar) {
+		tokType = token.FLOAT
+		l.readChar()
+		for isDigitBetween0and9(l.currentChar) {
+			l.readChar()
+		}
 	}
-	return false
+	return token.Token{Type: tokType, Literal: l.input[initialPosition:l.currentPosition]}
+}
+
+// readString reads a string in single or double quotes, replacing its
+// escape sequences with the characters they stand for. A string that is
+// not closed on the line it starts on, or that has an invalid escape
+// sequence, is ILLEGAL. A string with expressions in ${...} is read up to
+// its first expression, see token.STRING_HEAD.
+func (l *Lexer) readString() token.Token {
+	start := l.position()
+	quote := l.currentChar
+	l.readChar()
+	return l.readStringPart(quote, start, token.STRING, token.STRING_HEAD)
+}
+
+// readStringPart reads the text of a string from the current character up
+// to its closing quote, returning a token of type closed, or up to the
+// next ${, returning a token of type open.
+func (l *Lexer) readStringPart(quote byte, start token.Position, closed, open token.TokenType) token.Token {
+	var value strings.Builder
+	var invalid string
+	tokType := closed
+	for tokType == closed && l.currentChar != quote {
+		switch {
+		case l.atEnd() || l.currentChar == '\n':
+			l.interpolations = nil
+			return token.Token{Type: token.ILLEGAL, Literal: "unterminated string", Pos: start}
+		case l.currentChar == '\\':
+			if err := l.readEscape(&value); err != "" && invalid == "" {
+				invalid = err
+			}
+		case l.currentChar == '$' && l.peekChar == '{':
+			l.readChar()
+			l.readChar()
+			l.interpolations = append(l.interpolations, interpolation{quote: quote, start: start})
+			tokType = open
+		default:
+			value.WriteByte(l.currentChar)
+			l.readChar()
+		}
+	}
+	if tokType == closed {
+		l.readChar()
+	}
+	if invalid != "" {
+		return token.Token{Type: token.ILLEGAL, Literal: invalid, Pos: start}
+	}
+	return token.Token{Type: tokType, Literal: value.String()}
+}
+
+// readInterpolationEnd reads the rest of the string in once the current
+// character closes its expression, or reports an unterminated string if
+// the expression runs past the end of the line. Otherwise it counts the
+// braces of the expression and returns false.
+func (l *Lexer) readInterpolationEnd(in *interpolation) (token.Token, bool) {
+	switch {
+	case l.atEnd() || l.currentChar == '\n':
+		start := l.interpolations[0].start
+		l.interpolations = nil
+		return token.Token{Type: token.ILLEGAL, Literal: "unterminated string", Pos: start}, true
+	case l.currentChar == '{':
+		in.braces++
+	case l.currentChar == '}' && in.braces > 0:
+		in.braces--
+	case l.currentChar == '}':
+		quote, start := in.quote, in.start
+		l.interpolations = l.interpolations[:len(l.interpolations)-1]
+		l.readChar()
+		return l.readStringPart(quote, start, token.STRING_TAIL, token.STRING_MIDDLE), true
+	}
+	return token.Token{}, false
+}
+
+// readEscape reads the escape sequence starting at the current character,
+// a backslash, and writes the character it stands for to value. If the
+// sequence is invalid it returns why.
+func (l *Lexer) readEscape(value *strings.Builder) string {
+	l.readChar()
+	ch := l.currentChar
+	if l.atEnd() || ch == '\n' {
+		// left for readString to report
+		return ""
+	}
+	l.readChar()
+	switch ch {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case 'r':
+		value.WriteByte('\r')
+	case '0':
+		value.WriteByte(0)
+	case '\\', '"', '\'', '$':
+		value.WriteByte(ch)
+	case 'u':
+		r, ok := l.readUnicodeEscape()
+		if !ok {
+			return "invalid unicode escape sequence"
+		}
+		value.WriteRune(r)
+	default:
+		return fmt.Sprintf("invalid escape sequence '\\%c'", ch)
+	}
+	return ""
+}
+
+// readUnicodeEscape reads the code point of a unicode escape sequence after
+// its '\u', either four hex digits or one to six in braces.
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+	start, end := l.currentPosition, l.currentPosition+4
+	braced := l.currentChar == '{'
+	if braced {
+		start = l.currentPosition + 1
+		end = strings.IndexByte(l.input[start:], '}')
+		if end < 1 || end > 6 {
+			return 0, false
+		}
+		end += start
+	}
+	if end > len(l.input) {
+		return 0, false
+	}
+	code, err := strconv.ParseUint(l.input[start:end], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, false
+	}
+	for l.currentPosition < end {
+		l.readChar()
+	}
+	if braced {
+		l.readChar()
+	}
+	return rune(code), true
+}
+
+// readRawString reads a string in backticks, which has no escape sequences
+// and can span lines. A string that is not closed is ILLEGAL.
+func (l *Lexer) readRawString() token.Token {
+	l.readChar()
+	start := l.currentPosition
+	for l.currentChar != '`' {
+		if l.atEnd() {
+			return token.Token{Type: token.ILLEGAL, Literal: "unterminated raw string"}
+		}
+		l.readChar()
+	}
+	value := l.input[start:l.currentPosition]
+	l.readChar()
+	return token.Token{Type: token.STRING, Literal: value}
+}
+
+// atEnd reports whether the lexer has read all of its input.
+func (l *Lexer) atEnd() bool {
+	return l.currentPosition >= len(l.input)
 }
 
 func newToken(tokenType token.TokenType, ch byte) token.Token {
@@ -31,16 +199,13 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: literal}
 }
 func (l *Lexer) skipWhitespace() {
-	for l.currentChar == ' ' || l.currentChar == '\t' || l.currentChar == '\n' || l.currentChar == '\r' {
+	// the expressions in a string must end on its line
+	newline := len(l.interpolations) == 0
+	for l.currentChar == ' ' || l.currentChar == '\t' || (l.currentChar == '\n' && newline) || l.currentChar == '\r' {
 		l.readChar()
 	}
 }
 
-func (l *Lexer) Line() int {
-	return l.line
-}
-
-func (l *Lexer) Column() int {
-	// after parsing a token, we need to return the column of previous token
-	return l.column - 1
+func (l *Lexer) position() token.Position {
+	return token.Position{File: l.file, Offset: l.currentPosition, Line: l.line, Column: l.column}
 }
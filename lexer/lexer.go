@@ -2,21 +2,48 @@ package lexer
 
 import (
 	"dot/token"
-	"strings"
 )
 
 type Lexer struct {
 	input           string
+	file            string
 	currentPosition int
 	peekPosition    int
 	currentChar     byte
 	peekChar        byte
 	line            int
 	column          int
+	// interpolations holds the strings whose ${...} expressions are being
+	// read, innermost last
+	interpolations []interpolation
+}
+
+// interpolation is a string in the middle of one of its expressions.
+type interpolation struct {
+	quote  byte
+	start  token.Position // the position of the opening quote
+	braces int            // braces opened in the expression and not closed
 }
 
 func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
+	start := l.position()
+	tok := l.readToken()
+	if !tok.Pos.IsValid() {
+		tok.Pos = start
+	}
+	tok.End = l.position()
+	return tok
+}
+
+// readToken reads the token starting at the current character, leaving the
+// lexer on the first character after it.
+func (l *Lexer) readToken() token.Token {
+	if n := len(l.interpolations); n > 0 {
+		if tok, ok := l.readInterpolationEnd(&l.interpolations[n-1]); ok {
+			return tok
+		}
+	}
 	var tok token.Token
 	switch l.currentChar {
 	case '+':
@@ -114,21 +141,14 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			return token.Token{Type: token.OR, Literal: "||"}
 		}
+		tok = newToken(token.UNKNOWN, l.currentChar)
 	case '"', '\'':
-		quoteType := l.currentChar
-		l.readChar()
-		initialPosition := l.currentPosition
-		for {
-			if l.currentChar == quoteType || l.currentChar == 0 {
-				break
-			}
-			l.readChar()
-		}
-		tok = token.Token{Type: token.STRING, Literal: l.input[initialPosition:l.currentPosition]}
+		return l.readString()
+	case '`':
+		return l.readRawString()
 	case 0:
 		tok = token.Token{Type: token.EOF, Literal: ""}
 	default:
-		previousChar := l.currentChar
 		if isAlphabet(l.currentChar) {
 			initialPosition := l.currentPosition
 			for isAlphabet(l.currentChar) {
@@ -141,18 +161,10 @@ func (l *Lexer) NextToken() token.Token {
 			} else {
 				return token.Token{Type: tokType, Literal: sequence}
 			}
-		} else if isDigit(l.currentChar, previousChar, l.peekChar) {
-			initialPosition := l.currentPosition
-			for isDigit(l.currentChar, previousChar, l.peekChar) {
-				l.readChar()
-			}
-			sequence := l.input[initialPosition:l.currentPosition]
-			tokType, ok := token.Keywords[sequence]
-			if !ok {
-				return token.Token{Type: token.INTEGER, Literal: sequence}
-			} else {
-				return token.Token{Type: tokType, Literal: sequence}
-			}
+		} else if isDigitBetween0and9(l.currentChar) || (l.currentChar == '.' && isDigitBetween0and9(l.peekChar)) {
+			return l.readNumber()
+		} else if l.currentChar == '.' {
+			tok = newToken(token.DOT, l.currentChar)
 		} else {
 			tok = newToken(token.UNKNOWN, l.currentChar)
 		}
@@ -162,26 +174,39 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 func NewLexer(input string) *Lexer {
+	return NewFileLexer("", input)
+}
+
+// NewFileLexer is like NewLexer but records file as the file name in the
+// position of every token.
+func NewFileLexer(file string, input string) *Lexer {
 	lexer := &Lexer{
-		input:           strings.TrimSpace(input),
+		input:           input,
+		file:            file,
 		currentPosition: 0,
-		peekPosition:    0,
-		currentChar:     input[0],
+		peekPosition:    1,
+		currentChar:     0,
 		peekChar:        0,
 		line:            1,
-		column:          0,
+		column:          1,
+	}
+	if len(input) > 0 {
+		lexer.currentChar = input[0]
 	}
 	if len(input) > 1 {
 		lexer.peekChar = input[1]
-		lexer.peekPosition = 1
 	}
 	return lexer
 }
 
 func (l *Lexer) readChar() {
+	if l.currentPosition >= len(l.input) {
+		// already at the end of input, stay on EOF
+		return
+	}
 	if l.currentChar == '\n' {
 		l.line += 1
-		l.column = 0
+		l.column = 1
 	} else {
 		l.column += 1
 	}
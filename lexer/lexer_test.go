@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"dot/token"
+	"reflect"
 	"testing"
 )
 
@@ -197,3 +198,189 @@ x -= 1;
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 10;
+  x += "ab"`
+
+	tests := []struct {
+		expectedType token.TokenType
+		pos          token.Position
+		end          token.Position
+	}{
+		{token.LET, token.Position{File: "test.dot", Offset: 0, Line: 1, Column: 1}, token.Position{File: "test.dot", Offset: 3, Line: 1, Column: 4}},
+		{token.IDENTIFIER, token.Position{File: "test.dot", Offset: 4, Line: 1, Column: 5}, token.Position{File: "test.dot", Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{File: "test.dot", Offset: 6, Line: 1, Column: 7}, token.Position{File: "test.dot", Offset: 7, Line: 1, Column: 8}},
+		{token.INTEGER, token.Position{File: "test.dot", Offset: 8, Line: 1, Column: 9}, token.Position{File: "test.dot", Offset: 10, Line: 1, Column: 11}},
+		{token.SEMICOLON, token.Position{File: "test.dot", Offset: 10, Line: 1, Column: 11}, token.Position{File: "test.dot", Offset: 11, Line: 1, Column: 12}},
+		{token.IDENTIFIER, token.Position{File: "test.dot", Offset: 14, Line: 2, Column: 3}, token.Position{File: "test.dot", Offset: 15, Line: 2, Column: 4}},
+		{token.PLUS_EQUAL, token.Position{File: "test.dot", Offset: 16, Line: 2, Column: 5}, token.Position{File: "test.dot", Offset: 18, Line: 2, Column: 7}},
+		{token.STRING, token.Position{File: "test.dot", Offset: 19, Line: 2, Column: 8}, token.Position{File: "test.dot", Offset: 23, Line: 2, Column: 12}},
+		{token.EOF, token.Position{File: "test.dot", Offset: 23, Line: 2, Column: 12}, token.Position{File: "test.dot", Offset: 23, Line: 2, Column: 12}},
+	}
+
+	l := NewFileLexer("test.dot", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.pos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v", i, tt.pos, tok.Pos)
+		}
+
+		if tok.End != tt.end {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.end, tok.End)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `7 3.25 .5 10.0 1.x 2..3`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTEGER, "7"},
+		{token.FLOAT, "3.25"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "10.0"},
+		{token.INTEGER, "1"},
+		{token.DOT, "."},
+		{token.IDENTIFIER, "x"},
+		{token.INTEGER, "2"},
+		{token.DOT, "."},
+		{token.FLOAT, ".3"},
+		{token.EOF, ""},
+	}
+
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"plain"`, token.STRING, "plain"},
+		{`'single "quoted"'`, token.STRING, `single "quoted"`},
+		{`"a\tb\nc\r\\"`, token.STRING, "a\tb\nc\r\\"},
+		{`"say \"hi\" and \'bye\'"`, token.STRING, `say "hi" and 'bye'`},
+		{`"\u00e9\u{1F600}\0"`, token.STRING, "é😀\x00"},
+		{"`raw \\n ${x}\nline two`", token.STRING, "raw \\n ${x}\nline two"},
+		{`"open`, token.ILLEGAL, "unterminated string"},
+		{"'line\nbreak'", token.ILLEGAL, "unterminated string"},
+		{"`open", token.ILLEGAL, "unterminated raw string"},
+		{`"bad \q escape"`, token.ILLEGAL, `invalid escape sequence '\q'`},
+		{`"\u12"`, token.ILLEGAL, "invalid unicode escape sequence"},
+		{`"\u{110000}"`, token.ILLEGAL, "invalid unicode escape sequence"},
+	}
+
+	for i, tt := range tests {
+		tok := NewLexer(tt.input).NextToken()
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	// the lexer carries on after a string left open at the end of a line
+	l := NewLexer("let s = \"open\nlet t = 1")
+	var types []token.TokenType
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+	want := []token.TokenType{token.LET, token.IDENTIFIER, token.ASSIGN, token.ILLEGAL, token.LET, token.IDENTIFIER, token.ASSIGN, token.INTEGER}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("tokens after an unterminated string are %v, want %v", types, want)
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `"Hi ${name}, ${ {"n": 1}["n"] }!" + 'a${"b${c}"}' + "\${x} $y"`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_HEAD, "Hi "},
+		{token.IDENTIFIER, "name"},
+		{token.STRING_MIDDLE, ", "},
+		{token.LBRACE, "{"},
+		{token.STRING, "n"},
+		{token.COLON, ":"},
+		{token.INTEGER, "1"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "n"},
+		{token.RBRACKET, "]"},
+		{token.STRING_TAIL, "!"},
+		{token.PLUS, "+"},
+		{token.STRING_HEAD, "a"},
+		{token.STRING_HEAD, "b"},
+		{token.IDENTIFIER, "c"},
+		{token.STRING_TAIL, ""},
+		{token.STRING_TAIL, ""},
+		{token.PLUS, "+"},
+		{token.STRING, "${x} $y"},
+		{token.EOF, ""},
+	}
+
+	l := NewLexer(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestInterpolationErrors checks that errors in a string with expressions
+// are reported at the opening quote, wherever the lexer finds them.
+func TestInterpolationErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`x = "a ${`, "unterminated string"},
+		{`x = "a ${b + {`, "unterminated string"},
+		{"x = 'a ${b\n}'", "unterminated string"},
+		{`x = "a ${b} c ${`, "unterminated string"},
+		{`x = "a ${b} \q"`, `invalid escape sequence '\q'`},
+	}
+
+	for i, tt := range tests {
+		l := NewLexer(tt.input)
+		tok := l.NextToken()
+		for tok.Type != token.ILLEGAL && tok.Type != token.EOF {
+			tok = l.NextToken()
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Line != 1 || tok.Pos.Column != 5 {
+			t.Errorf("tests[%d] - position wrong. expected=1:5, got=%d:%d", i, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
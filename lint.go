@@ -0,0 +1,97 @@
+package main
+
+import (
+	"dot/check"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// check runs dot check with the arguments after the subcommand. It prints
+// the diagnostics of the files named by paths, and of the .dot files in
+// the directories among them, and fails if any of them is an error.
+func (c *cli) check(args []string) int {
+	flags := flag.NewFlagSet("dot check", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: dot check [-json] [-severity rule=level,...] [path...]\n\nWith no paths, dot check checks the program read from stdin.\n\nRules:")
+		for _, rule := range check.Rules {
+			fmt.Fprintf(c.stderr, "  %-16s %-8s %s\n", rule.Name, rule.Severity, rule.Doc)
+		}
+		fmt.Fprintln(c.stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	asJSON := flags.Bool("json", false, "print the diagnostics as a JSON array")
+	// programs run by the dot command are given args
+	opts := []check.Option{check.WithGlobals("args")}
+	flags.Func("severity", "set the severity of rules, as comma-separated `rule=level` pairs with level error, warning or off", func(list string) error {
+		for _, setting := range strings.Split(list, ",") {
+			name, level, _ := strings.Cut(setting, "=")
+			if !isRule(name) {
+				return fmt.Errorf("unknown rule %q", name)
+			}
+			severity, err := check.ParseSeverity(level)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, check.WithSeverity(name, severity))
+		}
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+
+	var diagnostics []check.Diagnostic
+	ok := true
+	if paths := flags.Args(); len(paths) == 0 || len(paths) == 1 && paths[0] == "-" {
+		src, err := io.ReadAll(c.stdin)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return exitFailure
+		}
+		diagnostics = check.Source("<stdin>", string(src), opts...)
+	} else {
+		ok = c.eachFile(paths, func(file string) bool {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Fprintln(c.stderr, err)
+				return false
+			}
+			diagnostics = append(diagnostics, check.Source(file, string(src), opts...)...)
+			return true
+		})
+	}
+
+	if *asJSON {
+		if diagnostics == nil {
+			diagnostics = []check.Diagnostic{}
+		}
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(diagnostics)
+	} else {
+		for _, d := range diagnostics {
+			fmt.Fprintln(c.stdout, d)
+		}
+	}
+	for _, d := range diagnostics {
+		ok = ok && d.Severity != check.Error
+	}
+	if !ok {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func isRule(name string) bool {
+	for _, rule := range check.Rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
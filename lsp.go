@@ -0,0 +1,28 @@
+package main
+
+import (
+	"dot/lsp"
+	"flag"
+	"fmt"
+)
+
+// lsp runs dot lsp, a language server for editors talking to it over
+// stdin and stdout.
+func (c *cli) lsp(args []string) int {
+	flags := flag.NewFlagSet("dot lsp", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: dot lsp\n\nServe the Language Server Protocol over stdin and stdout.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	// clients such as the VS Code one pass --stdio to name the transport
+	flags.Bool("stdio", true, "talk to the client over stdin and stdout, the only transport")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if err := lsp.New(c.stdin, c.stdout).Run(); err != nil {
+		fmt.Fprintf(c.stderr, "dot lsp: %s\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,54 @@
+package lsp
+
+// builtin describes a builtin function for hovers and completions.
+type builtin struct {
+	signature string
+	doc       string
+}
+
+// builtins documents the builtins of eval.Builtins.
+var builtins = map[string]builtin{
+	"len":        {"len(x)", "Returns the number of characters of a string, or of elements of an array, hash or range."},
+	"first":      {"first(array)", "Returns the first element of an array, or null if it is empty."},
+	"last":       {"last(array)", "Returns the last element of an array, or null if it is empty."},
+	"rest":       {"rest(array)", "Returns a new array of the elements of an array after the first, or null if it is empty."},
+	"push":       {"push(array, value)", "Returns a new array of the elements of an array followed by value."},
+	"print":      {"print(values...)", "Prints each value on a line of its own and returns an empty string. Needs the io capability."},
+	"ask":        {"ask(prompt...)", "Prints its arguments and returns the next line read from the input. Needs the io capability."},
+	"copy":       {"copy(x)", "Returns a shallow copy of an array or hash."},
+	"deepcopy":   {"deepcopy(x)", "Returns a copy of an array or hash and of the arrays and hashes inside it."},
+	"range":      {"range(stop) | range(start, stop) | range(start, stop, step)", "Returns the integers from start, 0 unless given, up to but not including stop, step apart."},
+	"int":        {"int(x)", "Converts a float, a string or a boolean to an integer."},
+	"float":      {"float(x)", "Converts an integer or a string to a float."},
+	"str":        {"str(x)", "Returns any value as a string."},
+	"split":      {"split(s, sep)", "Returns the parts of s between the occurrences of sep."},
+	"join":       {"join(array, sep)", "Returns the elements of an array as one string, with sep, if given, between them."},
+	"chars":      {"chars(s)", "Returns the characters of s as an array of strings."},
+	"trim":       {"trim(s)", "Returns s without leading and trailing whitespace."},
+	"upper":      {"upper(s)", "Returns s in upper case."},
+	"lower":      {"lower(s)", "Returns s in lower case."},
+	"contains":   {"contains(s, sub)", "Reports whether sub is within s."},
+	"startsWith": {"startsWith(s, prefix)", "Reports whether s begins with prefix."},
+	"endsWith":   {"endsWith(s, suffix)", "Reports whether s ends with suffix."},
+	"indexOf":    {"indexOf(s, sub)", "Returns the index in characters of the first sub in s, or -1 if there is none."},
+	"replace":    {"replace(s, old, new)", "Returns s with every old replaced by new."},
+	"repeat":     {"repeat(s, n)", "Returns n copies of s."},
+	"padLeft":    {"padLeft(s, width, char)", "Returns s with copies of char, a space unless given, added before it until it is width characters long."},
+	"padRight":   {"padRight(s, width, char)", "Returns s with copies of char, a space unless given, added after it until it is width characters long."},
+	"map":        {"map(xs, f)", "Returns an array of the results of f called with each element of xs."},
+	"filter":     {"filter(xs, f)", "Returns an array of the elements of xs for which f returns a truthy value."},
+	"reduce":     {"reduce(xs, f, initial)", "Combines the elements of xs with f, starting from initial or, without it, from the first element."},
+	"find":       {"find(xs, f)", "Returns the first element of xs for which f returns a truthy value, or null."},
+	"any":        {"any(xs, f)", "Reports whether f returns a truthy value for any element of xs, or without f whether any element is truthy."},
+	"all":        {"all(xs, f)", "Reports whether f returns a truthy value for every element of xs, or without f whether every element is truthy."},
+	"sort":       {"sort(xs, cmp)", "Returns the elements of xs in order, numbers or strings, or by cmp if given. The sort is stable."},
+	"sortBy":     {"sortBy(xs, key)", "Returns the elements of xs in the order of the results of key called with them. The sort is stable."},
+	"groupBy":    {"groupBy(xs, key)", "Returns a hash of arrays of the elements of xs, keyed by the results of key called with them."},
+	"zip":        {"zip(xs, ys...)", "Returns arrays of the elements at the same index of each argument, as many as the shortest has."},
+	"enumerate":  {"enumerate(xs)", "Returns an array of [index, element] pairs of xs."},
+	"readfile":   {"readfile(path)", "Returns the contents of the file at path. Needs the fs capability."},
+	"writefile":  {"writefile(path, text)", "Writes text to the file at path. Needs the fs capability."},
+	"getenv":     {"getenv(name)", "Returns the value of the environment variable called name. Needs the env capability."},
+	"now":        {"now()", "Returns the seconds since the Unix epoch, as a float. Needs the time capability."},
+	"exit":       {"exit(status)", "Ends the program with status, 0 unless given, between 0 and 255. Needs the process capability."},
+}
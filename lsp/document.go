@@ -0,0 +1,141 @@
+package lsp
+
+import (
+	"dot/ast"
+	"dot/lexer"
+	"dot/parser"
+	"dot/token"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is an open file, parsed whenever its text changes.
+type document struct {
+	uri     string
+	text    string
+	lines   []int // the byte offsets the lines start at
+	program *ast.Program
+	errors  parser.ErrorList
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	p := parser.NewParser(lexer.NewFileLexer(uri, text))
+	d.program = p.ParseProgram()
+	d.errors = p.Errors()
+	return d
+}
+
+// position returns the protocol position of pos, which LSP counts in
+// UTF-16 code units where Dot counts bytes.
+func (d *document) position(pos token.Position) Position {
+	offset := min(max(pos.Offset, 0), len(d.text))
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	return Position{Line: line, Character: utf16Len(d.text[d.lines[line]:offset])}
+}
+
+// offset returns the byte offset of p, or of the end of its line if p is
+// past it.
+func (d *document) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[p.Line]
+	for units := 0; units < p.Character && offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		units += utf16Len(string(r))
+		offset += size
+	}
+	return offset
+}
+
+func (d *document) rangeOf(node ast.Node) Range {
+	return Range{Start: d.position(node.Pos()), End: d.position(node.End())}
+}
+
+// all returns the range of the whole document.
+func (d *document) all() Range {
+	return Range{End: d.position(token.Position{Offset: len(d.text)})}
+}
+
+// identifierAt returns the identifier under or right before the byte at
+// offset, or nil if there is none. The members of member expressions are
+// left out, as they do not name variables.
+func (d *document) identifierAt(offset int) *ast.Identifier {
+	var found *ast.Identifier
+	ast.Inspect(d.program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil:
+			return false
+		case *ast.MemberExpression:
+			ast.Inspect(n.Left, func(n ast.Node) bool {
+				return found == nil && visitIdentifier(n, offset, &found)
+			})
+			return false
+		}
+		return found == nil && visitIdentifier(n, offset, &found)
+	})
+	return found
+}
+
+func visitIdentifier(n ast.Node, offset int, found **ast.Identifier) bool {
+	if ident, ok := n.(*ast.Identifier); ok && ident.Pos().Offset <= offset && offset <= ident.End().Offset {
+		*found = ident
+	}
+	return true
+}
+
+// wordBefore returns the identifier characters right before offset.
+func (d *document) wordBefore(offset int) string {
+	start := offset
+	for start > 0 && isIdentifierByte(d.text[start-1]) {
+		start--
+	}
+	return d.text[start:offset]
+}
+
+// isIdentifierByte reports whether c can be part of an identifier.
+func isIdentifierByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// utf16Len returns the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// commentsAbove returns the text of the comments on the lines right above
+// the line of pos, with nothing else on them, joined by newlines.
+func (d *document) commentsAbove(pos token.Position) string {
+	var lines []string
+	line := pos.Line
+	for i := len(d.program.Comments) - 1; i >= 0; i-- {
+		c := d.program.Comments[i]
+		if c.Pos().Offset >= pos.Offset {
+			continue
+		}
+		if c.Pos().Line != line-1 || strings.TrimSpace(d.text[d.lines[c.Pos().Line-1]:c.Pos().Offset]) != "" {
+			break
+		}
+		lines = append([]string{c.Text()}, lines...)
+		line--
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,306 @@
+package lsp
+
+import (
+	"dot/ast"
+	"dot/check"
+	"dot/printer"
+	"dot/token"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func (s *Server) initialize(params json.RawMessage) (any, error) {
+	s.initialized = true
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync":           map[string]any{"openClose": true, "change": 1},
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"documentSymbolProvider":     true,
+			"completionProvider":         map[string]any{},
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]any{"name": "dot"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(params json.RawMessage) (any, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (any, error) {
+	var p DidOpenTextDocumentParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) (any, error) {
+	var p DidChangeTextDocumentParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	// the document is synchronized whole, so the last change is the text
+	return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(params json.RawMessage) (any, error) {
+	var p DidCloseTextDocumentParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+// update sets the text of the document at uri and publishes its
+// diagnostics.
+func (s *Server) update(uri, text string) error {
+	d := newDocument(uri, text)
+	s.documents[uri] = d
+	diagnostics := []Diagnostic{}
+	// programs run by the dot command are given args
+	for _, diag := range check.Source(uri, text, check.WithGlobals("args")) {
+		severity := SeverityWarning
+		if diag.Severity == check.Error {
+			severity = SeverityError
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    Range{Start: d.position(diag.Pos), End: d.position(diag.End)},
+			Severity: severity,
+			Code:     diag.Rule,
+			Source:   "dot",
+			Message:  diag.Message,
+		})
+	}
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// hover describes the builtin or variable under the cursor.
+func (s *Server) hover(params json.RawMessage) (any, error) {
+	d, ident, err := s.identifierAt(params)
+	if ident == nil {
+		return nil, err
+	}
+	var text string
+	if decl, ok := check.Definitions(d.program)[ident]; ok {
+		text = d.describe(decl)
+	} else if b, ok := builtins[ident.Value]; ok {
+		text = fmt.Sprintf("```dot\n%s\n```\n\n%s", b.signature, b.doc)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	r := d.rangeOf(ident)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}, nil
+}
+
+// describe returns a description of the variable declared by decl, in
+// markdown: how it is declared and the comments above its declaration.
+func (d *document) describe(decl *ast.Identifier) string {
+	var code, comments string
+	ast.Inspect(d.program, func(n ast.Node) bool {
+		if code != "" {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.ExportStatement:
+			if &n.Let.Identifier == decl {
+				code = "export " + d.describeLet(n.Let)
+				comments = d.commentsAbove(n.Pos())
+			}
+		case *ast.LetStatement:
+			if &n.Identifier == decl {
+				code = d.describeLet(n)
+				comments = d.commentsAbove(n.Pos())
+			}
+		case *ast.ImportStatement:
+			if n.Name == decl {
+				code = fmt.Sprintf("import %s as %s", d.text[n.Path.Pos().Offset:n.Path.End().Offset], decl.Value)
+				comments = d.commentsAbove(n.Pos())
+			}
+		case *ast.Function:
+			for _, param := range n.Parameters {
+				if param == decl {
+					code = fmt.Sprintf("%s // parameter of %s", decl.Value, signature(n))
+				}
+			}
+		case *ast.ForInStatement:
+			if n.Key == decl || n.Value == decl {
+				code = decl.Value + " // variable of a for-in loop"
+			}
+		case *ast.TryStatement:
+			if n.Parameter == decl {
+				code = decl.Value + " // error of a catch block"
+			}
+		}
+		return true
+	})
+	if code == "" {
+		// assigned without being declared
+		code = decl.Value + " // variable"
+	}
+	text := fmt.Sprintf("```dot\n%s\n```", code)
+	if comments != "" {
+		text += "\n\n" + comments
+	}
+	return text
+}
+
+// describeLet returns let and the name of the variable declared by let,
+// with its function's parameters or its value if it is short.
+func (d *document) describeLet(let *ast.LetStatement) string {
+	if function, ok := let.Value.(*ast.Function); ok {
+		return "let " + signature(function)
+	}
+	value := d.text[let.Value.Pos().Offset:let.Value.End().Offset]
+	if len(value) > 40 || strings.Contains(value, "\n") {
+		value = "…"
+	}
+	return fmt.Sprintf("let %s = %s", let.Identifier.Value, value)
+}
+
+// signature returns function as "fn name(a, b)", or "fn(a, b)" if it has
+// no name.
+func signature(function *ast.Function) string {
+	if function.Name == "" {
+		return "fn" + parameters(function)
+	}
+	return "fn " + function.Name + parameters(function)
+}
+
+// parameters returns the parameters of function as "(a, b)".
+func parameters(function *ast.Function) string {
+	names := make([]string, len(function.Parameters))
+	for i, param := range function.Parameters {
+		names[i] = param.Value
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+// definition returns the location of the declaration of the variable
+// under the cursor.
+func (s *Server) definition(params json.RawMessage) (any, error) {
+	d, ident, err := s.identifierAt(params)
+	if ident == nil {
+		return nil, err
+	}
+	decl, ok := check.Definitions(d.program)[ident]
+	if !ok {
+		return nil, nil
+	}
+	return &Location{URI: d.uri, Range: d.rangeOf(decl)}, nil
+}
+
+// identifierAt returns the document of a request about a position and the
+// identifier at the position, if any.
+func (s *Server) identifierAt(params json.RawMessage) (*document, *ast.Identifier, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, d.identifierAt(d.offset(p.Position)), nil
+}
+
+// documentSymbol lists the functions declared with let, or exported, at
+// the top level of a document.
+func (s *Server) documentSymbol(params json.RawMessage) (any, error) {
+	var p DocumentSymbolParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbols := []DocumentSymbol{}
+	for _, statement := range d.program.Statements {
+		let, _ := statement.(*ast.LetStatement)
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			let = export.Let
+		}
+		if let == nil {
+			continue
+		}
+		if function, ok := let.Value.(*ast.Function); ok {
+			symbols = append(symbols, DocumentSymbol{
+				Name:           let.Identifier.Value,
+				Detail:         "fn" + parameters(function),
+				Kind:           SymbolFunction,
+				Range:          d.rangeOf(statement),
+				SelectionRange: d.rangeOf(&let.Identifier),
+			})
+		}
+	}
+	return symbols, nil
+}
+
+// completion completes the word before the cursor to the keywords and
+// builtins starting with it.
+func (s *Server) completion(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	offset := d.offset(p.Position)
+	prefix := d.wordBefore(offset)
+	items := []CompletionItem{}
+	if start := offset - len(prefix); start > 0 && d.text[start-1] == '.' {
+		// a member of a module or hash
+		return items, nil
+	}
+	for keyword := range token.Keywords {
+		if strings.HasPrefix(keyword, prefix) {
+			items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+		}
+	}
+	for name, b := range builtins {
+		if strings.HasPrefix(name, prefix) {
+			items = append(items, CompletionItem{
+				Label:         name,
+				Kind:          CompletionFunction,
+				Detail:        b.signature,
+				Documentation: &MarkupContent{Kind: "markdown", Value: b.doc},
+			})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items, nil
+}
+
+// formatting returns an edit replacing a document with its text formatted
+// by dot fmt, no edits if it is formatted, or null if it does not parse.
+func (s *Server) formatting(params json.RawMessage) (any, error) {
+	var p DocumentFormattingParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	out, err := printer.Format(d.uri, []byte(d.text))
+	if err != nil {
+		return nil, nil
+	}
+	edits := []TextEdit{}
+	if string(out) != d.text {
+		edits = append(edits, TextEdit{Range: d.all(), NewText: string(out)})
+	}
+	return edits, nil
+}
@@ -0,0 +1,342 @@
+package lsp
+
+import (
+	"bufio"
+	"dot/eval"
+	"dot/token"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// client is a scripted client talking to a server run in the test.
+type client struct {
+	t             *testing.T
+	in            *bufio.Reader // what the server writes
+	out           io.Writer     // what the server reads
+	id            int
+	notifications []message // the notifications not yet taken
+	done          chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: bufio.NewReader(clientIn), out: clientOut, done: make(chan error, 1)}
+	go func() {
+		err := New(serverIn, serverOut).Run()
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) send(msg *message) {
+	c.t.Helper()
+	if err := writeMessage(c.out, msg); err != nil {
+		c.t.Fatalf("failed to send %s: %s", msg.Method, err)
+	}
+}
+
+func (c *client) read() message {
+	c.t.Helper()
+	body, err := readMessage(c.in)
+	if err != nil {
+		c.t.Fatalf("failed to read a message: %s", err)
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatalf("invalid message %s: %s", body, err)
+	}
+	return msg
+}
+
+// call sends a request and decodes the result of its response into
+// result, returning the error of the response.
+func (c *client) call(method string, params, result any) *responseError {
+	c.t.Helper()
+	c.id++
+	id, _ := json.Marshal(c.id)
+	c.send(&message{ID: id, Method: method, Params: marshal(c.t, params)})
+	for {
+		msg := c.read()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(msg.ID) != string(id) {
+			c.t.Fatalf("response to %s has id %s, want %s", method, msg.ID, id)
+		}
+		if msg.Error == nil && result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("invalid result of %s %s: %s", method, msg.Result, err)
+			}
+		}
+		return msg.Error
+	}
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	c.send(&message{Method: method, Params: marshal(c.t, params)})
+}
+
+// diagnostics returns the next diagnostics the server published.
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+	var msg message
+	if len(c.notifications) > 0 {
+		msg, c.notifications = c.notifications[0], c.notifications[1:]
+	} else {
+		msg = c.read()
+	}
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("got %s, want diagnostics", msg.Method)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params
+}
+
+func marshal(t *testing.T, v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+const uri = "file:///work/main.dot"
+
+const source = `import "lib.dot" as lib
+
+// add returns the sum of a and b.
+let add = fn(a, b) { a + b }
+let total = add(1, len([2, 3]))
+export let   twice=fn(x){add(x,x)}
+print(totl)
+`
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{line, character}}
+}
+
+func TestSession(t *testing.T) {
+	c := newClient(t)
+	var init struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	if err := c.call("initialize", map[string]any{"capabilities": map[string]any{}}, &init); err != nil {
+		t.Fatalf("initialize failed: %s", err)
+	}
+	for _, capability := range []string{"hoverProvider", "definitionProvider", "documentSymbolProvider", "completionProvider", "documentFormattingProvider"} {
+		if init.Capabilities[capability] == nil {
+			t.Errorf("the server does not have %s", capability)
+		}
+	}
+	c.notify("initialized", map[string]any{})
+
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "dot", Version: 1, Text: source}})
+	expectedDiagnostics := []Diagnostic{
+		{Range: Range{Position{0, 20}, Position{0, 23}}, Severity: SeverityWarning, Code: "unused", Source: "dot", Message: "lib imported and not used"},
+		{Range: Range{Position{6, 6}, Position{6, 10}}, Severity: SeverityError, Code: "undefined", Source: "dot", Message: "identifier not found: totl"},
+	}
+	if got := c.diagnostics(); got.URI != uri || !reflect.DeepEqual(got.Diagnostics, expectedDiagnostics) {
+		t.Errorf("wrong diagnostics.\nexpected=%+v\ngot=%+v", expectedDiagnostics, got)
+	}
+
+	hovers := []struct {
+		position TextDocumentPositionParams
+		expected string
+	}{
+		{at(4, 20), "```dot\nlen(x)\n```\n\nReturns the number of characters of a string, or of elements of an array, hash or range."},
+		{at(4, 12), "```dot\nlet fn add(a, b)\n```\n\nadd returns the sum of a and b."},
+		{at(3, 21), "```dot\na // parameter of fn add(a, b)\n```"},
+		{at(4, 5), "```dot\nlet total = add(1, len([2, 3]))\n```"},
+		{at(5, 13), "```dot\nexport let fn twice(x)\n```"},
+		{at(0, 21), "```dot\nimport \"lib.dot\" as lib\n```"},
+		{at(6, 8), ""},
+		{at(4, 0), ""},
+	}
+	for i, tt := range hovers {
+		var hover *Hover
+		if err := c.call("textDocument/hover", tt.position, &hover); err != nil {
+			t.Fatalf("tests[%d] - hover failed: %s", i, err)
+		}
+		got := ""
+		if hover != nil {
+			got = hover.Contents.Value
+		}
+		if got != tt.expected {
+			t.Errorf("tests[%d] - wrong hover at %v.\nexpected=%q\ngot=%q", i, tt.position.Position, tt.expected, got)
+		}
+	}
+
+	definitions := []struct {
+		position TextDocumentPositionParams
+		expected *Range
+	}{
+		{at(4, 12), &Range{Position{3, 4}, Position{3, 7}}},
+		{at(3, 22), &Range{Position{3, 13}, Position{3, 14}}},
+		{at(5, 29), &Range{Position{5, 22}, Position{5, 23}}},
+		{at(4, 20), nil},
+	}
+	for i, tt := range definitions {
+		var location *Location
+		if err := c.call("textDocument/definition", tt.position, &location); err != nil {
+			t.Fatalf("tests[%d] - definition failed: %s", i, err)
+		}
+		var got *Range
+		if location != nil {
+			got = &location.Range
+			if location.URI != uri {
+				t.Errorf("tests[%d] - wrong uri %q", i, location.URI)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("tests[%d] - wrong definition at %v.\nexpected=%v\ngot=%v", i, tt.position.Position, tt.expected, got)
+		}
+	}
+
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols); err != nil {
+		t.Fatalf("documentSymbol failed: %s", err)
+	}
+	expectedSymbols := []DocumentSymbol{
+		{Name: "add", Detail: "fn(a, b)", Kind: SymbolFunction, Range: Range{Position{3, 0}, Position{3, 28}}, SelectionRange: Range{Position{3, 4}, Position{3, 7}}},
+		{Name: "twice", Detail: "fn(x)", Kind: SymbolFunction, Range: Range{Position{5, 0}, Position{5, 34}}, SelectionRange: Range{Position{5, 13}, Position{5, 18}}},
+	}
+	if !reflect.DeepEqual(symbols, expectedSymbols) {
+		t.Errorf("wrong symbols.\nexpected=%+v\ngot=%+v", expectedSymbols, symbols)
+	}
+
+	completions := []struct {
+		position TextDocumentPositionParams
+		expected []string
+	}{
+		{at(4, 21), []string{"len", "let"}},
+		{at(6, 7), []string{"throw", "trim", "true", "try"}},
+		{at(6, 8), nil},
+	}
+	for i, tt := range completions {
+		var items []CompletionItem
+		if err := c.call("textDocument/completion", tt.position, &items); err != nil {
+			t.Fatalf("tests[%d] - completion failed: %s", i, err)
+		}
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Label)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("tests[%d] - wrong completions at %v.\nexpected=%q\ngot=%q", i, tt.position.Position, tt.expected, got)
+		}
+	}
+
+	var edits []TextEdit
+	if err := c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits); err != nil {
+		t.Fatalf("formatting failed: %s", err)
+	}
+	formatted := strings.Replace(source, "export let   twice=fn(x){add(x,x)}", "export let twice = fn(x) { add(x, x) }", 1)
+	expectedEdits := []TextEdit{{Range: Range{Position{0, 0}, Position{7, 0}}, NewText: formatted}}
+	if !reflect.DeepEqual(edits, expectedEdits) {
+		t.Errorf("wrong edits.\nexpected=%+v\ngot=%+v", expectedEdits, edits)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: uri},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = (1"}},
+	})
+	expectedDiagnostics = []Diagnostic{
+		{Range: Range{Position{0, 10}, Position{0, 10}}, Severity: SeverityError, Code: "syntax", Source: "dot", Message: "expected ')'"},
+	}
+	if got := c.diagnostics(); !reflect.DeepEqual(got.Diagnostics, expectedDiagnostics) {
+		t.Errorf("wrong diagnostics after a change.\nexpected=%+v\ngot=%+v", expectedDiagnostics, got.Diagnostics)
+	}
+	edits = []TextEdit{{}}
+	if err := c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits); err != nil {
+		t.Fatalf("formatting failed: %s", err)
+	}
+	if edits != nil {
+		t.Errorf("a document that does not parse was formatted: %+v", edits)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if got := c.diagnostics(); len(got.Diagnostics) != 0 {
+		t.Errorf("the diagnostics of a closed document were not cleared: %+v", got)
+	}
+	if err := c.call("textDocument/hover", at(0, 0), nil); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("hover in a closed document did not fail: %v", err)
+	}
+
+	if err := c.call("shutdown", nil, nil); err != nil {
+		t.Fatalf("shutdown failed: %s", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("the server failed: %s", err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	c := newClient(t)
+	if err := c.call("textDocument/hover", at(0, 0), nil); err == nil || err.Code != codeNotInitialized {
+		t.Errorf("a request before initialize did not fail: %v", err)
+	}
+	c.call("initialize", map[string]any{}, nil)
+	if err := c.call("workspace/symbol", map[string]any{}, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("an unknown method did not fail: %v", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err == nil {
+		t.Errorf("exiting without shutting down did not fail")
+	}
+}
+
+func TestPositions(t *testing.T) {
+	d := newDocument(uri, "let s = \"é😀\"\nlet t = s\n")
+	tests := []struct {
+		offset   int
+		expected Position
+	}{
+		{0, Position{0, 0}},
+		{9, Position{0, 9}},
+		{11, Position{0, 10}},
+		{15, Position{0, 12}},
+		{16, Position{0, 13}},
+		{17, Position{1, 0}},
+		{25, Position{1, 8}},
+		{len(d.text), Position{2, 0}},
+	}
+	for i, tt := range tests {
+		got := d.position(token.Position{Offset: tt.offset})
+		if got != tt.expected {
+			t.Errorf("tests[%d] - wrong position of offset %d. expected=%v, got=%v", i, tt.offset, tt.expected, got)
+		}
+		if offset := d.offset(got); offset != tt.offset {
+			t.Errorf("tests[%d] - wrong offset of %v. expected=%d, got=%d", i, got, tt.offset, offset)
+		}
+	}
+	if offset := d.offset(Position{0, 100}); offset != 16 {
+		t.Errorf("a position past the end of its line has offset %d, want 16", offset)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	for name := range eval.Builtins() {
+		if _, ok := builtins[name]; !ok {
+			t.Errorf("builtin %s is not documented", name)
+		}
+	}
+	for name := range builtins {
+		if _, ok := eval.Builtins()[name]; !ok {
+			t.Errorf("%s is documented but is not a builtin", name)
+		}
+	}
+}
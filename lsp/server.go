@@ -0,0 +1,152 @@
+// Package lsp implements a Language Server Protocol server for Dot, which
+// editors run to check, navigate and format Dot files as they are edited.
+//
+// The server speaks JSON-RPC over a pair of streams, usually the standard
+// input and output of the dot lsp command. It keeps the text of the files
+// the editor has open, sent whole on every change, and answers from their
+// syntax trees: it publishes the diagnostics of the checker, describes
+// builtins and variables on hover, goes to the declaration of a variable,
+// lists the functions a file declares at the top level, completes keywords
+// and builtins and formats files as dot fmt does.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Server is a language server talking to one client.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents   map[string]*document // the open documents by URI
+	initialized bool
+	shutdown    bool
+}
+
+// New returns a server reading messages from in and writing them to out.
+func New(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, documents: make(map[string]*document)}
+}
+
+// handler answers a request or handles a notification. The result of a
+// notification is ignored.
+type handler func(s *Server, params json.RawMessage) (any, error)
+
+var handlers = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"initialized":                 nil,
+	"shutdown":                    (*Server).shutdownRequest,
+	"textDocument/didOpen":        (*Server).didOpen,
+	"textDocument/didChange":      (*Server).didChange,
+	"textDocument/didClose":       (*Server).didClose,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/formatting":     (*Server).formatting,
+}
+
+// Run serves the client until it sends the exit notification or closes
+// the input. It returns nil if the client asked the server to shut down
+// before exiting, and an error otherwise.
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return errors.New("the client closed the connection without exiting")
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.respond(json.RawMessage("null"), nil, &responseError{codeParseError, err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("the client exited without shutting the server down")
+			}
+			return nil
+		}
+		if msg.Method == "" {
+			// a response, though the server sends no requests
+			continue
+		}
+		if err := s.handle(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles a request or a notification, and answers a request.
+func (s *Server) handle(msg *message) error {
+	isRequest := msg.ID != nil
+	var result any
+	var rerr *responseError
+	h, ok := handlers[msg.Method]
+	switch {
+	case !s.initialized && msg.Method != "initialize":
+		rerr = &responseError{codeNotInitialized, "the server is not initialized"}
+	case s.shutdown:
+		rerr = &responseError{codeInvalidRequest, "the server is shut down"}
+	case !ok:
+		rerr = &responseError{codeMethodNotFound, fmt.Sprintf("method not found: %s", msg.Method)}
+	case h != nil:
+		var err error
+		result, err = h(s, msg.Params)
+		if err != nil && !errors.As(err, &rerr) {
+			rerr = &responseError{codeInvalidParams, err.Error()}
+		}
+	}
+	if !isRequest {
+		// notifications are never answered, not even with an error
+		return nil
+	}
+	return s.respond(msg.ID, result, rerr)
+}
+
+func (s *Server) respond(id json.RawMessage, result any, rerr *responseError) error {
+	msg := &message{ID: id, Error: rerr}
+	if rerr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = raw
+	}
+	return writeMessage(s.out, msg)
+}
+
+// notify sends the client a notification.
+func (s *Server) notify(method string, params any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: raw})
+}
+
+// unmarshal decodes the params of a message into v.
+func unmarshal(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+// document returns the open document at uri.
+func (s *Server) document(uri string) (*document, error) {
+	d, ok := s.documents[uri]
+	if !ok {
+		return nil, &responseError{codeInvalidParams, fmt.Sprintf("document not open: %s", uri)}
+	}
+	return d, nil
+}
@@ -1,64 +1,251 @@
 package main
 
 import (
-	"bufio"
-	"dot/eval"
+	"dot/interp"
 	"dot/lexer"
 	"dot/object"
 	"dot/parser"
+	"dot/repl"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 )
 
+// The exit statuses of dot, besides those programs pass to exit.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the program did not parse or failed at runtime
+	exitUsage   = 2 // the command line was wrong
+)
+
+const usage = `Usage:
+  dot [flags] [run] <file> [args...]   run a program
+  dot [flags] - [args...]              run a program read from stdin
+  dot [flags] -e <code> [args...]      run code and print its value
+  dot [flags] repl                     start the interactive prompt
+  dot fmt [-check] [path...]           format programs, see dot fmt -h
+  dot check [-json] [path...]          find likely mistakes in programs, see dot check -h
+  dot lsp                              serve the Language Server Protocol to an editor
+
+Programs find the arguments after the file or code in the array args.
+
+Flags:
+`
+
 func main() {
-	if os.Args[1] == "repl" {
-		startRepl()
-		return
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// cli is a run of the dot command.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+
+	flags *flag.FlagSet
+	useVM bool
+	code  *string // nil unless -e is given, as the code may be empty
+	// capabilities holds the options set by -allow and -deny
+	capabilities []interp.Option
+}
+
+// run runs the dot command with the command-line arguments args and returns
+// its exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	c.flags = flag.NewFlagSet("dot", flag.ContinueOnError)
+	c.flags.SetOutput(stderr)
+	c.flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		c.flags.PrintDefaults()
+	}
+	c.flags.BoolVar(&c.useVM, "vm", false, "run programs on the bytecode virtual machine instead of the tree-walking evaluator")
+	c.flags.Func("e", "run `code` given on the command line and print its value", func(code string) error {
+		c.code = &code
+		return nil
+	})
+	c.flags.Func("allow", "allow only the comma-separated `capabilities` (io, fs, env, time, process)", func(list string) error {
+		caps, err := parseCapabilities(list)
+		c.capabilities = append(c.capabilities, interp.WithCapabilities(caps...))
+		return err
+	})
+	c.flags.Func("deny", "deny the comma-separated `capabilities`", func(list string) error {
+		caps, err := parseCapabilities(list)
+		c.capabilities = append(c.capabilities, interp.WithoutCapabilities(caps...))
+		return err
+	})
+
+	if err := c.flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	args = c.flags.Args()
+	if c.code != nil {
+		return c.runSource("<code>", *c.code, args, true)
 	}
-	filename := os.Args[1]
-	if filename == "" {
-		fmt.Printf("Usage: %s <filename>\n", filename)
+	if len(args) > 0 && args[0] == "repl" {
+		return c.repl()
 	}
-	content, err := os.ReadFile(filename)
+	if len(args) > 0 && args[0] == "fmt" {
+		return c.format(args[1:])
+	}
+	if len(args) > 0 && args[0] == "check" {
+		return c.check(args[1:])
+	}
+	if len(args) > 0 && args[0] == "lsp" {
+		return c.lsp(args[1:])
+	}
+	if len(args) > 0 && args[0] == "run" {
+		// flags may also follow the subcommand
+		if err := c.flags.Parse(args[1:]); err != nil {
+			return flagError(err)
+		}
+		if args = c.flags.Args(); len(args) == 0 {
+			fmt.Fprintln(stderr, "dot run: missing file")
+			return exitUsage
+		}
+	}
+	switch {
+	case len(args) == 0 && isTerminal(stdin):
+		c.flags.Usage()
+		return exitUsage
+	case len(args) == 0:
+		return c.runStdin(nil)
+	case args[0] == "-":
+		return c.runStdin(args[1:])
+	}
+	src, err := os.ReadFile(args[0])
 	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	contentStr := string(content)
-	lexer := lexer.NewLexer(contentStr)
-	parser := parser.NewParser(lexer)
-	program := parser.ParseProgram()
-	parser.PrintErrors()
-	// fmt.Println(program.String())
-	env := object.NewEnvironment()
-	evaluated := eval.Eval(program, env, *lexer)
-	fmt.Print(evaluated.String())
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	return c.runSource(args[0], string(src), args[1:], false)
 }
 
-func startRepl() {
-	in := os.Stdin
-	out := os.Stdout
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	fmt.Println("Welcome to Dot programming language")
-	fmt.Println("Type '.exit' to exit")
-	for {
-		fmt.Print(">> ")
-		scanned := scanner.Scan()
-		if !scanned {
-			return
-		}
-		line := scanner.Text()
-		if line == ".exit" {
-			return
+func parseCapabilities(list string) ([]object.Capability, error) {
+	caps, unknown := object.ParseCapabilities(list)
+	if unknown != "" {
+		return nil, fmt.Errorf("unknown capability %q", unknown)
+	}
+	return caps, nil
+}
+
+// flagError returns the exit status for an error parsing flags, which the
+// flag package has already reported.
+func flagError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// eachFile calls fn for each file in paths and for the .dot files in the
+// directories among them, and reports whether fn returned true for all of
+// them.
+func (c *cli) eachFile(paths []string, fn func(file string) bool) bool {
+	ok := true
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || file != path && filepath.Ext(file) != ".dot" {
+				return nil
+			}
+			ok = fn(file) && ok
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			ok = false
 		}
-		lexer := lexer.NewLexer(line)
-		parser := parser.NewParser(lexer)
-		program := parser.ParseProgram()
-		parser.PrintErrors()
-		evaluated := eval.Eval(program, env, *lexer)
-		if evaluated != nil {
-			fmt.Fprintln(out, evaluated.String())
+	}
+	return ok
+}
+
+// isTerminal reports whether r is a terminal rather than a pipe or a file.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// options returns the options selecting the streams, the engine and the
+// capabilities given on the command line.
+func (c *cli) options() []interp.Option {
+	opts := append([]interp.Option{}, c.capabilities...)
+	opts = append(opts, interp.WithStdout(c.stdout), interp.WithStderr(c.stderr), interp.WithStdin(c.stdin))
+	if c.useVM {
+		opts = append(opts, interp.WithVM())
+	}
+	return opts
+}
+
+func (c *cli) runStdin(args []string) int {
+	src, err := io.ReadAll(c.stdin)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+	return c.runSource("<stdin>", string(src), args, false)
+}
+
+// runSource runs the program src read from the file called name, with args
+// as its arguments, and prints its value if printValue is set.
+func (c *cli) runSource(name string, src string, args []string, printValue bool) int {
+	p := parser.NewParser(lexer.NewFileLexer(name, src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(c.stderr, "%s: %s\n", name, err)
 		}
+		return exitFailure
+	}
+	in := interp.New(c.options()...)
+	scriptArgs := make([]any, len(args))
+	for i, arg := range args {
+		scriptArgs[i] = arg
+	}
+	if err := in.Set("args", scriptArgs); err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+	result, err := in.Eval(program)
+	if err != nil {
+		return c.exitStatus(err)
+	}
+	// print and the like return null or an empty string, which are left out
+	if printValue && result.Type() != object.NULL_OBJ && result.String() != "" {
+		fmt.Fprintln(c.stdout, result.String())
+	}
+	return exitOK
+}
+
+func (c *cli) repl() int {
+	r := repl.New(c.stdin, c.stdout, c.options()...)
+	return c.exitStatus(r.Run())
+}
+
+// exitStatus reports err, if the program ended with one, and returns the
+// exit status for it: the status passed to exit if the program called it.
+// A runtime error is printed with its traceback.
+func (c *cli) exitStatus(err error) int {
+	var exit *interp.ExitError
+	var runtimeErr *object.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &exit):
+		return exit.Code
+	case errors.As(err, &runtimeErr):
+		fmt.Fprintln(c.stderr, runtimeErr.Traceback())
+	default:
+		fmt.Fprintln(c.stderr, err)
 	}
+	return exitFailure
 }
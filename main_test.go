@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.dot")
+	if err := os.WriteFile(script, []byte(`print(len(args), args)`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.dot")
+	if err := os.WriteFile(broken, []byte("let x = 1\nlet = 2\nprint(x)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	messy := filepath.Join(dir, "messy.dot")
+	if err := os.WriteFile(messy, []byte("let x=[1,2]  // numbers"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{script, "a", "b"}, "", 0, "2\n[a, b]\n", ""},
+		{[]string{"run", "-vm", script, "-x"}, "", 0, "1\n[-x]\n", ""},
+		{[]string{"-e", "len(args) * 10", "a"}, "", 0, "10\n", ""},
+		{[]string{"-e", `print("hi")`}, "", 0, "hi\n", ""},
+		// the code is run even if it is empty, rather than the standard input
+		{[]string{"-e", ""}, `print("stdin")`, 0, "", ""},
+		{[]string{"-", "a"}, `print(args[0] + "!")`, 0, "a!\n", ""},
+		{nil, "exit(7)", 7, "", ""},
+		{[]string{"-vm", "-e", `print(1); exit(3); print(2)`}, "", 3, "1\n", ""},
+		{[]string{broken}, "", 1, "", broken + ": expected identifier after 'let' - at line 2, column 5\n"},
+		{[]string{"-e", `1 + "a"`}, "", 1, "", "Traceback (most recent call last):\n  at <code>, line 1, column 1, in <main>\nTypeError: type mismatch: INTEGER + STRING\n"},
+		{[]string{"-deny", "process", "-e", "exit(1)"}, "", 1, "", "PermissionError: `exit` needs the process capability, which is denied\n"},
+		{[]string{filepath.Join(dir, "missing.dot")}, "", 1, "", "no such file or directory\n"},
+		{[]string{"run"}, "", 2, "", "dot run: missing file\n"},
+		{[]string{"-allow", "disk", script}, "", 2, "", `unknown capability "disk"`},
+		{[]string{"repl"}, "let x = 2\nexit(x)\nprint(1)\n", 2, ">> 2\n>> ", ""},
+		{[]string{"fmt"}, "let f=fn(x){x*2}", 0, "let f = fn(x) { x * 2 }\n", ""},
+		{[]string{"fmt", "-check", script, messy}, "", 1, messy + "\n", ""},
+		{[]string{"fmt", messy}, "", 0, "", ""},
+		{[]string{"fmt", "-check", messy}, "", 0, "", ""},
+		{[]string{"fmt", broken}, "", 1, "", broken + ": expected identifier after 'let' - at line 2, column 5\n"},
+		{[]string{"check", script}, "", 0, "", ""},
+		{[]string{"check"}, "let f = fn(a) { a + b }\nf()", 1, "<stdin>:1:21: error: identifier not found: b (undefined)\n<stdin>:2:1: error: not enough arguments in call to f: want 1, got 0 (arguments)\n", ""},
+		{[]string{"check", "-severity", "undefined=off", "-json", "-"}, "len(x)", 0, "[]\n", ""},
+		{[]string{"check", "-severity", "unused=never"}, "", 2, "", `unknown severity "never"`},
+		{[]string{"lsp", "--stdio"}, lspMessages(`{"id":1,"method":"initialize","params":{}}`, `{"id":2,"method":"shutdown"}`, `{"method":"exit"}`), 0, `{"jsonrpc":"2.0","id":2,"result":null}`, ""},
+		{[]string{"lsp"}, "", 1, "", "dot lsp: the client closed the connection without exiting\n"},
+	}
+
+	for i, tt := range tests {
+		var stdout, stderr strings.Builder
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		if code != tt.code {
+			t.Errorf("tests[%d] - %q exited with %d, want %d (stderr %q)", i, tt.args, code, tt.code, stderr.String())
+		}
+		if !strings.HasSuffix(stdout.String(), tt.stdout) || (tt.stdout == "" && stdout.Len() > 0) {
+			t.Errorf("tests[%d] - %q printed %q, want %q", i, tt.args, stdout.String(), tt.stdout)
+		}
+		if !strings.Contains(stderr.String(), tt.stderr) || (tt.stderr == "" && stderr.Len() > 0) {
+			t.Errorf("tests[%d] - %q reported %q, want %q", i, tt.args, stderr.String(), tt.stderr)
+		}
+	}
+
+	if src, err := os.ReadFile(messy); err != nil || string(src) != "let x = [1, 2] // numbers\n" {
+		t.Errorf("dot fmt wrote %q (%v)", src, err)
+	}
+}
+
+// lspMessages frames the bodies of JSON-RPC messages for dot lsp.
+func lspMessages(bodies ...string) string {
+	var out string
+	for _, body := range bodies {
+		body = `{"jsonrpc":"2.0",` + body[1:]
+		out += fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ANY_OBJ matches an argument of any type in the parameter types given to
+// CheckArgs and NewBuiltin.
+const ANY_OBJ = "ANY"
+
+// The helpers below check the arguments of builtin functions, so that all
+// builtins, including those registered by host programs, report wrong
+// arguments the same way.
+
+// CheckArity returns an ArgumentError unless there are between min and max
+// args. A negative max allows any number above min.
+func CheckArity(args []Object, min, max int) *Error {
+	if len(args) >= min && (max < 0 || len(args) <= max) {
+		return nil
+	}
+	var want string
+	switch {
+	case min == max:
+		want = fmt.Sprint(min)
+	case max < 0:
+		want = fmt.Sprintf("at least %d", min)
+	default:
+		want = fmt.Sprintf("%d to %d", min, max)
+	}
+	return NewError(ArgumentError, "wrong number of arguments: want=%s, got=%d", want, len(args))
+}
+
+// CheckType returns a TypeError unless arg has one of types. name is the
+// name of the builtin arg was passed to.
+func CheckType(name string, arg Object, types ...ObjectType) *Error {
+	for _, t := range types {
+		if t == ANY_OBJ || arg.Type() == t {
+			return nil
+		}
+	}
+	want := make([]string, len(types))
+	for i, t := range types {
+		want[i] = string(t)
+	}
+	if len(want) > 1 {
+		want = append(want[:len(want)-2], want[len(want)-2]+" or "+want[len(want)-1])
+	}
+	return NewError(TypeError, "argument to `%s` must be %s, got %s", name, strings.Join(want, ", "), arg.Type())
+}
+
+// CheckArgs checks that there is one argument for every one of types and
+// that each has its type, returning the ArgumentError or TypeError for the
+// first that does not.
+func CheckArgs(name string, args []Object, types ...ObjectType) *Error {
+	if err := CheckArity(args, len(types), len(types)); err != nil {
+		return err
+	}
+	for i, arg := range args {
+		if err := CheckType(name, arg, types[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewBuiltin returns a builtin named name that checks its arguments against
+// types with CheckArgs before calling fn, so fn can assume it has them.
+func NewBuiltin(name string, fn BuiltinFn, types ...ObjectType) *Builtin {
+	return &Builtin{Name: name, Fn: func(rt *Runtime, args ...Object) Object {
+		if err := CheckArgs(name, args, types...); err != nil {
+			return err
+		}
+		return fn(rt, args...)
+	}}
+}
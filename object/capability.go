@@ -0,0 +1,65 @@
+package object
+
+import "strings"
+
+// Capability names a group of builtins that reach outside the program, so
+// that a host running code it does not trust can deny them. Builtins with
+// no capability only compute values and are always allowed.
+type Capability string
+
+const (
+	// CapIO covers the standard streams: print and ask.
+	CapIO Capability = "io"
+	// CapFS covers reading and writing files.
+	CapFS Capability = "fs"
+	// CapEnv covers the environment variables of the process.
+	CapEnv Capability = "env"
+	// CapTime covers reading the clock.
+	CapTime Capability = "time"
+	// CapProcess covers controlling the running process.
+	CapProcess Capability = "process"
+)
+
+// Capabilities lists every capability.
+var Capabilities = []Capability{CapIO, CapFS, CapEnv, CapTime, CapProcess}
+
+// ParseCapabilities parses a comma-separated list of capability names, as
+// given on the command line, returning the first unknown name if there is
+// one.
+func ParseCapabilities(list string) ([]Capability, string) {
+	var caps []Capability
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, c := range Capabilities {
+			if string(c) == name {
+				caps = append(caps, c)
+				known = true
+			}
+		}
+		if !known {
+			return nil, name
+		}
+	}
+	return caps, ""
+}
+
+// Permit returns a PermissionError if fn needs a capability rt denies.
+func (rt *Runtime) Permit(fn *Builtin) *Error {
+	if fn.Capability == "" {
+		return nil
+	}
+	return rt.require(fn.Capability, "`"+fn.Name+"`")
+}
+
+// require returns a PermissionError saying that what needs c if rt denies
+// it.
+func (rt *Runtime) require(c Capability, what string) *Error {
+	if !rt.Denied[c] {
+		return nil
+	}
+	return NewError(PermissionError, "%s needs the %s capability, which is denied", what, c)
+}
@@ -3,28 +3,112 @@ package object
 type Environment struct {
 	Store map[string]Object
 	Outer *Environment
+
+	// Slots holds the variables numbered by Number, which are not in
+	// Store; a nil slot is a variable that is not defined.
+	Slots   []Object
+	names   []string
+	numbers map[string]int
+
+	runtime *Runtime
 }
 
+// NewEnvironment returns a global environment with a runtime of its own,
+// using the standard streams, so that programs run in separate
+// environments share no state.
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{Store: s, Outer: nil}
+	return NewRuntimeEnvironment(NewRuntime())
+}
+
+// NewRuntimeEnvironment returns a global environment whose programs use rt.
+func NewRuntimeEnvironment(rt *Runtime) *Environment {
+	return &Environment{Store: make(map[string]Object), runtime: rt}
+}
+
+// Runtime returns the runtime of the outermost environment.
+func (e *Environment) Runtime() *Runtime {
+	return e.runtime
+}
+
+// Number keeps the variable called names[i] in Slots[i] from now on, moving
+// it out of Store, for compiled code that refers to variables by number.
+// The names numbered by earlier calls must start names, as they do for a
+// compiler that only adds to the names it has numbered.
+func (e *Environment) Number(names []string) {
+	if len(names) <= len(e.names) {
+		return
+	}
+	if e.numbers == nil {
+		e.numbers = make(map[string]int)
+	}
+	for _, name := range names[len(e.names):] {
+		val := e.Store[name]
+		delete(e.Store, name)
+		e.numbers[name] = len(e.Slots)
+		e.Slots = append(e.Slots, val)
+	}
+	e.names = append(e.names, names[len(e.names):]...)
+}
+
+// SlotName returns the name of the variable kept in Slots[i].
+func (e *Environment) SlotName(i int) string {
+	return e.names[i]
+}
+
+// Names returns the names of the variables defined in e, not counting
+// those of enclosing environments, in no particular order.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.Store)+len(e.Slots))
+	for name := range e.Store {
+		names = append(names, name)
+	}
+	for i, val := range e.Slots {
+		if val != nil {
+			names = append(names, e.names[i])
+		}
+	}
+	return names
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.Store[name]
+	obj, ok := e.lookup(name)
 	if !ok && e.Outer != nil {
 		obj, ok = e.Outer.Get(name)
 	}
 	return obj, ok
 }
 
+// lookup returns the variable name defined in e itself.
+func (e *Environment) lookup(name string) (Object, bool) {
+	if i, ok := e.numbers[name]; ok {
+		return e.Slots[i], e.Slots[i] != nil
+	}
+	obj, ok := e.Store[name]
+	return obj, ok
+}
+
 func (e *Environment) Set(name string, val Object) Object {
-	e.Store[name] = val
+	if i, ok := e.numbers[name]; ok {
+		e.Slots[i] = val
+	} else {
+		e.Store[name] = val
+	}
 	return val
 }
 
+// Assign rebinds name in the innermost environment that already defines it
+// and reports whether there was one.
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.Outer {
+		if _, ok := env.lookup(name); ok {
+			env.Set(name, val)
+			return true
+		}
+	}
+	return false
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.Outer = outer
-	return env
+	// enclosed environments share the runtime of the outermost one
+	return &Environment{Store: make(map[string]Object), Outer: outer, runtime: outer.runtime}
 }
@@ -0,0 +1,140 @@
+package object
+
+import (
+	"dot/token"
+	"fmt"
+	"strings"
+)
+
+// ErrorKind classifies runtime errors.
+type ErrorKind string
+
+const (
+	RuntimeError  ErrorKind = "RuntimeError"
+	TypeError     ErrorKind = "TypeError"
+	NameError     ErrorKind = "NameError"
+	IndexError    ErrorKind = "IndexError"
+	ArgumentError ErrorKind = "ArgumentError"
+	ValueError    ErrorKind = "ValueError"
+	// ZeroDivisionError is raised by dividing by zero, whether the numbers
+	// are integers or floats.
+	ZeroDivisionError ErrorKind = "ZeroDivisionError"
+	// LimitError is raised when a program exceeds one of the limits of
+	// its runtime or its context is cancelled.
+	LimitError ErrorKind = "LimitError"
+	// ImportError is raised by an import that cannot load its module.
+	ImportError ErrorKind = "ImportError"
+	// PermissionError is raised by calling a builtin whose capability the
+	// runtime denies.
+	PermissionError ErrorKind = "PermissionError"
+	// ExitError is raised by exit to end the program.
+	ExitError ErrorKind = "ExitError"
+	// UserError is the kind of errors raised by throw unless the thrown
+	// value names another one.
+	UserError ErrorKind = "Error"
+)
+
+// Error is a runtime error. Pos and End span the node that failed; Stack
+// holds the Dot function calls that were active, outermost first.
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Pos     token.Position
+	End     token.Position
+	Stack   []StackFrame
+	// frames holds Stack after start unused frames, left free for the
+	// frames PushFrame adds
+	frames []StackFrame
+	start  int
+}
+
+// StackFrame is a call of the function named Function made at Pos.
+type StackFrame struct {
+	Function string
+	Pos      token.Position
+}
+
+// NewError returns an error that does not know where it happened yet; the
+// evaluator fills in the position of the node that produced it.
+func NewError(kind ErrorKind, format string, a ...any) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// PushFrame adds frame to Stack as the outermost call. It keeps room in
+// front of the frames, so that an error travelling up a deep recursion
+// gets all its frames in linear time.
+func (e *Error) PushFrame(frame StackFrame) {
+	n := len(e.Stack)
+	if e.start == 0 || n != len(e.frames)-e.start || n > 0 && &e.Stack[0] != &e.frames[e.start] {
+		// Stack was set or copied elsewhere
+		e.frames = make([]StackFrame, 2*n+2)
+		e.start = len(e.frames) - n
+		copy(e.frames[e.start:], e.Stack)
+	}
+	e.start--
+	e.frames[e.start] = frame
+	e.Stack = e.frames[e.start:]
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+
+func (e *Error) String() string {
+	if !e.Pos.IsValid() {
+		return string(e.Kind) + ": " + e.Message
+	}
+	return string(e.Kind) + ": " + e.Message + " - " + fmt.Sprintf("at line %d, column %d", e.Pos.Line, e.Pos.Column)
+}
+
+func (e *Error) Error() string {
+	return e.String()
+}
+
+// Traceback formats the error with the calls that led to it, most recent
+// call last. Runs of identical calls, as left by deep recursion, are shown
+// once.
+func (e *Error) Traceback() string {
+	if !e.Pos.IsValid() {
+		return e.String()
+	}
+	var lines []string
+	function := "<main>"
+	for _, frame := range e.Stack {
+		// a call made by a host program has no position in Dot code
+		if frame.Pos.IsValid() {
+			lines = append(lines, fmt.Sprintf("  at %s, in %s", location(frame.Pos), function))
+		}
+		function = frame.Function
+	}
+	lines = append(lines, fmt.Sprintf("  at %s, in %s", location(e.Pos), function))
+
+	var out strings.Builder
+	out.WriteString("Traceback (most recent call last):\n")
+	for i := 0; i < len(lines); {
+		n := 1
+		for i+n < len(lines) && lines[i+n] == lines[i] {
+			n++
+		}
+		out.WriteString(lines[i] + "\n")
+		if n > 1 {
+			fmt.Fprintf(&out, "  [previous line repeated %d more times]\n", n-1)
+		}
+		i += n
+	}
+	out.WriteString(string(e.Kind) + ": " + e.Message)
+	return out.String()
+}
+
+// FunctionName returns how a function bound to name is shown in tracebacks.
+func FunctionName(name string) string {
+	if name == "" {
+		return "<anonymous>"
+	}
+	return name
+}
+
+func location(pos token.Position) string {
+	if pos.File == "" {
+		return fmt.Sprintf("line %d, column %d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s, line %d, column %d", pos.File, pos.Line, pos.Column)
+}
@@ -0,0 +1,85 @@
+package object
+
+import (
+	"hash/fnv"
+	"math/big"
+	"strconv"
+)
+
+// Integer is a whole number of any size. Values that fit in 64 bits are
+// held in Value and Big is nil; larger ones are held in Big. Integers made
+// from a big.Int should come from NewBigInteger, which keeps to this.
+type Integer struct {
+	Value int64
+	Big   *big.Int
+}
+
+// NewBigInteger returns the integer with the value of b, which it takes
+// ownership of.
+func NewBigInteger(b *big.Int) *Integer {
+	if b.IsInt64() {
+		return &Integer{Value: b.Int64()}
+	}
+	return &Integer{Big: b}
+}
+
+func (i *Integer) Type() ObjectType {
+	return INTEGER_OBJ
+}
+
+func (i *Integer) String() string {
+	if i.Big != nil {
+		return i.Big.String()
+	}
+	return strconv.FormatInt(i.Value, 10)
+}
+
+// IsBig reports whether the integer does not fit in 64 bits.
+func (i *Integer) IsBig() bool {
+	return i.Big != nil
+}
+
+// BigInt returns the value of the integer as a big.Int, which must not be
+// modified.
+func (i *Integer) BigInt() *big.Int {
+	if i.Big != nil {
+		return i.Big
+	}
+	return big.NewInt(i.Value)
+}
+
+// Float returns the nearest float to the integer.
+func (i *Integer) Float() float64 {
+	if i.Big != nil {
+		f, _ := new(big.Float).SetInt(i.Big).Float64()
+		return f
+	}
+	return float64(i.Value)
+}
+
+// Cmp compares the integer with j, returning -1, 0 or +1 like big.Int.Cmp.
+func (i *Integer) Cmp(j *Integer) int {
+	if i.Big == nil && j.Big == nil {
+		switch {
+		case i.Value < j.Value:
+			return -1
+		case i.Value > j.Value:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return i.BigInt().Cmp(j.BigInt())
+}
+
+func (i *Integer) HashKey() HashKey {
+	if i.Big != nil {
+		h := fnv.New64a()
+		if i.Big.Sign() < 0 {
+			h.Write([]byte{'-'})
+		}
+		h.Write(i.Big.Bytes())
+		return HashKey{Type: i.Type(), Value: h.Sum64()}
+	}
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
@@ -0,0 +1,117 @@
+package object
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Range is the sequence of integers from Start up to, but not including,
+// Stop in steps of Step, as made by the range builtin. Its elements are
+// computed as they are iterated rather than stored.
+type Range struct {
+	Start, Stop, Step int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+
+func (r *Range) String() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.Stop, r.Step)
+}
+
+// Len returns the number of elements in the range.
+func (r *Range) Len() int64 {
+	if r.Step > 0 && r.Start < r.Stop {
+		return (r.Stop - r.Start + r.Step - 1) / r.Step
+	}
+	if r.Step < 0 && r.Start > r.Stop {
+		return (r.Start - r.Stop - r.Step - 1) / -r.Step
+	}
+	return 0
+}
+
+// At returns the i-th element of the range, which must be in bounds.
+func (r *Range) At(i int64) int64 {
+	return r.Start + i*r.Step
+}
+
+// Iterator steps through the elements of an array, string, hash or range
+// for a for-in loop. Every element has a key, which is its index or its
+// hash key, and a value.
+type Iterator struct {
+	next func() (key, value Object, ok bool)
+	hash bool
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) String() string   { return "iterator" }
+
+// Next returns the key and value of the next element, or ok false once
+// there are none left.
+func (it *Iterator) Next() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// Single returns what a loop with one variable binds for an element: its
+// key when iterating over a hash and its value otherwise.
+func (it *Iterator) Single(key, value Object) Object {
+	if it.hash {
+		return key
+	}
+	return value
+}
+
+// Iterate returns an iterator over obj, or false if obj cannot be iterated
+// over.
+//
+// Arrays are iterated by index, so elements assigned during the loop are
+// seen. Strings are iterated by character, with the key counting
+// characters rather than bytes. Hashes are iterated in insertion order
+// over the keys they had when the loop started.
+func Iterate(obj Object) (*Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		i := 0
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= len(obj.Elements) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: int64(i - 1)}, obj.Elements[i-1], true
+		}}, true
+	case *String:
+		offset, i := 0, 0
+		return &Iterator{next: func() (Object, Object, bool) {
+			if offset >= len(obj.Value) {
+				return nil, nil, false
+			}
+			_, size := utf8.DecodeRuneInString(obj.Value[offset:])
+			ch := &String{Value: obj.Value[offset : offset+size]}
+			offset += size
+			i++
+			return &Integer{Value: int64(i - 1)}, ch, true
+		}}, true
+	case *Hash:
+		keys := append([]HashKey(nil), obj.Keys...)
+		i := 0
+		return &Iterator{hash: true, next: func() (Object, Object, bool) {
+			if i >= len(keys) {
+				return nil, nil, false
+			}
+			pair := obj.Pairs[keys[i]]
+			i++
+			return pair.Key, pair.Value, true
+		}}, true
+	case *Range:
+		n := obj.Len()
+		var i int64
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= n {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: i - 1}, &Integer{Value: obj.At(i - 1)}, true
+		}}, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,155 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Limits bounds the resources a program may use, so that a host can run
+// code it does not trust. A zero field sets no limit.
+type Limits struct {
+	// Steps is the number of nodes the evaluator may evaluate, or of
+	// instructions the virtual machine may execute.
+	Steps int64
+	// Depth is the number of function calls that may be active at once.
+	// Without it, calls deeper than MaxDepth still fail.
+	Depth int
+	// Time is how long a run may take.
+	Time time.Duration
+	// Elements is the length an array or a hash, in elements, or a string
+	// or an integer, in bytes, may reach. Builtins that make an array of a
+	// range refuse ranges longer than that too.
+	Elements int
+}
+
+// MaxDepth is the number of function calls that may be active at once on
+// either engine whatever the limits. A deeper call raises a RuntimeError,
+// "stack overflow", that the program can catch, rather than exhausting the
+// stack of the host.
+const MaxDepth = 10000
+
+// pollInterval is how many steps pass between checks of the clock and the
+// context, which are too slow to make on every step.
+const pollInterval = 1024
+
+// Start begins a run under ctx, which may be nil, counting steps, calls and
+// time from zero.
+func (rt *Runtime) Start(ctx context.Context) {
+	rt.ctx = ctx
+	rt.steps, rt.depth, rt.exceeded, rt.exitCode = 0, 0, "", nil
+	rt.importing = nil
+	rt.deadline = time.Time{}
+	if rt.Limits.Time > 0 {
+		rt.deadline = time.Now().Add(rt.Limits.Time)
+	}
+}
+
+// Step counts one step of the program and returns a LimitError if it has
+// run out of steps or time, or its context is done. Once a limit has been
+// exceeded every later step fails too, so a program that catches the error
+// cannot carry on.
+func (rt *Runtime) Step() *Error {
+	if rt.exceeded != "" {
+		return rt.limitError()
+	}
+	if rt.exitCode != nil {
+		return rt.exitError()
+	}
+	rt.steps++
+	if rt.Limits.Steps > 0 && rt.steps > rt.Limits.Steps {
+		return rt.exceed("step limit of %d exceeded", rt.Limits.Steps)
+	}
+	if rt.steps%pollInterval == 0 {
+		if !rt.deadline.IsZero() && time.Now().After(rt.deadline) {
+			return rt.exceed("time limit of %s exceeded", rt.Limits.Time)
+		}
+		if rt.ctx != nil && rt.ctx.Err() != nil {
+			return rt.exceed("run stopped: %s", rt.ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Enter counts the start of a function call and returns a LimitError if
+// more are active than the limits allow, or a RuntimeError if MaxDepth
+// are. Every successful Enter must be matched by a Leave.
+func (rt *Runtime) Enter() *Error {
+	if rt.exceeded != "" {
+		return rt.limitError()
+	}
+	if rt.exitCode != nil {
+		return rt.exitError()
+	}
+	if rt.Limits.Depth > 0 && rt.depth >= rt.Limits.Depth {
+		return rt.exceed("call depth limit of %d exceeded", rt.Limits.Depth)
+	}
+	if rt.depth >= MaxDepth {
+		return NewError(RuntimeError, "stack overflow")
+	}
+	rt.depth++
+	return nil
+}
+
+// Leave counts the end of a function call.
+func (rt *Runtime) Leave() {
+	rt.depth--
+}
+
+// CheckSize returns a LimitError if obj is an array, hash, string or
+// integer longer than the runtime allows, and nil otherwise.
+func (rt *Runtime) CheckSize(obj Object) *Error {
+	switch obj := obj.(type) {
+	case *String:
+		return rt.CheckLength(obj.Type(), len(obj.Value))
+	case *Array:
+		return rt.CheckLength(obj.Type(), len(obj.Elements))
+	case *Hash:
+		return rt.CheckLength(obj.Type(), len(obj.Keys))
+	case *Integer:
+		if obj.Big != nil {
+			return rt.CheckLength(obj.Type(), (obj.Big.BitLen()+7)/8)
+		}
+	}
+	return nil
+}
+
+// CheckLength is CheckSize for a value of type typ and length n that has
+// not been made yet, so that builtins can refuse to make it.
+func (rt *Runtime) CheckLength(typ ObjectType, n int) *Error {
+	if rt.Limits.Elements > 0 && n > rt.Limits.Elements {
+		return rt.exceed("%s of length %d exceeds the limit of %d", typ, n, rt.Limits.Elements)
+	}
+	return nil
+}
+
+func (rt *Runtime) exceed(format string, a ...any) *Error {
+	rt.exceeded = fmt.Sprintf(format, a...)
+	return rt.limitError()
+}
+
+// limitError returns a new error for the exceeded limit, since errors are
+// given positions and stack frames as they travel up.
+func (rt *Runtime) limitError() *Error {
+	return &Error{Kind: LimitError, Message: rt.exceeded}
+}
+
+// Exit ends the run with the exit status code. Like an exceeded limit it
+// makes every later step fail, so the program stops even if it catches the
+// error.
+func (rt *Runtime) Exit(code int) *Error {
+	rt.exitCode = &code
+	return rt.exitError()
+}
+
+// Exited returns the status passed to Exit, and whether the run called it.
+func (rt *Runtime) Exited() (int, bool) {
+	if rt.exitCode == nil {
+		return 0, false
+	}
+	return *rt.exitCode, true
+}
+
+func (rt *Runtime) exitError() *Error {
+	return &Error{Kind: ExitError, Message: fmt.Sprintf("exit status %d", *rt.exitCode)}
+}
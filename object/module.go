@@ -0,0 +1,90 @@
+package object
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ModuleFunction is the name tracebacks give the code of a module file.
+const ModuleFunction = "<module>"
+
+// StdPrefix starts the import paths of the modules of the standard library,
+// which are bundled into the interpreter instead of read from files.
+const StdPrefix = "std/"
+
+// Module is a file run by an import statement. Its exports are read from
+// Env, the environment the file ran in, so they follow later assignments
+// made by the module's own functions.
+type Module struct {
+	Path    string
+	Env     *Environment
+	Exports []string
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) String() string   { return "<module " + m.Path + ">" }
+
+// Get returns the value of the export called name.
+func (m *Module) Get(name string) (Object, bool) {
+	for _, export := range m.Exports {
+		if export == name {
+			return m.Env.Get(name)
+		}
+	}
+	return nil, false
+}
+
+// Imported returns the module already imported from the file at path, an
+// absolute path or that of a module of the standard library, by a program
+// using rt.
+func (rt *Runtime) Imported(path string) (*Module, bool) {
+	m, ok := rt.modules[path]
+	return m, ok
+}
+
+// BeginImport records that the module at path is being imported, returning
+// an ImportError if it already is, which means that modules import each
+// other in a circle, or a PermissionError if rt may not read files. Modules
+// of the standard library can be imported without reading files.
+func (rt *Runtime) BeginImport(path string) *Error {
+	if err := CheckImportCycle(rt.importing, path); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(path, StdPrefix) {
+		if err := rt.require(CapFS, "import"); err != nil {
+			return err
+		}
+	}
+	rt.importing = append(rt.importing, path)
+	return nil
+}
+
+// EndImport records that the import of the module at path begun by the
+// last call to BeginImport is over, and caches m for later imports unless
+// it is nil because the import failed.
+func (rt *Runtime) EndImport(path string, m *Module) {
+	rt.importing = rt.importing[:len(rt.importing)-1]
+	if m == nil {
+		return
+	}
+	if rt.modules == nil {
+		rt.modules = make(map[string]*Module)
+	}
+	rt.modules[path] = m
+}
+
+// CheckImportCycle returns an ImportError if importing, the paths of the
+// modules being imported, outermost first, contains path.
+func CheckImportCycle(importing []string, path string) *Error {
+	for i, p := range importing {
+		if p == path {
+			var chain []string
+			for _, p := range importing[i:] {
+				chain = append(chain, filepath.Base(p))
+			}
+			chain = append(chain, filepath.Base(path))
+			return NewError(ImportError, "circular import: %s", strings.Join(chain, " -> "))
+		}
+	}
+	return nil
+}
@@ -2,14 +2,19 @@ package object
 
 import (
 	"dot/ast"
-	"fmt"
+	"dot/code"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	STRING_OBJ       = "STRING"
@@ -18,30 +23,35 @@ const (
 	ERROR_OBJ        = "ERROR"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	RANGE_OBJ        = "RANGE"
+	MODULE_OBJ       = "MODULE"
+	ITERATOR_OBJ     = "ITERATOR"
 )
 
-type Error struct {
-	Message string
-}
-
-func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) String() string   { return "ERROR: " + e.Message }
-
 type Object interface {
 	Type() ObjectType
 	String() string
 }
 
-type Integer struct {
+type Float struct {
 	Value float64
 }
 
-func (i *Integer) Type() ObjectType {
-	return INTEGER_OBJ
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
 }
 
-func (i *Integer) String() string {
-	return fmt.Sprintf("%g", i.Value)
+// String formats the float in the shortest form that reads back as the
+// same value, always with a '.' or an exponent so that it cannot be taken
+// for an integer.
+func (f *Float) String() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
 }
 
 type Boolean struct {
@@ -84,7 +94,20 @@ func (rv *ReturnValue) String() string {
 	return rv.Value.String()
 }
 
+// Break and Continue are the values of break and continue statements while
+// they are passed up to the enclosing loop.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) String() string   { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) String() string   { return "continue" }
+
 type Function struct {
+	Name       string // the name it was bound to by let, or "" if anonymous
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -96,6 +119,57 @@ func (f *Function) String() string {
 	return "fn"
 }
 
+// CompiledFunction is a function body lowered to bytecode by the compiler.
+type CompiledFunction struct {
+	Name         string
+	Instructions code.Instructions
+	Parameters   []string
+	Positions    code.SourceMap
+	// Locals is the number of stack slots a call of the function keeps its
+	// variables in, starting with its parameters, and Cells the number of
+	// cells it keeps those that closures capture in.
+	Locals int
+	Cells  int
+	// Captures gives where the call creating a closure of the function
+	// finds each of the variables the closure captures: in one of its own
+	// cells or one its closure captured.
+	Captures []code.Location
+	// Chains are the names the function looks up by OpGetName,
+	// OpSetName and OpAssignName.
+	Chains []code.Chain
+	// Globals and Exports list the global variables, by number, and the
+	// exports of the module file the function runs, if it runs one.
+	Globals []string
+	Exports []string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return FUNCTION_OBJ }
+
+func (cf *CompiledFunction) String() string {
+	return "compiled fn"
+}
+
+// Closure is a compiled function together with the global environment it
+// was created in and the variables of enclosing calls it captured, as run
+// by the virtual machine.
+type Closure struct {
+	Fn   *CompiledFunction
+	Env  *Environment
+	Free []*Cell
+}
+
+// Cell holds a variable of a call of a compiled function that closures
+// capture, so that they and the call share its later assignments.
+type Cell struct {
+	Value Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+
+func (c *Closure) String() string {
+	return "fn"
+}
+
 type Array struct {
 	Elements []Object
 }
@@ -103,21 +177,18 @@ type Array struct {
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
 
 func (a *Array) String() string {
-	var out string
-	for i, e := range a.Elements {
-		if i == 0 {
-			out += e.String()
-		} else {
-			out += ", " + e.String()
-		}
-	}
-	return "[" + out + "]"
+	return inspect(a, make(map[Object]bool))
 }
 
-type BuiltinFn func(args ...Object) Object
+// BuiltinFn is the Go implementation of a builtin function. rt is the
+// runtime of the program calling it.
+type BuiltinFn func(rt *Runtime, args ...Object) Object
 
 type Builtin struct {
-	Fn BuiltinFn
+	Name string
+	Fn   BuiltinFn
+	// Capability is the capability the builtin needs, if any.
+	Capability Capability
 }
 
 func (b *Builtin) Type() ObjectType { return FUNCTION_OBJ }
@@ -132,8 +203,17 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
-func (i *Integer) HashKey() HashKey {
-	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+// HashKey of a whole float is that of the equal integer, so that 1 and 1.0
+// are the same key, as they are equal.
+func (f *Float) HashKey() HashKey {
+	if math.IsInf(f.Value, 0) || f.Value != math.Trunc(f.Value) {
+		return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+	}
+	if f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+	b, _ := big.NewFloat(f.Value).Int(nil)
+	return NewBigInteger(b).HashKey()
 }
 
 func (b *Boolean) HashKey() HashKey {
@@ -157,16 +237,64 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash maps keys to values. Keys holds the keys of Pairs in the order they
+// were first set, which is the order hashes are printed and iterated in;
+// use Set to add pairs so that it stays in step.
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set sets the pair stored under key, keeping the position of a key that
+// is already present.
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
 func (h *Hash) String() string {
-	var out string
-	for _, pair := range h.Pairs {
-		out += pair.Key.String() + ": " + pair.Value.String() + ", "
+	return inspect(h, make(map[Object]bool))
+}
+
+// inspect returns the String of obj. printing holds the arrays and hashes
+// being printed around obj, so that one holding itself, directly or not,
+// is printed inside itself as [...] or {...} instead of without end.
+func inspect(obj Object, printing map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if printing[obj] {
+			return "[...]"
+		}
+		printing[obj] = true
+		defer delete(printing, obj)
+		var out string
+		for i, e := range obj.Elements {
+			if i > 0 {
+				out += ", "
+			}
+			out += inspect(e, printing)
+		}
+		return "[" + out + "]"
+	case *Hash:
+		if printing[obj] {
+			return "{...}"
+		}
+		printing[obj] = true
+		defer delete(printing, obj)
+		var out string
+		for _, key := range obj.Keys {
+			pair := obj.Pairs[key]
+			out += inspect(pair.Key, printing) + ": " + inspect(pair.Value, printing) + ", "
+		}
+		return "{ " + out + " }"
 	}
-	return "{ " + out + " }"
+	return obj.String()
 }
@@ -0,0 +1,82 @@
+package object
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Runtime is the part of the interpreter running a program that builtins
+// can reach: the streams that print writes to and ask reads from, the
+// builtin functions themselves, the capabilities they may use and the
+// limits the program runs under.
+type Runtime struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  *bufio.Reader
+
+	// Builtins holds the builtin functions of programs using this runtime
+	// by name. If it is nil they get the standard ones.
+	Builtins map[string]*Builtin
+	// Denied holds the capabilities whose builtins fail when called.
+	Denied map[Capability]bool
+
+	Limits Limits
+
+	// the state of the current run, see Start
+	ctx      context.Context
+	deadline time.Time
+	steps    int64
+	depth    int
+	// exceeded describes the limit the run has exceeded, if it has
+	exceeded string
+	// exitCode is the status the run was ended with by Exit, if it was
+	exitCode *int
+
+	// modules caches the modules imported so far by absolute path, and
+	// importing holds the paths of those being imported, outermost first
+	modules   map[string]*Module
+	importing []string
+
+	// caller calls functions for Call, see SetCaller
+	caller Caller
+}
+
+// Caller calls fn with args on the engine running a program, returning the
+// result, which is an *Error if the call failed.
+type Caller func(fn Object, args []Object) Object
+
+// Call calls fn with args for a builtin, such as map, that takes functions
+// as arguments. The call runs on the engine running the program, and an
+// error raised inside it is returned like any other result.
+func (rt *Runtime) Call(fn Object, args ...Object) Object {
+	if rt.caller != nil {
+		return rt.caller(fn, args)
+	}
+	if fn, ok := fn.(*Builtin); ok {
+		if err := rt.Permit(fn); err != nil {
+			return err
+		}
+		return fn.Fn(rt, args...)
+	}
+	return NewError(RuntimeError, "cannot call %s outside a running program", fn.Type())
+}
+
+// SetCaller makes Call use caller and returns the caller it used before.
+// Engines set their caller while they run a builtin.
+func (rt *Runtime) SetCaller(caller Caller) Caller {
+	previous := rt.caller
+	rt.caller = caller
+	return previous
+}
+
+// NewRuntime returns a runtime using the standard streams of the process.
+func NewRuntime() *Runtime {
+	return &Runtime{Stdout: os.Stdout, Stderr: os.Stderr, Stdin: stdin}
+}
+
+// stdin buffers the standard input for every runtime reading it, so that
+// none loses input that another has read ahead.
+var stdin = bufio.NewReader(os.Stdin)
@@ -0,0 +1,43 @@
+package parser
+
+import (
+	"dot/token"
+	"fmt"
+)
+
+// Error is a syntax error found while parsing.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s - at line %d, column %d", e.Msg, e.Pos.Line, e.Pos.Column)
+}
+
+// ErrorList is the list of errors found in a program, in source order.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns nil if the list is empty and the list itself otherwise, so
+// that callers can treat it as an ordinary error.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// bailout is the panic value used to abandon a malformed statement. The
+// statement list being parsed recovers from it and skips to the start of
+// the next statement.
+type bailout struct{}
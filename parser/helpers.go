@@ -1,20 +1,36 @@
 package parser
 
 import (
+	"dot/ast"
 	"dot/token"
 	"fmt"
 )
 
 func (p *Parser) nextToken() token.Token {
-	p.currentToken = p.peekToken
-	p.peekToken = p.lexer.NextToken()
-	if p.currentToken.Type == token.COMMENT {
-		p.currentToken = p.peekToken
-		p.peekToken = p.lexer.NextToken()
+	switch p.currentToken.Type {
+	case token.LPAREN, token.LBRACKET, token.LBRACE:
+		p.depth++
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		if p.depth > 0 {
+			p.depth--
+		}
 	}
+	p.currentToken = p.peekToken
+	p.peekToken = p.readToken()
 	return p.currentToken
 }
 
+// readToken returns the next token from the lexer that is not a comment.
+// The comments it skips are kept for the program.
+func (p *Parser) readToken() token.Token {
+	tok := p.lexer.NextToken()
+	for tok.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: tok})
+		tok = p.lexer.NextToken()
+	}
+	return tok
+}
+
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParser) {
 	p.prefixParsers[tokenType] = fn
 }
@@ -23,24 +39,58 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParser) {
 	p.infixParsers[tokenType] = fn
 }
 
-func (p *Parser) newError(error string, line int, column int) {
-	p.errors = append(p.errors, error+" - "+fmt.Sprintf("at line %d, column %d", line, column))
+// newError records a syntax error and abandons the statement being parsed;
+// it does not return. An error on the same line as the previous one is most
+// likely a consequence of it and is not recorded.
+func (p *Parser) newError(error string, pos token.Position) {
+	if n := len(p.errors); n == 0 || p.errors[n-1].Pos.Line != pos.Line {
+		p.errors = append(p.errors, &Error{Pos: pos, Msg: error})
+	}
+	panic(bailout{})
 }
 
-func (p *Parser) peekPrecedence() int {
-	if precedence, ok := priority[p.peekToken.Type]; ok {
-		return precedence
+// expect reports an error unless the current token has type t.
+func (p *Parser) expect(t token.TokenType) {
+	if p.currentToken.Type != t {
+		p.newError(fmt.Sprintf("expected '%s'", t), p.currentToken.Pos)
 	}
-	return LOWEST
 }
 
-func (p *Parser) currentPrecedence() int {
-	if precedence, ok := priority[p.currentToken.Type]; ok {
+// expectSeparator is used after an element of a list closed by end. It
+// moves past a ',' and reports an error if the current token is neither a
+// ',' nor end.
+func (p *Parser) expectSeparator(end token.TokenType) {
+	switch p.currentToken.Type {
+	case token.COMMA:
+		p.nextToken()
+	case end:
+	default:
+		p.newError(fmt.Sprintf("expected ',' or '%s'", end), p.currentToken.Pos)
+	}
+}
+
+// Precedence returns how tightly the operator t binds the expressions
+// around it, LOWEST if t is not an infix operator.
+func Precedence(t token.TokenType) int {
+	if precedence, ok := priority[t]; ok {
 		return precedence
 	}
 	return LOWEST
 }
 
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
+
+func (p *Parser) currentPrecedence() int {
+	return Precedence(p.currentToken.Type)
+}
+
+// Errors returns the syntax errors found by ParseProgram.
+func (p *Parser) Errors() ErrorList {
+	return p.errors
+}
+
 func (p *Parser) PrintErrors() {
 	if len(p.errors) > 0 {
 		for _, e := range p.errors {
@@ -48,12 +98,3 @@ func (p *Parser) PrintErrors() {
 		}
 	}
 }
-
-func (p *Parser) expectPeek(t token.TokenType) bool {
-	if p.peekToken.Type == t {
-		p.nextToken()
-		return true
-	}
-	p.newError(fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type), p.lexer.Line(), p.lexer.Column())
-	return false
-}
@@ -4,12 +4,15 @@ import (
 	"dot/ast"
 	"dot/lexer"
 	"dot/token"
+	"errors"
+	"math/big"
 	"strconv"
 )
 
 const (
 	_ = iota
 	LOWEST
+	ASSIGNMENT
 	LOGICAL
 	EQUALS
 	LESSGREATER
@@ -18,14 +21,16 @@ const (
 	PREFIX
 	CALL
 	INDEX
-	ASSIGNMENT
 )
 
 type Parser struct {
 	currentToken  token.Token
 	peekToken     token.Token
 	lexer         *lexer.Lexer
-	errors        []string
+	errors        ErrorList
+	depth         int // brackets opened before currentToken and not yet closed
+	loopDepth     int // loops around currentToken in the current function
+	comments      []*ast.Comment
 	prefixParsers map[token.TokenType]prefixParser
 	infixParsers  map[token.TokenType]infixParser
 }
@@ -48,7 +53,7 @@ var priority = map[token.TokenType]int{
 	token.ASTERISK:    PRODUCT,
 	token.LPAREN:      CALL,
 	token.LBRACKET:    INDEX,
-	token.BANG:        PREFIX,
+	token.DOT:         INDEX,
 	token.AND:         LOGICAL,
 	token.OR:          LOGICAL,
 	token.ASSIGN:      ASSIGNMENT,
@@ -61,12 +66,11 @@ var priority = map[token.TokenType]int{
 func NewParser(lexer *lexer.Lexer) *Parser {
 	parser := &Parser{
 		lexer:         lexer,
-		currentToken:  lexer.NextToken(),
-		peekToken:     lexer.NextToken(),
-		errors:        []string{},
 		prefixParsers: make(map[token.TokenType]prefixParser),
 		infixParsers:  make(map[token.TokenType]infixParser),
 	}
+	parser.currentToken = parser.readToken()
+	parser.peekToken = parser.readToken()
 
 	parser.registerPrefix(token.BANG, parser.parsePrefixExpression)
 	parser.registerPrefix(token.MINUS, parser.parsePrefixExpression)
@@ -75,7 +79,9 @@ func NewParser(lexer *lexer.Lexer) *Parser {
 	parser.registerPrefix(token.FALSE, parser.parseBoolean)
 	parser.registerPrefix(token.IDENTIFIER, parser.parseIdentifier)
 	parser.registerPrefix(token.STRING, parser.parseString)
+	parser.registerPrefix(token.STRING_HEAD, parser.parseInterpolatedString)
 	parser.registerPrefix(token.INTEGER, parser.parseInteger)
+	parser.registerPrefix(token.FLOAT, parser.parseFloat)
 	parser.registerPrefix(token.LPAREN, parser.parseGroupedExpression)
 	parser.registerPrefix(token.IF, parser.parseIfExpression)
 	parser.registerPrefix(token.FUNCTION, parser.parseFunction)
@@ -94,13 +100,14 @@ func NewParser(lexer *lexer.Lexer) *Parser {
 	parser.registerInfix(token.EQUAL, parser.parseInfixExpression)
 	parser.registerInfix(token.LPAREN, parser.parseCallExpression)
 	parser.registerInfix(token.LBRACKET, parser.parseIndexExpression)
+	parser.registerInfix(token.DOT, parser.parseMemberExpression)
 	parser.registerInfix(token.AND, parser.parseInfixExpression)
 	parser.registerInfix(token.OR, parser.parseInfixExpression)
-	parser.registerInfix(token.ASSIGN, parser.parseInfixExpression)
-	parser.registerInfix(token.PLUS_EQUAL, parser.parseInfixExpression)
-	parser.registerInfix(token.MINUS_EQUAL, parser.parseInfixExpression)
-	parser.registerInfix(token.MULT_EQUAL, parser.parseInfixExpression)
-	parser.registerInfix(token.DIV_EQUAL, parser.parseInfixExpression)
+	parser.registerInfix(token.ASSIGN, parser.parseAssignment)
+	parser.registerInfix(token.PLUS_EQUAL, parser.parseAssignment)
+	parser.registerInfix(token.MINUS_EQUAL, parser.parseAssignment)
+	parser.registerInfix(token.MULT_EQUAL, parser.parseAssignment)
+	parser.registerInfix(token.DIV_EQUAL, parser.parseAssignment)
 
 	return parser
 }
@@ -110,38 +117,111 @@ func (p *Parser) ParseProgram() *ast.Program {
 		Statements: []ast.Statement{},
 	}
 	for p.currentToken.Type != token.EOF {
-		statement := p.parseStatement()
 		// this sets current token to the first token of the next statement
-		if p.currentToken.Type == token.COMMENT {
-			p.nextToken()
+		if statement := p.parseStatementRecover(0); statement != nil {
+			program.Statements = append(program.Statements, statement)
 		}
-		program.Statements = append(program.Statements, statement)
 	}
+	program.Comments = p.comments
 	return program
 }
 
+// parseStatementRecover parses a statement of a list whose brackets are
+// nested home deep. If the statement is malformed it returns nil, leaving
+// the current token at the start of the next statement.
+func (p *Parser) parseStatementRecover(home int) (statement ast.Statement) {
+	start := p.currentToken.Pos
+	loopDepth := p.loopDepth
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(bailout); !ok {
+			panic(r)
+		}
+		statement = nil
+		p.loopDepth = loopDepth
+		p.synchronize(home, p.errors[len(p.errors)-1].Pos)
+		if p.currentToken.Pos == start && p.currentToken.Type != token.EOF {
+			p.nextToken()
+		}
+	}()
+	return p.parseStatement()
+}
+
+// synchronize skips the rest of a malformed statement that reported an
+// error at errPos. Outside any brackets the statement was in the middle
+// of, it stops past a ';', before a '}' closing the enclosing block, before
+// a statement keyword or at the first token of a later line. A statement
+// keyword at the error or on a later line that is not inside a block skipped
+// here also ends an unclosed bracket.
+func (p *Parser) synchronize(home int, errPos token.Position) {
+	braces := 0
+	for p.currentToken.Type != token.EOF {
+		tok := p.currentToken
+		laterLine := tok.Pos.Line > errPos.Line
+		switch tok.Type {
+		case token.LET, token.WHILE, token.FOR, token.RETURN, token.TRY, token.THROW, token.BREAK, token.CONTINUE, token.IMPORT, token.EXPORT:
+			if p.depth == home || (laterLine || tok.Pos == errPos) && braces == 0 {
+				p.depth = home
+				return
+			}
+		case token.LBRACE:
+			braces++
+		case token.RBRACE:
+			if braces > 0 {
+				braces--
+			}
+		}
+		if p.depth == home {
+			switch {
+			case tok.Type == token.SEMICOLON:
+				p.nextToken()
+				return
+			case tok.Type == token.RBRACE && home > 0:
+				return
+			case laterLine && tok.Type != token.RBRACE:
+				return
+			}
+		}
+		p.nextToken()
+		if p.depth < home {
+			p.depth = home
+		}
+	}
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
+		Token:    p.currentToken,
 		Operator: p.currentToken.Literal,
 	}
 	p.nextToken()
-	expression.Right = p.parseExpression(PREFIX, *p.lexer)
+	expression.Right = p.parseExpression(PREFIX)
 	return expression
 }
 
-func (p *Parser) parseExpression(precedence int, lexer lexer.Lexer) ast.Expression {
+func (p *Parser) parseExpression(precedence int) ast.Expression {
 	// current token: first token of expression
 	prefix := p.prefixParsers[p.currentToken.Type]
 	if prefix == nil {
-		p.newError("no prefix parser for '"+string(p.currentToken.Type)+"'", lexer.Line(), lexer.Column())
-		return nil
+		switch p.currentToken.Type {
+		case token.EOF:
+			p.newError("unexpected end of input", p.currentToken.Pos)
+		case token.ILLEGAL:
+			p.newError(p.currentToken.Literal, p.currentToken.Pos)
+		case token.STRING_MIDDLE, token.STRING_TAIL:
+			p.newError("unexpected '}'", p.currentToken.Pos)
+		}
+		p.newError("unexpected '"+p.currentToken.Literal+"'", p.currentToken.Pos)
 	}
 	leftExp := prefix()
 	for p.peekToken.Type != token.SEMICOLON && precedence < p.peekPrecedence() {
 		p.nextToken()
 		infix := p.infixParsers[p.currentToken.Type]
 		if infix == nil {
-			return leftExp
+			p.newError("unexpected '"+p.currentToken.Literal+"'", p.currentToken.Pos)
 		}
 		leftExp = infix(leftExp)
 	}
@@ -151,11 +231,6 @@ func (p *Parser) parseExpression(precedence int, lexer lexer.Lexer) ast.Expressi
 func (p *Parser) parseStatement() ast.Statement {
 	// current token: first token of statement
 	// the current token after each statement is passed goes to next statement's first token
-
-	for p.currentToken.Type == token.COMMENT { // for skipping multi-line comments
-		p.nextToken()
-	}
-
 	switch p.currentToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
@@ -165,20 +240,26 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseWhileStatement()
 	case token.FOR:
 		return p.parseForStatement()
+	case token.TRY:
+		return p.parseTryStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopJump()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseReturnStatement() ast.Statement {
-	if p.currentToken.Type != token.RETURN {
-		p.newError("expected 'return'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.RETURN)
+	expr := &ast.ReturnStatement{Token: p.currentToken}
 	p.nextToken()
-	expr := &ast.ReturnStatement{
-		ReturnValue: p.parseExpression(LOWEST, *p.lexer),
-	}
+	expr.ReturnValue = p.parseExpression(LOWEST)
 	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
 	}
@@ -187,111 +268,204 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 }
 
 func (p *Parser) parseExpressionStatement() ast.Statement {
-	expression := p.parseExpression(LOWEST, *p.lexer)
+	first := p.currentToken
+	expression := p.parseExpression(LOWEST)
 	p.nextToken()
 	if p.currentToken.Type == token.SEMICOLON {
 		p.nextToken()
 	}
 	// current token: first token of next statement
-	return &ast.ExpressionStatement{Expression: expression}
+	return &ast.ExpressionStatement{Token: first, Expression: expression}
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// current token: 'let'
+	letToken := p.currentToken
 	p.nextToken()
 	if p.currentToken.Type != token.IDENTIFIER {
-		p.newError("expected identifier after 'let'", p.lexer.Line(), p.lexer.Column())
-		return nil
+		p.newError("expected identifier after 'let'", p.currentToken.Pos)
 	}
-	identifier := ast.Identifier{Value: p.currentToken.Literal}
+	identifier := ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	p.nextToken()
 	if p.currentToken.Type != token.ASSIGN {
-		p.newError("expected '=' after identifier", p.lexer.Line(), p.lexer.Column())
-		return nil
+		p.newError("expected '=' after identifier", p.currentToken.Pos)
 	}
 	p.nextToken()
-	value := p.parseExpression(LOWEST, *p.lexer)
+	value := p.parseExpression(LOWEST)
+	if function, ok := value.(*ast.Function); ok {
+		function.Name = identifier.Value
+	}
 	p.nextToken()
 	if p.currentToken.Type == token.SEMICOLON {
 		p.nextToken()
 	}
-	return &ast.LetStatement{Identifier: identifier, Value: value}
+	return &ast.LetStatement{Token: letToken, Identifier: identifier, Value: value}
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	// current token: 'import'
+	stmt := &ast.ImportStatement{Token: p.currentToken}
+	p.nextToken()
+	switch p.currentToken.Type {
+	case token.STRING:
+	case token.ILLEGAL:
+		p.newError(p.currentToken.Literal, p.currentToken.Pos)
+	default:
+		p.newError("expected a path after 'import'", p.currentToken.Pos)
+	}
+	stmt.Path = &ast.String{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.nextToken()
+	if p.currentToken.Type != token.AS {
+		p.newError("expected 'as'", p.currentToken.Pos)
+	}
+	p.nextToken()
+	if p.currentToken.Type != token.IDENTIFIER {
+		p.newError("expected identifier after 'as'", p.currentToken.Pos)
+	}
+	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	p.nextToken()
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	// current token: 'export'
+	stmt := &ast.ExportStatement{Token: p.currentToken}
+	if p.depth > 0 {
+		p.newError("'export' outside the top level", p.currentToken.Pos)
+	}
+	p.nextToken()
+	if p.currentToken.Type != token.LET {
+		p.newError("expected 'let' after 'export'", p.currentToken.Pos)
+	}
+	stmt.Let = p.parseLetStatement()
+	return stmt
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Value: p.currentToken.Literal}
+	return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
 func (p *Parser) parseInteger() ast.Expression {
+	value, err := strconv.ParseInt(p.currentToken.Literal, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if value, ok := new(big.Int).SetString(p.currentToken.Literal, 10); ok {
+			return &ast.Integer{Token: p.currentToken, Big: value}
+		}
+	}
+	if err != nil {
+		p.newError("could not parse '"+p.currentToken.Literal+"' as integer", p.currentToken.Pos)
+	}
+	return &ast.Integer{Token: p.currentToken, Value: value}
+}
+
+func (p *Parser) parseFloat() ast.Expression {
 	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
 	if err != nil {
-		p.newError("could not parse '"+p.currentToken.Literal+"' as integer", p.lexer.Line(), p.lexer.Column())
-		return nil
+		p.newError("could not parse '"+p.currentToken.Literal+"' as float", p.currentToken.Pos)
 	}
-	return &ast.Integer{Value: value}
+	return &ast.Float{Token: p.currentToken, Value: value}
 }
 
 func (p *Parser) parseString() ast.Expression {
-	return &ast.String{Value: p.currentToken.Literal}
+	return &ast.String{Token: p.currentToken, Value: p.currentToken.Literal}
+}
+
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	// current token: the STRING_HEAD
+	str := &ast.InterpolatedString{}
+	for {
+		str.Strings = append(str.Strings, &ast.String{Token: p.currentToken, Value: p.currentToken.Literal})
+		if p.currentToken.Type == token.STRING_TAIL {
+			return str
+		}
+		p.nextToken()
+		if p.currentToken.Type == token.STRING_MIDDLE || p.currentToken.Type == token.STRING_TAIL {
+			p.newError("expected an expression in '${}'", p.currentToken.Pos)
+		}
+		str.Values = append(str.Values, p.parseExpression(LOWEST))
+		p.nextToken()
+		switch p.currentToken.Type {
+		case token.STRING_MIDDLE, token.STRING_TAIL:
+		case token.ILLEGAL:
+			p.newError(p.currentToken.Literal, p.currentToken.Pos)
+		default:
+			p.newError("expected '}'", p.currentToken.Pos)
+		}
+	}
 }
 
 func (p *Parser) parseBoolean() ast.Expression {
-	return &ast.Boolean{Value: p.currentToken.Type == token.TRUE}
+	return &ast.Boolean{Token: p.currentToken, Value: p.currentToken.Type == token.TRUE}
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	// current token: operator
 	expression := &ast.InfixExpression{
+		Token:    p.currentToken,
 		Operator: p.currentToken.Literal,
 		Left:     left,
 	}
 	precedence := p.currentPrecedence()
 	p.nextToken()
 	// current token: right expression's first token
-	expression.Right = p.parseExpression(precedence, *p.lexer)
+	expression.Right = p.parseExpression(precedence)
+	return expression
+}
+
+// parseAssignment parses an assignment, which binds more loosely than any
+// other operator and groups to the right, so that a = b = c + 1 assigns
+// c + 1 to both a and b.
+func (p *Parser) parseAssignment(left ast.Expression) ast.Expression {
+	// current token: '=' or a compound assignment operator
+	expression := &ast.InfixExpression{
+		Token:    p.currentToken,
+		Operator: p.currentToken.Literal,
+		Left:     left,
+	}
+	switch left.(type) {
+	case *ast.Identifier:
+	case *ast.IndexExpression:
+		if expression.Operator != "=" {
+			p.newError("cannot use '"+expression.Operator+"' on an index expression", p.currentToken.Pos)
+		}
+	case *ast.MemberExpression:
+		if expression.Operator != "=" {
+			p.newError("cannot use '"+expression.Operator+"' on a member expression", p.currentToken.Pos)
+		}
+	default:
+		p.newError("cannot assign to "+left.String(), left.Pos())
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(ASSIGNMENT - 1)
 	return expression
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	// current token: '('
 	p.nextToken()
-	expression := p.parseExpression(LOWEST, *p.lexer)
-	if p.peekToken.Type != token.RPAREN {
-		p.newError("expected ')'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	expression := p.parseExpression(LOWEST)
 	p.nextToken()
+	p.expect(token.RPAREN)
 	return expression
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
 	// current token: 'if'
-	expression := &ast.IfExpression{}
+	expression := &ast.IfExpression{Token: p.currentToken}
 	p.nextToken()
-	if p.currentToken.Type != token.LPAREN {
-		p.newError("expected '('", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.LPAREN)
 	p.nextToken()
-	expression.Condition = p.parseExpression(LOWEST, *p.lexer)
+	expression.Condition = p.parseExpression(LOWEST)
 	p.nextToken()
 	// current token: )
-	if p.currentToken.Type != token.RPAREN {
-		p.newError("expected ')'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.RPAREN)
 	p.nextToken()
 	// current token: {
-	if p.currentToken.Type != token.LBRACE {
-		p.newError("expected '{'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
-	p.nextToken()
+	p.expect(token.LBRACE)
 	expression.Consequence = p.parseBlockStatement()
-	if p.currentToken.Type != token.RBRACE {
-		p.newError("expected '}'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
 	if p.peekToken.Type == token.ELSE {
 		p.nextToken()
 		p.nextToken()
@@ -300,61 +474,54 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		// if the next token is 'if', parse it as an if expression
 
 		if p.currentToken.Type == token.IF {
-			expression.Alternative = &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: p.parseIfExpression()}}}
+			ifToken := p.currentToken
+			nested := &ast.ExpressionStatement{Token: ifToken, Expression: p.parseIfExpression()}
+			expression.Alternative = &ast.BlockStatement{Token: ifToken, Statements: []ast.Statement{nested}, Rbrace: p.currentToken}
 			return expression
 		}
 
-		if p.currentToken.Type != token.LBRACE {
-			p.newError("expected '{'", p.lexer.Line(), p.lexer.Column())
-			return nil
-		}
-		p.nextToken()
+		p.expect(token.LBRACE)
 		expression.Alternative = p.parseBlockStatement()
-		if p.currentToken.Type != token.RBRACE {
-			p.newError("expected '}'", p.lexer.Line(), p.lexer.Column())
-			return nil
-		}
 	}
 	return expression
 }
 
-// after this function, current token is the first token of the next statement
+// after this function, current token is the closing '}' of the block
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	// current token: first token of first statemetent inside block
+	// current token: '{'
 	block := &ast.BlockStatement{
+		Token:      p.currentToken,
 		Statements: []ast.Statement{},
 	}
+	p.nextToken()
+	home := p.depth
 	for p.currentToken.Type != token.RBRACE && p.currentToken.Type != token.EOF {
-		statement := p.parseStatement()
-		block.Statements = append(block.Statements, statement)
-	}
-	// current token is semicolon as p.parseStatement() calls p.nextToken() at the end
-	if p.currentToken.Type == token.SEMICOLON {
-		p.nextToken()
+		if statement := p.parseStatementRecover(home); statement != nil {
+			block.Statements = append(block.Statements, statement)
+		}
 	}
-	// current token: first token of next statement
+	p.expect(token.RBRACE)
+	block.Rbrace = p.currentToken
 	return block
 }
 
 func (p *Parser) parseFunction() ast.Expression {
 	// current token: 'fn'
 	function := &ast.Function{
+		Token:      p.currentToken,
 		Parameters: []*ast.Identifier{},
 	}
 	p.nextToken()
-	if p.currentToken.Type != token.LPAREN {
-		p.newError("expected '('", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.LPAREN)
 	p.nextToken()
 	function.Parameters = p.parseFunctionParameters()
 	p.nextToken()
-	if p.currentToken.Type != token.LBRACE {
-		p.newError("expected '{'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
-	p.nextToken()
+	p.expect(token.LBRACE)
+	// a loop around the function does not make break and continue valid in it
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	function.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 	return function
 }
 
@@ -362,15 +529,13 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	// current token: first parameter
 	parseFunctionParameters := []*ast.Identifier{}
 	for p.currentToken.Type != token.RPAREN {
-		if p.currentToken.Type == token.IDENTIFIER {
-			identifier := &ast.Identifier{Value: p.currentToken.Literal}
-			parseFunctionParameters = append(parseFunctionParameters, identifier)
+		if p.currentToken.Type != token.IDENTIFIER {
+			p.newError("expected parameter name", p.currentToken.Pos)
 		}
+		identifier := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		parseFunctionParameters = append(parseFunctionParameters, identifier)
 		p.nextToken()
-		// current token: ',' or ')'
-		if p.currentToken.Type == token.COMMA {
-			p.nextToken()
-		}
+		p.expectSeparator(token.RPAREN)
 	}
 	return parseFunctionParameters
 }
@@ -378,10 +543,13 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	// current token: '('
 	call := &ast.CallExpression{
+		Token:    p.currentToken,
 		Function: function,
 	}
 	p.nextToken()
 	call.Arguments = p.parseCallArguments()
+	// current token: ')'
+	call.Rparen = p.currentToken
 	return call
 }
 
@@ -389,13 +557,10 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	// current token: first argument
 	arguments := []ast.Expression{}
 	for p.currentToken.Type != token.RPAREN {
-		argument := p.parseExpression(LOWEST, *p.lexer)
+		argument := p.parseExpression(LOWEST)
 		arguments = append(arguments, argument)
 		p.nextToken()
-		// current token: ',' or ')'
-		if p.currentToken.Type == token.COMMA {
-			p.nextToken()
-		}
+		p.expectSeparator(token.RPAREN)
 	}
 	return arguments
 }
@@ -403,77 +568,94 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	// current token: '['
 	array := &ast.ArrayLiteral{
+		Token:    p.currentToken,
 		Elements: []ast.Expression{},
 	}
-	for p.peekToken.Type != token.RBRACKET {
-		p.nextToken()
-		element := p.parseExpression(LOWEST, *p.lexer)
+	p.nextToken()
+	for p.currentToken.Type != token.RBRACKET {
+		element := p.parseExpression(LOWEST)
 		array.Elements = append(array.Elements, element)
-		if p.peekToken.Type == token.COMMA {
-			p.nextToken()
-		}
+		p.nextToken()
+		p.expectSeparator(token.RBRACKET)
 	}
-	p.nextToken()
+	array.Rbracket = p.currentToken
 	return array
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	// current token: '['
 	index := &ast.IndexExpression{
-		Left: left,
+		Token: p.currentToken,
+		Left:  left,
 	}
 	p.nextToken()
-	index.Index = p.parseExpression(LOWEST, *p.lexer)
-	if p.peekToken.Type != token.RBRACKET {
-		p.newError("expected ']'", p.lexer.Line(), p.lexer.Column())
-		return nil
+	if p.currentToken.Type == token.COLON {
+		return p.parseSliceExpression(index.Token, left, nil)
+	}
+	index.Index = p.parseExpression(LOWEST)
+	if p.peekToken.Type == token.COLON {
+		p.nextToken()
+		return p.parseSliceExpression(index.Token, left, index.Index)
 	}
-	// currect token: end of index expression
 	p.nextToken()
-	// current token: ']'
-	// p.nextToken()
+	p.expect(token.RBRACKET)
+	index.Rbracket = p.currentToken
 	if p.peekToken.Type == token.ASSIGN {
 		p.nextToken()
+		assign := p.currentToken
 		p.nextToken()
 		// current token: first token of the right expression
 		return &ast.InfixExpression{
+			Token:    assign,
 			Left:     index,
 			Operator: "=",
-			Right:    p.parseExpression(LOWEST, *p.lexer),
+			Right:    p.parseExpression(LOWEST),
 		}
 	}
 
 	return index
 }
 
+func (p *Parser) parseSliceExpression(lbracket token.Token, left ast.Expression, low ast.Expression) ast.Expression {
+	// current token: ':'
+	slice := &ast.SliceExpression{Token: lbracket, Left: left, Low: low}
+	p.nextToken()
+	if p.currentToken.Type != token.RBRACKET {
+		slice.High = p.parseExpression(LOWEST)
+		p.nextToken()
+	}
+	p.expect(token.RBRACKET)
+	slice.Rbracket = p.currentToken
+	return slice
+}
+
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	// current token: '.'
+	member := &ast.MemberExpression{Token: p.currentToken, Left: left}
+	p.nextToken()
+	if p.currentToken.Type != token.IDENTIFIER {
+		p.newError("expected identifier after '.'", p.currentToken.Pos)
+	}
+	member.Member = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	return member
+}
+
 func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	// current token: 'while'
-	stmt := &ast.WhileStatement{}
+	stmt := &ast.WhileStatement{Token: p.currentToken}
 	p.nextToken()
-	if p.currentToken.Type != token.LPAREN {
-		p.newError("expected '('", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.LPAREN)
 	p.nextToken()
-	stmt.Condition = p.parseExpression(LOWEST, *p.lexer)
+	stmt.Condition = p.parseExpression(LOWEST)
 	p.nextToken()
 	// current token: )
-	if p.currentToken.Type != token.RPAREN {
-		p.newError("expected ')'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.RPAREN)
 	p.nextToken()
 	// current token: {
-	if p.currentToken.Type != token.LBRACE {
-		p.newError("expected '{'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
-	p.nextToken()
+	p.expect(token.LBRACE)
+	p.loopDepth++
 	stmt.Body = p.parseBlockStatement()
-	if p.currentToken.Type != token.RBRACE {
-		p.newError("expected '}'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.loopDepth--
 	p.nextToken()
 	if p.currentToken.Type == token.SEMICOLON {
 		p.nextToken()
@@ -482,67 +664,158 @@ func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	return stmt
 }
 
-func (p *Parser) parseForStatement() *ast.ForStatement {
+func (p *Parser) parseForStatement() ast.Statement {
 	// current token: 'for'
-	expression := &ast.ForStatement{}
+	forToken := p.currentToken
 	p.nextToken()
-	if p.currentToken.Type != token.LPAREN {
-		p.newError("expected '('", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.LPAREN)
 	p.nextToken()
+	if p.currentToken.Type == token.IDENTIFIER && (p.peekToken.Type == token.IN || p.peekToken.Type == token.COMMA) {
+		return p.parseForInStatement(forToken)
+	}
+	expression := &ast.ForStatement{Token: forToken}
 	expression.Initializer = p.parseStatement()
 	// after parseStatement, current token is the first token of the next statement and the semicolon is already consumed
-	expression.Condition = p.parseExpression(LOWEST, *p.lexer)
+	expression.Condition = p.parseExpression(LOWEST)
 	p.nextToken()
-	if p.currentToken.Type != token.SEMICOLON {
-		p.newError("expected ';'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.SEMICOLON)
 	p.nextToken()
 	expression.Incrementer = p.parseStatement()
 	// p.nextToken()
 	// current token: )
-	if p.currentToken.Type != token.RPAREN {
-		p.newError("expected ')'", p.lexer.Line(), p.lexer.Column())
-		return nil
-	}
+	p.expect(token.RPAREN)
 	p.nextToken()
 	// current token: {
-	if p.currentToken.Type != token.LBRACE {
-		p.newError("expected '{'", p.lexer.Line(), p.lexer.Column())
-		return nil
+	p.expect(token.LBRACE)
+	p.loopDepth++
+	expression.Body = p.parseBlockStatement()
+	p.loopDepth--
+	p.nextToken()
+	if p.currentToken.Type == token.SEMICOLON {
+		p.nextToken()
 	}
+	// current token: first token of next statement
+	return expression
+}
+
+func (p *Parser) parseForInStatement(forToken token.Token) *ast.ForInStatement {
+	// current token: the first loop variable
+	expression := &ast.ForInStatement{Token: forToken}
+	expression.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	p.nextToken()
-	expression.Body = p.parseBlockStatement()
-	if p.currentToken.Type != token.RBRACE {
-		p.newError("expected '}'", p.lexer.Line(), p.lexer.Column())
-		return nil
+	if p.currentToken.Type == token.COMMA {
+		expression.Key = expression.Value
+		p.nextToken()
+		if p.currentToken.Type != token.IDENTIFIER {
+			p.newError("expected identifier after ','", p.currentToken.Pos)
+		}
+		expression.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		p.nextToken()
+	}
+	if p.currentToken.Type != token.IN {
+		p.newError("expected 'in'", p.currentToken.Pos)
 	}
 	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+	p.nextToken()
+	p.expect(token.RPAREN)
+	p.nextToken()
+	p.expect(token.LBRACE)
+	p.loopDepth++
+	expression.Body = p.parseBlockStatement()
+	p.loopDepth--
+	p.nextToken()
+	if p.currentToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	// current token: first token of next statement
 	return expression
 }
 
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	// current token: 'try'
+	stmt := &ast.TryStatement{Token: p.currentToken}
+	p.nextToken()
+	p.expect(token.LBRACE)
+	stmt.Block = p.parseBlockStatement()
+	if p.peekToken.Type == token.CATCH {
+		p.nextToken()
+		p.nextToken()
+		p.expect(token.LPAREN)
+		p.nextToken()
+		if p.currentToken.Type != token.IDENTIFIER {
+			p.newError("expected identifier after 'catch ('", p.currentToken.Pos)
+		}
+		stmt.Parameter = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		p.nextToken()
+		p.expect(token.RPAREN)
+		p.nextToken()
+		p.expect(token.LBRACE)
+		stmt.Catch = p.parseBlockStatement()
+	}
+	if p.peekToken.Type == token.FINALLY {
+		p.nextToken()
+		p.nextToken()
+		p.expect(token.LBRACE)
+		stmt.Finally = p.parseBlockStatement()
+	}
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.newError("expected 'catch' or 'finally'", p.peekToken.Pos)
+	}
+	p.nextToken()
+	if p.currentToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	// current token: first token of next statement
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	// current token: 'throw'
+	stmt := &ast.ThrowStatement{Token: p.currentToken}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	p.nextToken()
+	return stmt
+}
+
+// parseLoopJump parses a break or continue statement.
+func (p *Parser) parseLoopJump() ast.Statement {
+	// current token: 'break' or 'continue'
+	tok := p.currentToken
+	if p.loopDepth == 0 {
+		p.newError("'"+tok.Literal+"' outside loop", tok.Pos)
+	}
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	p.nextToken()
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	// current token: '{'
 	hash := &ast.HashLiteral{
-		Pairs: map[ast.Expression]ast.Expression{},
+		Token: p.currentToken,
+		Pairs: []ast.HashPair{},
 	}
-	for p.peekToken.Type != token.RBRACE {
+	p.nextToken()
+	for p.currentToken.Type != token.RBRACE {
+		key := p.parseExpression(LOWEST)
 		p.nextToken()
-		key := p.parseExpression(LOWEST, *p.lexer)
+		p.expect(token.COLON)
 		p.nextToken()
-		if p.currentToken.Type != token.COLON {
-			p.newError("expected ':'", p.lexer.Line(), p.lexer.Column())
-			return nil
-		}
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 		p.nextToken()
-		value := p.parseExpression(LOWEST, *p.lexer)
-		hash.Pairs[key] = value
-		if p.peekToken.Type == token.COMMA {
-			p.nextToken()
-		}
+		p.expectSeparator(token.RBRACE)
 	}
-	p.nextToken()
+	hash.Rbrace = p.currentToken
 	return hash
 }
@@ -2,9 +2,9 @@ package parser
 
 import (
 	"dot/ast"
-	"dot/eval"
 	"dot/lexer"
-	"dot/object"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -22,9 +22,9 @@ func testLiteralExpression(
 ) bool {
 	switch v := expected.(type) {
 	case int:
-		return testIntegerLiteral(t, exp, float64(v))
+		return testIntegerLiteral(t, exp, int64(v))
 	case float64:
-		return testIntegerLiteral(t, exp, float64(v))
+		return testFloatLiteral(t, exp, v)
 	case string:
 		// TODO: add test for string literal
 		// if strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
@@ -54,7 +54,7 @@ func testLiteralExpression(
 // 	return true
 // }
 
-func testIntegerLiteral(t *testing.T, il ast.Expression, value float64) bool {
+func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 	integ, ok := il.(*ast.Integer)
 	if !ok {
 		t.Errorf("il not *ast.IntegerLiteral. got=%T", il)
@@ -62,7 +62,22 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value float64) bool {
 	}
 
 	if integ.Value != value {
-		t.Errorf("integ.Value not %g. got=%g", value, integ.Value)
+		t.Errorf("integ.Value not %d. got=%d", value, integ.Value)
+		return false
+	}
+
+	return true
+}
+
+func testFloatLiteral(t *testing.T, fl ast.Expression, value float64) bool {
+	float, ok := fl.(*ast.Float)
+	if !ok {
+		t.Errorf("fl not *ast.Float. got=%T", fl)
+		return false
+	}
+
+	if float.Value != value {
+		t.Errorf("float.Value not %g. got=%g", value, float.Value)
 		return false
 	}
 
@@ -115,7 +130,7 @@ func TestLetStatement(t *testing.T) {
 		p, _ := newParser(tt.input)
 		stmts := p.ParseProgram()
 		for _, e := range p.errors {
-			t.Errorf("tests[%d] PARSER ERROR: "+e, i)
+			t.Errorf("tests[%d] PARSER ERROR: %s", i, e)
 		}
 		stmt := stmts.Statements[0].(*ast.LetStatement)
 		if stmt.Identifier.Value != tt.expectedIdentifier {
@@ -141,7 +156,7 @@ func TestReturnStatements(t *testing.T) {
 		p, _ := newParser(tt.input)
 		program := p.ParseProgram()
 		for _, e := range p.errors {
-			t.Error("PARSER ERROR: " + e)
+			t.Errorf("PARSER ERROR: %s", e)
 		}
 
 		if len(program.Statements) != 1 {
@@ -178,7 +193,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		p, _ := newParser(tt.input)
 		program := p.ParseProgram()
 		for _, e := range p.errors {
-			t.Error("PARSER ERROR: " + e)
+			t.Errorf("PARSER ERROR: %s", e)
 		}
 		if len(program.Statements) != 1 {
 			t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
@@ -219,6 +234,8 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 != 5;", 5, "!=", 5},
 		{"5 >= 5;", 5, ">=", 5},
 		{"5 <= 5;", 5, "<=", 5},
+		{"1.5 * 2", 1.5, "*", 2},
+		{"7 / .25", 7, "/", 0.25},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -228,7 +245,7 @@ func TestParsingInfixExpressions(t *testing.T) {
 		p, _ := newParser(tt.input)
 		program := p.ParseProgram()
 		for _, e := range p.errors {
-			t.Error("PARSER ERROR: " + e)
+			t.Errorf("PARSER ERROR: %s", e)
 		}
 		if len(program.Statements) != 1 {
 			t.Fatalf("[%d] program.Statements does not contain %d statements. got=%d\n",
@@ -367,6 +384,41 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!(true == true);",
 			"(!(true == true));",
 		},
+		// 22
+		{
+			"-99999999999999999999 * 2.50;",
+			"((-99999999999999999999) * 2.50);",
+		},
+		// 23
+		{
+			"a = b = c + 1;",
+			"(a = (b = (c + 1)));",
+		},
+		// 24
+		{
+			"x += f(y) * 2 || z;",
+			"(x += ((f(y) * 2) || z));",
+		},
+		// 25
+		{
+			"s[1:n - 1] + s[:2] + s[-2:] + s[:];",
+			"((((s[1:(n - 1)]) + (s[:2])) + (s[(-2):])) + (s[:]));",
+		},
+		// 26
+		{
+			"x + \"a ${y * 2 + 1} b ${\"c${z}\"}\";",
+			"(x + a ${((y * 2) + 1)} b ${c${z}});",
+		},
+		// 27: '!' only starts an expression, so it never continues one
+		{
+			"print(1)\n!x",
+			"print(1);\n(!x);",
+		},
+		// 28
+		{
+			"x = 1\n![x]",
+			"(x = 1);\n(![x]);",
+		},
 		// {
 		// 	"a + add(b * c) + d;",
 		// 	"((a + add((b * c))) + d)",
@@ -393,7 +445,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		p, _ := newParser(tt.input)
 		program := p.ParseProgram()
 		for _, e := range p.errors {
-			t.Errorf("tests[%d] PARSER ERROR: "+e, i)
+			t.Errorf("tests[%d] PARSER ERROR: %s", i, e)
 		}
 		actual := program.String()
 		if strings.TrimSpace(actual) != tt.expected {
@@ -409,7 +461,7 @@ func TestIfExpression(t *testing.T) {
 	p, _ := newParser(input)
 	program := p.ParseProgram()
 	for _, e := range p.errors {
-		t.Error("PARSER ERROR: " + e)
+		t.Errorf("PARSER ERROR: %s", e)
 	}
 	if len(program.Statements) != 1 {
 		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
@@ -430,17 +482,275 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
-func TestSnippet(t *testing.T) {
-	input := `for (let i = 0; i < 10; i += 1) {
-    print(i)
-}`
+func TestTryStatement(t *testing.T) {
+	input := `try { risky() } catch (e) { e["message"] } finally { done() }
+throw bad`
+	p, _ := newParser(input)
+	program := p.ParseProgram()
+	for _, e := range p.errors {
+		t.Errorf("PARSER ERROR: %s", e)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	try, ok := program.Statements[0].(*ast.TryStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.TryStatement. got=%T", program.Statements[0])
+	}
+	if try.Parameter.Value != "e" {
+		t.Errorf("try.Parameter is not e. got=%s", try.Parameter.Value)
+	}
+	if len(try.Block.Statements) != 1 || len(try.Catch.Statements) != 1 || len(try.Finally.Statements) != 1 {
+		t.Errorf("wrong number of statements in try blocks. got=%q", try.String())
+	}
+	throw, ok := program.Statements[1].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.ThrowStatement. got=%T", program.Statements[1])
+	}
+	testLiteralExpression(t, throw.Value, "bad")
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		key      string
+		value    string
+		iterable string
+	}{
+		{"for (x in xs) { x }", "", "x", "xs"},
+		{"for (k, v in {1: 2}) { v }", "k", "v", "{1: 2}"},
+		{"for (i, ch in \"abc\") { break }", "i", "ch", "abc"},
+		{"for (n in range(0, 10, 2)) { continue }", "", "n", "range(0, 10, 2)"},
+		{"for (x in [1]) { x };", "", "x", "[1]"},
+	}
 
-	p, l := newParser(input)
+	for i, tt := range tests {
+		p, _ := newParser(tt.input)
+		program := p.ParseProgram()
+		for _, e := range p.errors {
+			t.Errorf("tests[%d] - PARSER ERROR: %s", i, e)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("tests[%d] - program.Statements does not contain 1 statement. got=%d", i, len(program.Statements))
+		}
+		loop, ok := program.Statements[0].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("tests[%d] - program.Statements[0] is not ast.ForInStatement. got=%T", i, program.Statements[0])
+		}
+		key := ""
+		if loop.Key != nil {
+			key = loop.Key.Value
+		}
+		if key != tt.key || loop.Value.Value != tt.value {
+			t.Errorf("tests[%d] - wrong loop variables. expected=(%q, %q), got=(%q, %q)", i, tt.key, tt.value, key, loop.Value.Value)
+		}
+		if loop.Iterable.String() != tt.iterable {
+			t.Errorf("tests[%d] - wrong iterable. expected=%q, got=%q", i, tt.iterable, loop.Iterable.String())
+		}
+	}
+
+	// a ';' may end a loop like any other statement
+	for i, input := range []string{"for (x in [1]) { x }; 2", "for (let i = 0; i < 1; i += 1) {}; 2"} {
+		p, _ := newParser(input)
+		program := p.ParseProgram()
+		for _, e := range p.errors {
+			t.Errorf("tests[%d] - PARSER ERROR: %s", i, e)
+		}
+		if len(program.Statements) != 2 {
+			t.Errorf("tests[%d] - program.Statements does not contain 2 statements. got=%d", i, len(program.Statements))
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	input := `import "lib/math.dot" as math;
+export let double = fn(x) { math.mul(x, 2) }
+export let count = 0
+let hidden = math.pi.digits`
+	p, _ := newParser(input)
 	program := p.ParseProgram()
-	env := object.NewEnvironment()
-	evaluated := eval.Eval(program, env, *l)
 	for _, e := range p.errors {
-		t.Error("PARSER ERROR: " + e)
+		t.Errorf("PARSER ERROR: %s", e)
+	}
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d", len(program.Statements))
+	}
+	imp, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if imp.Path.Value != "lib/math.dot" || imp.Name.Value != "math" {
+		t.Errorf("wrong import. got=%q", imp.String())
+	}
+	if exports := program.Exports(); !reflect.DeepEqual(exports, []string{"double", "count"}) {
+		t.Errorf("wrong exports. got=%q", exports)
+	}
+	if got := program.Statements[3].String(); got != "let hidden = ((math.pi).digits);\n" {
+		t.Errorf("wrong member expression. got=%q", got)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// first
+let x = 1 // after x
+let s = "// not a comment"
+//last`
+	p, _ := newParser(input)
+	program := p.ParseProgram()
+	for _, e := range p.errors {
+		t.Errorf("PARSER ERROR: %s", e)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	var comments []string
+	for _, c := range program.Comments {
+		comments = append(comments, fmt.Sprintf("%d:%d %s", c.Pos().Line, c.Pos().Column, c.Text()))
+	}
+	if expected := []string{"1:1 first", "2:11 after x", "4:1 last"}; !reflect.DeepEqual(comments, expected) {
+		t.Errorf("wrong comments. expected=%q, got=%q", expected, comments)
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+}
+add(1, [2])`
+
+	p, _ := newParser(input)
+	program := p.ParseProgram()
+	for _, e := range p.errors {
+		t.Errorf("PARSER ERROR: %s", e)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.Function)
+	infix := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	array := call.Arguments[1].(*ast.ArrayLiteral)
+
+	tests := []struct {
+		node      ast.Node
+		pos       string
+		end       string
+		posOffset int
+	}{
+		{let, "1:1", "3:2", 0},
+		{fn, "1:11", "3:2", 10},
+		{fn.Body, "1:20", "3:2", 19},
+		{infix, "2:3", "2:8", 23},
+		{call, "4:1", "4:12", 31},
+		{array, "4:8", "4:11", 38},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.pos {
+			t.Errorf("tests[%d] - pos wrong. expected=%s, got=%s", i, tt.pos, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.end {
+			t.Errorf("tests[%d] - end wrong. expected=%s, got=%s", i, tt.end, tt.node.End())
+		}
+		if tt.node.Pos().Offset != tt.posOffset {
+			t.Errorf("tests[%d] - offset wrong. expected=%d, got=%d", i, tt.posOffset, tt.node.Pos().Offset)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 5;", "expected identifier after 'let' - at line 1, column 5"},
+		{"let x = 5;\nlet y 6;", "expected '=' after identifier - at line 2, column 7"},
+		{"if (x) {\n  x\n} else y", "expected '{' - at line 3, column 8"},
+		{"try { x }\ny", "expected 'catch' or 'finally' - at line 2, column 1"},
+		{"try { x } catch { y }", "expected '(' - at line 1, column 17"},
+		{"let x = 1\nbreak", "'break' outside loop - at line 2, column 1"},
+		{"while (x) {\n  let f = fn() { continue }\n}", "'continue' outside loop - at line 2, column 18"},
+		{"for (k, 1 in xs) { k }", "expected identifier after ',' - at line 1, column 9"},
+		{"for (k, v of xs) { k }", "expected 'in' - at line 1, column 11"},
+		{"let x = 1\n1 + x = 3", "cannot assign to (1 + x) - at line 2, column 1"},
+		{"a[0] += 1", "cannot use '+=' on an index expression - at line 1, column 6"},
+		{"import lib as l", "expected a path after 'import' - at line 1, column 8"},
+		{"import \"lib.dot\" l", "expected 'as' - at line 1, column 18"},
+		{"import \"lib.dot\" as 1", "expected identifier after 'as' - at line 1, column 21"},
+		{"if (x) { export let y = 1 }", "'export' outside the top level - at line 1, column 10"},
+		{"export fn() {}", "expected 'let' after 'export' - at line 1, column 8"},
+		{"m.(x)", "expected identifier after '.' - at line 1, column 3"},
+		{"m.x *= 2", "cannot use '*=' on a member expression - at line 1, column 5"},
+		{"s[1:2] = x", "cannot assign to (s[1:2]) - at line 1, column 1"},
+		{"s[1:2", "expected ']' - at line 1, column 6"},
+		{"let s = \"abc", "unterminated string - at line 1, column 9"},
+		{"let s = \"a\\qb\"", "invalid escape sequence '\\q' - at line 1, column 9"},
+		{"let s = `abc\n", "unterminated raw string - at line 1, column 9"},
+		{"import \"lib.dot", "unterminated string - at line 1, column 8"},
+		{"let s = \"a ${b}\nc\"", "unterminated string - at line 1, column 9"},
+		{"let s = \"a ${b\n}\"", "unterminated string - at line 1, column 9"},
+		{"let s = \"a ${}\"", "expected an expression in '${}' - at line 1, column 14"},
+		{"let s = \"a ${b c}\"", "expected '}' - at line 1, column 16"},
+		{"let s = \"a ${b +}\"", "unexpected '}' - at line 1, column 17"},
+		{"import \"${lib}\" as l", "expected a path after 'import' - at line 1, column 8"},
+	}
+
+	for i, tt := range tests {
+		p, _ := newParser(tt.input)
+		p.ParseProgram()
+		if len(p.errors) == 0 {
+			t.Fatalf("tests[%d] - expected a parser error", i)
+		}
+		if p.errors[0].Error() != tt.expected {
+			t.Errorf("tests[%d] - wrong error. expected=%q, got=%q", i, tt.expected, p.errors[0])
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     []string
+		statements int
+	}{
+		{"let x = ;\nlet y = 2;", []string{"unexpected ';' - at line 1, column 9"}, 1},
+		{"let x = 1 +\nlet y = 2\ny", []string{"unexpected 'let' - at line 2, column 1"}, 2},
+		{"let f = fn(a, b {\n  return a\n}\nf(1)", []string{"expected ',' or ')' - at line 1, column 17"}, 0},
+		{"let a = [1, 2\nlet b = 3", []string{"expected ',' or ']' - at line 2, column 1"}, 1},
+		{"while (true) {\n  let = 1\n  x\n}\ny", []string{"expected identifier after 'let' - at line 2, column 7"}, 2},
+		{"let x = 1 2 *;\nlet y = {1: }\nlet z = 3", []string{
+			"unexpected ';' - at line 1, column 14",
+			"unexpected '}' - at line 2, column 13",
+		}, 2},
+		{"}\nlet x = 1", []string{"unexpected '}' - at line 1, column 1"}, 1},
+		{"if (x) {", []string{"expected '}' - at line 1, column 9"}, 0},
+		{"print(1, ", []string{"unexpected end of input - at line 1, column 10"}, 0},
+		{"fn(", []string{"expected parameter name - at line 1, column 4"}, 0},
+		{"{", []string{"unexpected end of input - at line 1, column 2"}, 0},
+	}
+
+	for i, tt := range tests {
+		p, _ := newParser(tt.input)
+		program := p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Errorf("tests[%d] - wrong number of errors. expected=%d, got=%d (%v)", i, len(tt.errors), len(errors), errors)
+			continue
+		}
+		for j, e := range errors {
+			if e.Error() != tt.errors[j] {
+				t.Errorf("tests[%d] - wrong error %d. expected=%q, got=%q", i, j, tt.errors[j], e.Error())
+			}
+		}
+		if len(program.Statements) != tt.statements {
+			t.Errorf("tests[%d] - wrong number of statements. expected=%d, got=%d", i, tt.statements, len(program.Statements))
+		}
+		for j, stmt := range program.Statements {
+			if stmt == nil {
+				t.Errorf("tests[%d] - statement %d is nil", i, j)
+			}
+		}
 	}
-	t.Logf("evaluated: %+v", evaluated)
 }
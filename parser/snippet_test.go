@@ -0,0 +1,26 @@
+package parser_test
+
+import (
+	"dot/eval"
+	"dot/lexer"
+	"dot/object"
+	"dot/parser"
+	"testing"
+)
+
+// TestSnippet lives in an external test package because the evaluator
+// imports the parser to load modules.
+func TestSnippet(t *testing.T) {
+	input := `for (let i = 0; i < 10; i += 1) {
+    print(i)
+}`
+
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	evaluated := eval.Eval(program, env)
+	for _, e := range p.Errors() {
+		t.Errorf("PARSER ERROR: %s", e)
+	}
+	t.Logf("evaluated: %+v", evaluated)
+}
@@ -0,0 +1,565 @@
+// Package printer formats Dot programs. It prints the syntax tree of a file
+// back as source in one layout: a statement per line, blocks indented by
+// two spaces, operators spaced and parenthesized only where precedence
+// needs it, at most one blank line in a row, and the comments of the file
+// where they were written. Formatting formatted source changes nothing.
+//
+// A few choices are left to the author. Blocks and lists written on one
+// line stay on one line, and lists written across lines get an element per
+// line. Strings and numbers are printed as they were written.
+package printer
+
+import (
+	"bytes"
+	"dot/ast"
+	"dot/lexer"
+	"dot/parser"
+	"dot/token"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const indentation = "  "
+
+// Format parses src, the contents of the file called filename, and returns
+// it formatted. If src does not parse, Format returns its syntax errors as
+// a parser.ErrorList.
+func Format(filename string, src []byte) ([]byte, error) {
+	p := parser.NewParser(lexer.NewFileLexer(filename, string(src)))
+	program := p.ParseProgram()
+	if err := p.Errors().Err(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, string(src), program); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fprint writes program formatted to w. The program must have been parsed
+// from src, which the printer takes strings from with their escapes as
+// written.
+func Fprint(w io.Writer, src string, program *ast.Program) error {
+	p := &printer{src: src, comments: program.Comments}
+	p.statements(program.Statements, token.Position{Offset: len(src)})
+	_, err := w.Write(p.alignComments())
+	return err
+}
+
+type printer struct {
+	src    string
+	out    []byte
+	indent int
+	// comments holds the comments not printed yet
+	comments []*ast.Comment
+	// line is the source line the last statement, element or comment of
+	// the list being printed ended on, 0 before the first one
+	line int
+	// trailing maps the lines of out that end in a comment after code to
+	// the length of the comment
+	trailing map[int]int
+}
+
+// print writes s, indenting it if it starts a line.
+func (p *printer) print(s string) {
+	if s == "" {
+		return
+	}
+	if len(p.out) == 0 || p.out[len(p.out)-1] == '\n' {
+		p.out = append(p.out, strings.Repeat(indentation, p.indent)...)
+	}
+	p.out = append(p.out, s...)
+}
+
+func (p *printer) newline() {
+	p.out = append(p.out, '\n')
+}
+
+// text returns tok as it was written in the source.
+func (p *printer) text(tok token.Token) string {
+	return p.src[tok.Pos.Offset:tok.End.Offset]
+}
+
+// blank keeps a blank line before something starting on line if the
+// source had one or more between it and the last item of the list.
+func (p *printer) blank(line int) {
+	if p.line > 0 && line > p.line+1 {
+		p.newline()
+	}
+}
+
+// flushComments prints the comments before end on lines of their own.
+func (p *printer) flushComments(end token.Position) {
+	for len(p.comments) > 0 && p.comments[0].Pos().Offset < end.Offset {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		p.blank(c.Pos().Line)
+		p.print(comment(c))
+		p.newline()
+		p.line = c.Pos().Line
+	}
+}
+
+// trailingComment prints the next comment after what is on the line if it
+// was written on the same source line, before next, the position of what
+// is printed after it.
+func (p *printer) trailingComment(line int, next token.Position) {
+	if len(p.comments) > 0 && p.comments[0].Pos().Line == line && p.comments[0].Pos().Offset < next.Offset {
+		text := comment(p.comments[0])
+		p.comments = p.comments[1:]
+		if p.trailing == nil {
+			p.trailing = make(map[int]int)
+		}
+		p.trailing[bytes.Count(p.out, []byte{'\n'})] = len(text)
+		p.print(" " + text)
+	}
+}
+
+// alignComments returns out with the comments after code on consecutive
+// lines of the same indentation starting in the same column.
+func (p *printer) alignComments() []byte {
+	lines := strings.SplitAfter(string(p.out), "\n")
+	for start := 0; start < len(lines); start++ {
+		if _, ok := p.trailing[start]; !ok {
+			continue
+		}
+		indent := indentOf(lines[start])
+		end, column := start, 0
+		for ; p.trailing[end] > 0 && indentOf(lines[end]) == indent; end++ {
+			code := codeBefore(lines[end], p.trailing[end])
+			column = max(column, utf8.RuneCountInString(code)+1)
+		}
+		for i := start; i < end; i++ {
+			code := codeBefore(lines[i], p.trailing[i])
+			lines[i] = code + strings.Repeat(" ", column-utf8.RuneCountInString(code)) + strings.TrimPrefix(lines[i], code)[1:]
+		}
+		start = end
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+func indentOf(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " "))]
+}
+
+// codeBefore returns line without its comment, comment bytes long, and the
+// space before it.
+func codeBefore(line string, comment int) string {
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimRight(line[:len(line)-comment], " ")
+}
+
+// hasComments reports whether there are comments between start and end.
+func (p *printer) hasComments(start, end token.Position) bool {
+	for _, c := range p.comments {
+		if c.Pos().Offset >= end.Offset {
+			break
+		}
+		if c.Pos().Offset >= start.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+func comment(c *ast.Comment) string {
+	return strings.TrimRight(c.Token.Literal, " \t\r")
+}
+
+// statements prints list a statement per line, with the comments before
+// end, the '}' closing the list or the end of the file.
+func (p *printer) statements(list []ast.Statement, end token.Position) {
+	p.line = 0
+	// semicolon is where the last statement ended if the parser would
+	// continue it with the next one unless a ';' ends it there
+	semicolon := -1
+	for i, s := range list {
+		p.flushComments(s.Pos())
+		p.blank(s.Pos().Line)
+		start := len(p.out)
+		p.statement(s)
+		if semicolon >= 0 && continues(p.out[start:]) {
+			p.out = slices.Insert(p.out, semicolon, ';')
+		}
+		semicolon = -1
+		if endsInExpression(s) {
+			semicolon = len(p.out)
+		}
+		p.line = s.End().Line
+		next := end
+		if i+1 < len(list) {
+			next = list[i+1].Pos()
+		}
+		p.trailingComment(p.line, next)
+		p.newline()
+	}
+	p.flushComments(end)
+}
+
+// endsInExpression reports whether s ends in an expression, which an
+// operator at the start of the next line would continue.
+func endsInExpression(s ast.Statement) bool {
+	switch s.(type) {
+	case *ast.ExpressionStatement, *ast.LetStatement, *ast.ExportStatement, *ast.ReturnStatement, *ast.ThrowStatement:
+		return true
+	}
+	return false
+}
+
+// continues reports whether the statement printed as text starts with a
+// token that would continue an expression before it.
+func continues(text []byte) bool {
+	text = bytes.TrimLeft(text, " ")
+	return len(text) > 0 && strings.IndexByte("([+-!", text[0]) >= 0
+}
+
+func (p *printer) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, parser.LOWEST)
+	case *ast.LetStatement:
+		p.let(s)
+	case *ast.ExportStatement:
+		p.print("export ")
+		p.let(s.Let)
+	case *ast.ImportStatement:
+		p.print("import " + p.text(s.Path.Token) + " as " + s.Name.Value)
+	case *ast.ReturnStatement:
+		p.print("return ")
+		p.expression(s.ReturnValue, parser.LOWEST)
+	case *ast.ThrowStatement:
+		p.print("throw ")
+		p.expression(s.Value, parser.LOWEST)
+	case *ast.BreakStatement:
+		p.print("break")
+	case *ast.ContinueStatement:
+		p.print("continue")
+	case *ast.WhileStatement:
+		p.print("while (")
+		p.expression(s.Condition, parser.LOWEST)
+		p.print(") ")
+		p.block(s.Body)
+	case *ast.ForStatement:
+		p.print("for (")
+		p.statement(s.Initializer)
+		p.print("; ")
+		p.expression(s.Condition, parser.LOWEST)
+		p.print("; ")
+		p.statement(s.Incrementer)
+		p.print(") ")
+		p.block(s.Body)
+	case *ast.ForInStatement:
+		p.print("for (")
+		if s.Key != nil {
+			p.print(s.Key.Value + ", ")
+		}
+		p.print(s.Value.Value + " in ")
+		p.expression(s.Iterable, parser.LOWEST)
+		p.print(") ")
+		p.block(s.Body)
+	case *ast.TryStatement:
+		p.print("try ")
+		p.block(s.Block)
+		last := s.Block
+		if s.Catch != nil {
+			p.keyword(last.Rbrace, "catch", s.Parameter.Pos())
+			p.print("(" + s.Parameter.Value + ") ")
+			p.block(s.Catch)
+			last = s.Catch
+		}
+		if s.Finally != nil {
+			p.keyword(last.Rbrace, "finally", s.Finally.Token.Pos)
+			p.block(s.Finally)
+		}
+	}
+}
+
+func (p *printer) let(s *ast.LetStatement) {
+	p.print("let " + s.Identifier.Value + " = ")
+	p.expression(s.Value, parser.LOWEST)
+}
+
+// keyword prints word, the keyword after the '}' rbrace, on the line of
+// the '}', and a space after it. Comments written between the '}' and the
+// keyword, or the keyword and next, the position of what follows it, keep
+// their lines, and what comes after them starts a new line.
+func (p *printer) keyword(rbrace token.Token, word string, next token.Position) {
+	// only spaces and comments come between the '}' and the keyword
+	pos := rbrace.End
+	for {
+		space := len(p.src[pos.Offset:]) - len(strings.TrimLeft(p.src[pos.Offset:], " \t\r\n"))
+		pos.Line += strings.Count(p.src[pos.Offset:pos.Offset+space], "\n")
+		pos.Offset += space
+		end := strings.IndexByte(p.src[pos.Offset:], '\n')
+		if !strings.HasPrefix(p.src[pos.Offset:], "//") || end < 0 {
+			break
+		}
+		pos.Offset += end
+	}
+	if p.hasComments(rbrace.End, pos) {
+		p.trailingComment(rbrace.Pos.Line, pos)
+		p.newline()
+		p.line = rbrace.Pos.Line
+		p.flushComments(pos)
+		p.print(word)
+	} else {
+		p.print(" " + word)
+	}
+	if p.hasComments(pos, next) {
+		p.trailingComment(pos.Line, next)
+		p.newline()
+		p.line = pos.Line
+		p.flushComments(next)
+	} else {
+		p.print(" ")
+	}
+}
+
+// block prints b on one line if it was written on one line and across
+// lines otherwise.
+func (p *printer) block(b *ast.BlockStatement) {
+	comments := p.hasComments(b.Token.Pos, b.Rbrace.Pos)
+	switch {
+	case len(b.Statements) == 0 && !comments:
+		p.print("{}")
+	case b.Token.Pos.Line == b.Rbrace.Pos.Line && !comments:
+		p.print("{ ")
+		for i, s := range b.Statements {
+			if i > 0 {
+				switch b.Statements[i-1].(type) {
+				case *ast.ForStatement, *ast.ForInStatement:
+					// a for loop does not take a ';' after it
+					p.print(" ")
+				default:
+					p.print("; ")
+				}
+			}
+			p.statement(s)
+		}
+		p.print(" }")
+	default:
+		p.print("{")
+		next := b.Rbrace.Pos
+		if len(b.Statements) > 0 {
+			next = b.Statements[0].Pos()
+		}
+		p.trailingComment(b.Token.Pos.Line, next)
+		p.newline()
+		p.indent++
+		p.statements(b.Statements, b.Rbrace.Pos)
+		p.indent--
+		p.print("}")
+	}
+}
+
+// precedence returns how tightly e holds together, as the precedence of
+// the operator the parser read it with.
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	}
+	return parser.INDEX
+}
+
+// expression prints e, in parentheses if it holds together less tightly
+// than an operand of an operator of precedence prec.
+func (p *printer) expression(e ast.Expression, prec int) {
+	if precedence(e) < prec {
+		p.print("(")
+		p.expression(e, parser.LOWEST)
+		p.print(")")
+		return
+	}
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.print(e.Value)
+	case *ast.Integer, *ast.Float, *ast.Boolean, *ast.String:
+		p.print(p.text(tokenOf(e)))
+	case *ast.InterpolatedString:
+		// the parts of the string hold the quotes, ${ and }
+		for i, s := range e.Strings {
+			p.print(p.text(s.Token))
+			if i < len(e.Values) {
+				p.expression(e.Values[i], parser.LOWEST)
+			}
+		}
+	case *ast.PrefixExpression:
+		p.print(e.Operator)
+		if _, ok := e.Right.(*ast.PrefixExpression); ok {
+			// -(-x) rather than --x
+			p.expression(e.Right, parser.PREFIX+1)
+		} else {
+			p.expression(e.Right, parser.PREFIX)
+		}
+	case *ast.InfixExpression:
+		// assignments group to the right and other operators to the left
+		prec := parser.Precedence(e.Token.Type)
+		left, right := prec, prec+1
+		if prec == parser.ASSIGNMENT {
+			left, right = prec+1, prec
+		}
+		p.expression(e.Left, left)
+		p.print(" " + e.Operator + " ")
+		p.expression(e.Right, right)
+	case *ast.CallExpression:
+		p.operand(e.Function)
+		items := make([]item, len(e.Arguments))
+		for i, argument := range e.Arguments {
+			items[i] = p.expressionItem(argument)
+		}
+		p.list(e.Token, e.Rparen, items)
+	case *ast.IndexExpression:
+		p.operand(e.Left)
+		p.print("[")
+		p.expression(e.Index, parser.LOWEST)
+		p.print("]")
+	case *ast.SliceExpression:
+		p.operand(e.Left)
+		p.print("[")
+		if e.Low != nil {
+			p.expression(e.Low, parser.LOWEST)
+		}
+		p.print(":")
+		if e.High != nil {
+			p.expression(e.High, parser.LOWEST)
+		}
+		p.print("]")
+	case *ast.MemberExpression:
+		p.operand(e.Left)
+		p.print("." + e.Member.Value)
+	case *ast.ArrayLiteral:
+		items := make([]item, len(e.Elements))
+		for i, element := range e.Elements {
+			items[i] = p.expressionItem(element)
+		}
+		p.list(e.Token, e.Rbracket, items)
+	case *ast.HashLiteral:
+		items := make([]item, len(e.Pairs))
+		for i, pair := range e.Pairs {
+			pair := pair
+			items[i] = item{pair.Key.Pos(), pair.Value.End(), func() {
+				p.expression(pair.Key, parser.LOWEST)
+				p.print(": ")
+				p.expression(pair.Value, parser.LOWEST)
+			}}
+		}
+		p.list(e.Token, e.Rbrace, items)
+	case *ast.Function:
+		names := make([]string, len(e.Parameters))
+		for i, parameter := range e.Parameters {
+			names[i] = parameter.Value
+		}
+		p.print("fn(" + strings.Join(names, ", ") + ") ")
+		p.block(e.Body)
+	case *ast.IfExpression:
+		p.print("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.print(") ")
+		p.block(e.Consequence)
+		if e.Alternative == nil {
+			break
+		}
+		p.keyword(e.Consequence.Rbrace, "else", e.Alternative.Token.Pos)
+		// the parser reads else if as a block holding the second if
+		if e.Alternative.Token.Type == token.IF {
+			p.expression(e.Alternative.Statements[0].(*ast.ExpressionStatement).Expression, parser.LOWEST)
+		} else {
+			p.block(e.Alternative)
+		}
+	}
+}
+
+func tokenOf(e ast.Expression) token.Token {
+	switch e := e.(type) {
+	case *ast.Integer:
+		return e.Token
+	case *ast.Float:
+		return e.Token
+	case *ast.Boolean:
+		return e.Token
+	case *ast.String:
+		return e.Token
+	}
+	panic("printer: no token for " + e.String())
+}
+
+// operand prints the expression a call, index or member expression applies
+// to. Function literals and if expressions are parenthesized there too, to
+// be read more easily.
+func (p *printer) operand(e ast.Expression) {
+	switch e.(type) {
+	case *ast.Function, *ast.IfExpression:
+		p.print("(")
+		p.expression(e, parser.LOWEST)
+		p.print(")")
+	default:
+		p.expression(e, parser.CALL)
+	}
+}
+
+// item is an element of a list in brackets.
+type item struct {
+	pos, end token.Position
+	print    func()
+}
+
+func (p *printer) expressionItem(e ast.Expression) item {
+	return item{e.Pos(), e.End(), func() { p.expression(e, parser.LOWEST) }}
+}
+
+// list prints items between the brackets open and close. A list written
+// with a line break between two of its elements or brackets is printed an
+// element per line, each followed by a comma; other lists stay on one line.
+func (p *printer) list(open, close token.Token, items []item) {
+	multiline := false
+	line := open.Pos.Line
+	for _, it := range items {
+		multiline = multiline || it.pos.Line > line
+		line = it.end.Line
+	}
+	multiline = multiline || close.Pos.Line > line && (len(items) > 0 || p.hasComments(open.Pos, close.Pos))
+
+	p.print(open.Literal)
+	if !multiline {
+		for i, it := range items {
+			if i > 0 {
+				p.print(", ")
+			}
+			it.print()
+		}
+		p.print(close.Literal)
+		return
+	}
+	next := close.Pos
+	if len(items) > 0 {
+		next = items[0].pos
+	}
+	p.trailingComment(open.Pos.Line, next)
+	p.newline()
+	p.indent++
+	p.line = 0
+	for i, it := range items {
+		p.flushComments(it.pos)
+		p.blank(it.pos.Line)
+		it.print()
+		p.print(",")
+		p.line = it.end.Line
+		next := close.Pos
+		if i+1 < len(items) {
+			next = items[i+1].pos
+		}
+		p.trailingComment(p.line, next)
+		p.newline()
+	}
+	p.flushComments(close.Pos)
+	p.indent--
+	p.print(close.Literal)
+}
@@ -0,0 +1,224 @@
+package printer
+
+import (
+	"dot/lexer"
+	"dot/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1+2*3;", "let x = 1 + 2 * 3\n"},
+		{"let y = ((1 + 2)) * 3", "let y = (1 + 2) * 3\n"},
+		{"a - (b - c); (a - b) - c", "a - (b - c)\na - b - c\n"},
+		{"a = (b = 1)", "a = b = 1\n"},
+		{"!(a && b) == -x.y", "!(a && b) == -x.y\n"},
+		{"(-x).y; - -x", "(-x).y;\n-(-x)\n"},
+		{"(fn(x) { x })(1)", "(fn(x) { x })(1)\n"},
+		{"let f = fn(a,b){a+b}", "let f = fn(a, b) { a + b }\n"},
+		{"let f = fn() {\nlet a = 1; a\n}", "let f = fn() {\n  let a = 1\n  a\n}\n"},
+		{"if (x) { 1 } else if (y) { 2 } else { 3 }", "if (x) { 1 } else if (y) { 2 } else { 3 }\n"},
+		{"while(true){break}", "while (true) { break }\n"},
+		{"for(let i=0;i<3;i+=1){}", "for (let i = 0; i < 3; i += 1) {}\n"},
+		{"for (k,v in h) { for (x in v) { print(x) } print(k) }", "for (k, v in h) { for (x in v) { print(x) } print(k) }\n"},
+		{"try { throw 'e' } catch(e) {} finally { f() }", "try { throw 'e' } catch (e) {} finally { f() }\n"},
+		{"import \"lib.dot\" as lib\nexport let x = lib.x", "import \"lib.dot\" as lib\nexport let x = lib.x\n"},
+		{"s[1:]; s[:2]; s[:]", "s[1:]\ns[:2]\ns[:]\n"},
+		{`let s = "a\t${ x + 1 }b${ "c" }" + 'd'`, `let s = "a\t${x + 1}b${"c"}" + 'd'` + "\n"},
+		{"let n = [1.50,   .25, 10]", "let n = [1.50, .25, 10]\n"},
+		{"let h = { \"a\": 1, \"b\": 2 }", "let h = {\"a\": 1, \"b\": 2}\n"},
+		{"let h = {\"a\": 1,\n\"b\": [1, 2]}", "let h = {\n  \"a\": 1,\n  \"b\": [1, 2],\n}\n"},
+		{"f(1,\n2)", "f(\n  1,\n  2,\n)\n"},
+		{"f(fn() {\nx\n})", "f(fn() {\n  x\n})\n"},
+		{"let x = 1;\n\n\n\nlet y = 2\n", "let x = 1\n\nlet y = 2\n"},
+		// a statement starting with a bracket, sign or ! would continue the one before it
+		{"let a = b;\n(c)()\nd; -1\nwhile (x) {}\n[1]", "let a = b\nc()\nd;\n-1\nwhile (x) {}\n[1]\n"},
+		{"let a = true;\n!a", "let a = true;\n!a\n"},
+		{"h[\"k\"] = 3;\n![h[\"k\"]]", "h[\"k\"] = 3;\n![h[\"k\"]]\n"},
+		{"x = `raw\n  text`", "x = `raw\n  text`\n"},
+		{"", ""},
+	}
+
+	for i, tt := range tests {
+		out, err := Format("", []byte(tt.input))
+		if err != nil {
+			t.Errorf("tests[%d] - %q: %s", i, tt.input, err)
+			continue
+		}
+		if string(out) != tt.expected {
+			t.Errorf("tests[%d] - wrong output for %q.\nexpected=%q\ngot=%q", i, tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// header
+
+let x = 1    // one
+let longer = 2 // two
+
+// before f
+let f = fn() { // opens
+  // first
+  x
+
+
+  // last
+}
+let h = [ // items
+  1, // one
+  2,
+  // end
+] // after
+print(h)
+// the end
+`
+	expected := `// header
+
+let x = 1      // one
+let longer = 2 // two
+
+// before f
+let f = fn() { // opens
+  // first
+  x
+
+  // last
+}
+let h = [ // items
+  1, // one
+  2,
+  // end
+] // after
+print(h)
+// the end
+`
+	out, err := Format("", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out)
+	}
+}
+
+// TestKeywordComments checks that comments around else, catch and finally
+// stay where they were written.
+func TestKeywordComments(t *testing.T) {
+	input := `if (x) {
+  1
+} // then
+else {
+  2
+}
+if (x) { 1 }
+// not x
+else if (y) { 2 } // y
+  else // neither
+{ 3 }
+try {
+  f()
+} // try
+catch (e) {
+  g(e)
+}
+// always
+finally {
+  h()
+}
+`
+	expected := `if (x) {
+  1
+} // then
+else {
+  2
+}
+if (x) { 1 }
+// not x
+else if (y) { 2 } // y
+else              // neither
+{ 3 }
+try {
+  f()
+} // try
+catch (e) {
+  g(e)
+}
+// always
+finally {
+  h()
+}
+`
+	out, err := Format("", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	_, err := Format("bad.dot", []byte("let = 1"))
+	if _, ok := err.(parser.ErrorList); !ok {
+		t.Fatalf("expected a parser.ErrorList, got %T (%v)", err, err)
+	}
+	if expected := "expected identifier after 'let' - at line 1, column 5"; err.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, err)
+	}
+}
+
+// TestStable formats the programs of the repository and checks that the
+// result parses to the same program and does not change when formatted
+// again, and that the programs are shipped formatted.
+func TestStable(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"../vm/testdata/*.dot", "../vm/testdata/modules/*.dot", "../std/*.dot"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no programs found")
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Format(file, src)
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		again, err := Format(file, out)
+		if err != nil {
+			t.Errorf("%s: formatted program does not parse: %s", file, err)
+			continue
+		}
+		if string(again) != string(out) {
+			t.Errorf("%s: formatting is not stable.\nfirst=%q\nsecond=%q", file, out, again)
+		}
+		if string(out) != string(src) {
+			t.Errorf("%s: not formatted; run dot fmt on it", file)
+		}
+		if parse(src) != parse(out) {
+			t.Errorf("%s: formatting changed the program.\nbefore=%q\nafter=%q", file, parse(src), parse(out))
+		}
+		if strings.Count(string(out), "//") < strings.Count(string(src), "//") {
+			t.Errorf("%s: formatting lost comments", file)
+		}
+	}
+}
+
+func parse(src []byte) string {
+	return parser.NewParser(lexer.NewLexer(string(src))).ParseProgram().String()
+}
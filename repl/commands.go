@@ -0,0 +1,115 @@
+package repl
+
+import (
+	"dot/lexer"
+	"dot/parser"
+	"dot/token"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a meta-command, typed as its name after a '.'.
+type command struct {
+	name string
+	args string // the arguments shown by .help
+	help string
+	// run runs the command with the rest of its line and returns false if
+	// the session should end
+	run func(r *REPL, arg string) bool
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"help", "", "show this help", (*REPL).help},
+		{"exit", "", "leave the REPL", func(r *REPL, arg string) bool { return false }},
+		{"break", "", "discard the lines of an unfinished input", func(r *REPL, arg string) bool { return true }},
+		{"load", "file", "run a file in this session", (*REPL).load},
+		{"env", "", "list the global variables and their values", (*REPL).env},
+		{"ast", "code", "show how code parses", (*REPL).ast},
+		{"tokens", "code", "show the tokens of code", (*REPL).tokens},
+		{"reset", "", "forget all variables and start over", (*REPL).resetCommand},
+	}
+}
+
+// isCommand reports whether line is a meta-command rather than code like
+// .5 + 1.
+func isCommand(line string) bool {
+	return len(line) > 1 && line[0] == '.' && ('a' <= line[1] && line[1] <= 'z')
+}
+
+// command runs the meta-command line and returns false if the session
+// should end.
+func (r *REPL) command(line string) bool {
+	name, arg, _ := strings.Cut(line[1:], " ")
+	arg = strings.TrimSpace(arg)
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(r, arg)
+		}
+	}
+	fmt.Fprintf(r.out, "unknown command .%s, type .help for the list\n", name)
+	return true
+}
+
+func (r *REPL) help(string) bool {
+	fmt.Fprintln(r.out, "Type Dot code to run it. Input continues on the next line while brackets are open.")
+	for _, c := range commands {
+		usage := "." + c.name
+		if c.args != "" {
+			usage += " " + c.args
+		}
+		fmt.Fprintf(r.out, "  %-14s %s\n", usage, c.help)
+	}
+	return true
+}
+
+func (r *REPL) load(path string) bool {
+	if path == "" {
+		fmt.Fprintln(r.out, "usage: .load file")
+		return true
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return true
+	}
+	r.run(lexer.NewFileLexer(path, string(src)))
+	return r.exit == nil
+}
+
+func (r *REPL) env(string) bool {
+	for _, name := range r.interp.Globals() {
+		obj, _ := r.interp.Lookup(name)
+		fmt.Fprintf(r.out, "%s = %s\n", name, value(obj))
+	}
+	return true
+}
+
+func (r *REPL) ast(code string) bool {
+	p := parser.NewParser(lexer.NewLexer(code))
+	program := p.ParseProgram()
+	for _, err := range p.Errors() {
+		fmt.Fprintf(r.out, "PARSER ERROR: %s\n", err)
+	}
+	for _, statement := range program.Statements {
+		fmt.Fprintf(r.out, "%s %s\n", strings.TrimPrefix(fmt.Sprintf("%T", statement), "*ast."), strings.TrimSpace(statement.String()))
+	}
+	return true
+}
+
+func (r *REPL) tokens(code string) bool {
+	l := lexer.NewLexer(code)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(r.out, "%d:%d %s %q\n", tok.Pos.Line, tok.Pos.Column, tok.Type, tok.Literal)
+	}
+	return true
+}
+
+func (r *REPL) resetCommand(string) bool {
+	r.reset()
+	fmt.Fprintln(r.out, "all variables forgotten")
+	return true
+}
@@ -0,0 +1,79 @@
+package repl
+
+import (
+	"dot/object"
+	"dot/token"
+	"sort"
+	"strings"
+)
+
+// Complete returns the completions of the word that ends at byte offset pos
+// of line, in sorted order, and the offset the word starts at. A word after
+// a '.' completes to the exports of a module or the keys of a hash, a word
+// after a '.' at the start of the line to a meta-command, and any other to
+// a keyword, a builtin or a global variable.
+func (r *REPL) Complete(line string, pos int) ([]string, int) {
+	start := wordStart(line, pos)
+	prefix := line[start:pos]
+	var names []string
+	switch {
+	case start == 1 && line[0] == '.':
+		for _, c := range commands {
+			names = append(names, c.name)
+		}
+	case start > 0 && line[start-1] == '.':
+		names = append(names, r.members(line[wordStart(line, start-1):start-1])...)
+	case prefix == "":
+		return nil, start
+	default:
+		for keyword := range token.Keywords {
+			names = append(names, keyword)
+		}
+		names = append(names, r.interp.Builtins()...)
+		names = append(names, r.interp.Globals()...)
+	}
+	sort.Strings(names)
+	var completions []string
+	for i, name := range names {
+		if strings.HasPrefix(name, prefix) && (i == 0 || name != names[i-1]) {
+			completions = append(completions, name)
+		}
+	}
+	return completions, start
+}
+
+// members returns the names that can follow name and a '.': the exports of
+// a module or the string keys of a hash.
+func (r *REPL) members(name string) []string {
+	obj, ok := r.interp.Lookup(name)
+	if !ok {
+		return nil
+	}
+	switch obj := obj.(type) {
+	case *object.Module:
+		return obj.Exports
+	case *object.Hash:
+		var keys []string
+		for _, key := range obj.Keys {
+			if s, ok := obj.Pairs[key].Key.(*object.String); ok {
+				keys = append(keys, s.Value)
+			}
+		}
+		return keys
+	}
+	return nil
+}
+
+// wordStart returns the offset of the start of the identifier that ends at
+// offset pos of line.
+func wordStart(line string, pos int) int {
+	start := pos
+	for start > 0 && isIdentifierChar(line[start-1]) {
+		start--
+	}
+	return start
+}
+
+func isIdentifierChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
@@ -0,0 +1,213 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by readLine when the user types Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// editor reads lines from a terminal in raw mode, so that it can edit them
+// and move through the history.
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	terminal *os.File
+	history  *History
+	complete func(line string, pos int) ([]string, int)
+}
+
+// lineState is a line being edited.
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int // the cursor, an index into buf
+	// index is the line of the history shown, or its length for the line
+	// being typed, which is kept in draft while the history is shown
+	index int
+	draft []rune
+}
+
+func ctrl(ch rune) rune {
+	return ch & 0x1f
+}
+
+// readLine prints prompt and reads a line, which the user can edit until
+// they press Enter. It returns io.EOF if the user types Ctrl-D on an empty
+// line and errInterrupted if they type Ctrl-C.
+func (e *editor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.terminal)
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+	s := &lineState{prompt: prompt, index: e.history.Len()}
+	e.refresh(s)
+	for {
+		ch, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch ch {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(s.buf), nil
+		case ctrl('C'):
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(s.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if s.pos < len(s.buf) {
+				s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+			}
+		case ctrl('A'):
+			s.pos = 0
+		case ctrl('E'):
+			s.pos = len(s.buf)
+		case ctrl('B'):
+			s.pos = max(s.pos-1, 0)
+		case ctrl('F'):
+			s.pos = min(s.pos+1, len(s.buf))
+		case ctrl('K'):
+			s.buf = s.buf[:s.pos]
+		case ctrl('U'):
+			s.buf = s.buf[s.pos:]
+			s.pos = 0
+		case ctrl('W'):
+			start := s.pos
+			for start > 0 && unicode.IsSpace(s.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(s.buf[start-1]) {
+				start--
+			}
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case ctrl('L'):
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case ctrl('P'):
+			e.showHistory(s, s.index-1)
+		case ctrl('N'):
+			e.showHistory(s, s.index+1)
+		case ctrl('H'), 127:
+			if s.pos > 0 {
+				s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+				s.pos--
+			}
+		case '\t':
+			e.completeWord(s)
+		case 27:
+			e.escape(s)
+		default:
+			if unicode.IsPrint(ch) {
+				s.buf = append(s.buf[:s.pos], append([]rune{ch}, s.buf[s.pos:]...)...)
+				s.pos++
+			}
+		}
+		e.refresh(s)
+	}
+}
+
+// escape handles the escape sequence sent by a key such as an arrow key,
+// after its ESC.
+func (e *editor) escape(s *lineState) {
+	ch, _, err := e.in.ReadRune()
+	if err != nil || (ch != '[' && ch != 'O') {
+		return
+	}
+	key, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+	if '0' <= key && key <= '9' {
+		// a key like Delete is sent as ESC [ digit ~
+		if next, _, err := e.in.ReadRune(); err != nil || next != '~' {
+			return
+		}
+	}
+	switch key {
+	case 'A':
+		e.showHistory(s, s.index-1)
+	case 'B':
+		e.showHistory(s, s.index+1)
+	case 'C':
+		s.pos = min(s.pos+1, len(s.buf))
+	case 'D':
+		s.pos = max(s.pos-1, 0)
+	case 'H', '1', '7':
+		s.pos = 0
+	case 'F', '4', '8':
+		s.pos = len(s.buf)
+	case '3':
+		if s.pos < len(s.buf) {
+			s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+		}
+	}
+}
+
+// showHistory replaces the line with the index-th line of the history, or
+// with the line being typed if index is the length of the history.
+func (e *editor) showHistory(s *lineState, index int) {
+	if index < 0 || index > e.history.Len() {
+		return
+	}
+	if s.index == e.history.Len() {
+		s.draft = s.buf
+	}
+	s.index = index
+	if index == e.history.Len() {
+		s.buf = s.draft
+	} else {
+		s.buf = []rune(e.history.Line(index))
+	}
+	s.pos = len(s.buf)
+}
+
+// completeWord completes the word before the cursor as far as all of its
+// completions agree, and lists them if they agree no further.
+func (e *editor) completeWord(s *lineState) {
+	line := string(s.buf)
+	pos := len(string(s.buf[:s.pos]))
+	completions, start := e.complete(line, pos)
+	if len(completions) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return
+	}
+	common := completions[0]
+	for _, c := range completions[1:] {
+		for !strings.HasPrefix(c, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if word := line[start:pos]; len(common) > len(word) {
+		insert := []rune(common[len(word):])
+		s.buf = append(s.buf[:s.pos], append(insert, s.buf[s.pos:]...)...)
+		s.pos += len(insert)
+		return
+	}
+	if len(completions) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(completions, "  "))
+	}
+}
+
+// refresh redraws the line and puts the cursor in its place.
+func (e *editor) refresh(s *lineState) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", s.prompt, string(s.buf))
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
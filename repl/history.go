@@ -0,0 +1,78 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// maxHistory is the number of lines a history keeps.
+const maxHistory = 1000
+
+// History is the list of lines typed at the prompt, oldest first. A
+// history loaded from a file saves every line added to it to the file.
+type History struct {
+	lines []string
+	file  string
+}
+
+// Load reads the history saved in file, which need not exist yet, and
+// saves lines added from now on to it.
+func (h *History) Load(file string) error {
+	h.file = file
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.lines = append(h.lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(h.lines) > maxHistory {
+		// keep the file from growing without bound
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+		return os.WriteFile(file, []byte(strings.Join(h.lines, "\n")+"\n"), 0o600)
+	}
+	return nil
+}
+
+// Add adds line to the end of the history, unless it is blank or the same
+// as the last line.
+func (h *History) Add(line string) {
+	if strings.TrimSpace(line) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == line) {
+		return
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[1:]
+	}
+	if h.file == "" {
+		return
+	}
+	f, err := os.OpenFile(h.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		// a history that cannot be saved is still kept for this session
+		return
+	}
+	defer f.Close()
+	f.WriteString(line + "\n")
+}
+
+// Len returns the number of lines in the history.
+func (h *History) Len() int {
+	return len(h.lines)
+}
+
+// Line returns the i-th line of the history, counting from the oldest.
+func (h *History) Line(i int) string {
+	return h.lines[i]
+}
@@ -0,0 +1,217 @@
+// Package repl implements the interactive prompt of the dot command. It
+// reads input until it forms a complete program, so functions and blocks
+// can span several lines, runs it in an interpreter that keeps its globals
+// between inputs, and understands meta-commands starting with a '.', such
+// as .help.
+//
+// When reading from a terminal the prompt edits lines itself: the arrow
+// keys move through the line and the history, which is kept in a file
+// between sessions, and tab completes keywords, builtins and global names.
+package repl
+
+import (
+	"bufio"
+	"dot/interp"
+	"dot/lexer"
+	"dot/object"
+	"dot/parser"
+	"dot/token"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	prompt             = ">> "
+	continuationPrompt = ".. "
+)
+
+// REPL is an interactive session.
+type REPL struct {
+	// HistoryFile is the file the history of a session on a terminal is
+	// loaded from and saved to. If it is empty history is not kept.
+	HistoryFile string
+
+	in   *bufio.Reader
+	out  io.Writer
+	opts []interp.Option
+	// terminal is the terminal input comes from, or nil
+	terminal *os.File
+
+	interp  *interp.Interpreter
+	history *History
+	// pending holds the lines of an incomplete input read so far
+	pending []string
+	// exit is set once a program calls exit, which ends the session
+	exit *interp.ExitError
+}
+
+// New returns a REPL reading from in and writing to out, running input in
+// an interpreter configured with opts. Programs calling ask read from in as
+// well, so they see the lines typed after the input that called it.
+func New(in io.Reader, out io.Writer, opts ...interp.Option) *REPL {
+	r := &REPL{
+		HistoryFile: DefaultHistoryFile(),
+		in:          bufio.NewReader(in),
+		out:         out,
+		opts:        opts,
+	}
+	if f, ok := in.(*os.File); ok && isTerminal(f) {
+		r.terminal = f
+	}
+	r.reset()
+	return r
+}
+
+// DefaultHistoryFile returns the file named by $DOT_HISTORY, or
+// .dot_history in the home directory.
+func DefaultHistoryFile() string {
+	if file := os.Getenv("DOT_HISTORY"); file != "" {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".dot_history")
+}
+
+// reset starts over with a new interpreter.
+func (r *REPL) reset() {
+	opts := append(r.opts[:len(r.opts):len(r.opts)], interp.WithStdin(r.in))
+	r.interp = interp.New(opts...)
+}
+
+// Run reads and runs input until the end of the input or .exit. If a
+// program calls exit it ends the session and Run returns its
+// *interp.ExitError.
+func (r *REPL) Run() error {
+	var read func(prompt string) (string, error)
+	if r.terminal != nil {
+		r.history = &History{}
+		if r.HistoryFile != "" {
+			if err := r.history.Load(r.HistoryFile); err != nil {
+				fmt.Fprintf(r.out, "cannot load history: %s\n", err)
+			}
+		}
+		e := &editor{in: r.in, out: r.out, terminal: r.terminal, history: r.history, complete: r.Complete}
+		read = e.readLine
+	} else {
+		read = r.readLine
+	}
+	fmt.Fprintln(r.out, "Welcome to Dot programming language")
+	fmt.Fprintln(r.out, "Type '.help' for help or '.exit' to exit")
+	for {
+		p := prompt
+		if len(r.pending) > 0 {
+			p = continuationPrompt
+		}
+		line, err := read(p)
+		if errors.Is(err, errInterrupted) {
+			r.pending = nil
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if r.history != nil {
+			r.history.Add(line)
+		}
+		if !r.Input(line) {
+			if r.exit != nil {
+				return r.exit
+			}
+			return nil
+		}
+	}
+}
+
+// readLine prints prompt and reads a line from input that is not a
+// terminal.
+func (r *REPL) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	line, err := r.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Input handles a line of input: it runs a meta-command, or runs the lines
+// read since the last complete input once they form one. It returns false
+// if the session should end.
+func (r *REPL) Input(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if len(r.pending) == 0 && isCommand(trimmed) {
+		return r.command(trimmed)
+	}
+	if len(r.pending) > 0 && trimmed == ".break" {
+		r.pending = nil
+		return true
+	}
+	r.pending = append(r.pending, line)
+	src := strings.Join(r.pending, "\n")
+	if Incomplete(src) {
+		return true
+	}
+	r.pending = nil
+	if strings.TrimSpace(src) != "" {
+		r.run(lexer.NewLexer(src))
+	}
+	return r.exit == nil
+}
+
+// run runs the program read by l and prints its value or its errors.
+func (r *REPL) run(l *lexer.Lexer) {
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(r.out, "PARSER ERROR: %s\n", err)
+		}
+		return
+	}
+	result, err := r.interp.Eval(program)
+	if errors.As(err, &r.exit) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+	fmt.Fprintln(r.out, result.String())
+}
+
+// Incomplete reports whether src needs more lines to be a program: it has
+// brackets that are not closed yet, or a raw string that is not.
+func Incomplete(src string) bool {
+	l := lexer.NewLexer(src)
+	depth := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		case token.ILLEGAL:
+			if tok.Literal == "unterminated raw string" {
+				return true
+			}
+		}
+	}
+	return depth > 0
+}
+
+// value returns the text of a value for .env, quoting strings.
+func value(obj object.Object) string {
+	if s, ok := obj.(*object.String); ok {
+		return fmt.Sprintf("%q", s.Value)
+	}
+	return obj.String()
+}
@@ -0,0 +1,150 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n  x\n}", false},
+		{"if (x) {\n  [1,\n", true},
+		{"print(\"}\"", true},
+		{"let s = `raw", true},
+		{"let s = `raw\ntext`", false},
+		{"let s = \"open", false},
+		{"}", false},
+	}
+
+	for i, tt := range tests {
+		if got := Incomplete(tt.input); got != tt.expected {
+			t.Errorf("tests[%d] - Incomplete(%q) = %t, want %t", i, tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.dot")
+	if err := os.WriteFile(lib, []byte("let twice = fn(x) { x * 2 }\ntwice(21)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Join([]string{
+		"let add = fn(a, b) {",
+		"  a + b",
+		"}",
+		"add(1, 2)",
+		"let xs = [1,",
+		".break",
+		".5 + 1",
+		"let name = ask()",
+		"Ada",
+		".load " + lib,
+		".env",
+		".ast 1 + 2 * 3",
+		".tokens x[0]",
+		".reset",
+		".env",
+		"twice(1)",
+		"1 +",
+		".nope",
+		".exit",
+		"print(\"not reached\")",
+	}, "\n")
+	var out strings.Builder
+	r := New(strings.NewReader(input), &out)
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"fn",
+		"3",
+		"1.5",
+		"Ada",
+		"42",
+		`add = fn`,
+		`name = "Ada"`,
+		`twice = fn`,
+		"ExpressionStatement (1 + (2 * 3));",
+		`1:1 IDENTIFIER "x"`,
+		`1:2 [ "["`,
+		`1:3 INTEGER "0"`,
+		`1:4 ] "]"`,
+		"all variables forgotten",
+		"NameError: identifier not found: twice - at line 1, column 1",
+		"PARSER ERROR: unexpected end of input - at line 1, column 4",
+		"unknown command .nope, type .help for the list",
+	}
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n")[2:] {
+		for strings.HasPrefix(line, prompt) || strings.HasPrefix(line, continuationPrompt) {
+			line = line[len(prompt):]
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, lines)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	r := New(strings.NewReader(""), &strings.Builder{})
+	r.Input(`let counter = 1`)
+	r.Input(`let config = {"debug": true, "depth": 3, 1: 2}`)
+
+	tests := []struct {
+		line        string
+		completions []string
+		start       int
+	}{
+		{"co", []string{"config", "contains", "continue", "copy", "counter"}, 0},
+		{"1 + cou", []string{"counter"}, 4},
+		{"print(whi", []string{"while"}, 6},
+		{"config.de", []string{"debug", "depth"}, 7},
+		{"config.", []string{"debug", "depth"}, 7},
+		{".re", []string{"reset"}, 1},
+		{"1 + ", nil, 4},
+		{"nothing", nil, 0},
+	}
+
+	for i, tt := range tests {
+		completions, start := r.Complete(tt.line, len(tt.line))
+		if !reflect.DeepEqual(completions, tt.completions) || start != tt.start {
+			t.Errorf("tests[%d] - Complete(%q) = %q, %d, want %q, %d", i, tt.line, completions, start, tt.completions, tt.start)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	h := &History{}
+	if err := h.Load(file); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"let x = 1", "", "x", "x", "x + 1"} {
+		h.Add(line)
+	}
+
+	loaded := &History{}
+	if err := loaded.Load(file); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for i := 0; i < loaded.Len(); i++ {
+		lines = append(lines, loaded.Line(i))
+	}
+	if expected := []string{"let x = 1", "x", "x + 1"}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("wrong history. expected=%q, got=%q", expected, lines)
+	}
+}
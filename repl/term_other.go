@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package repl
+
+import (
+	"errors"
+	"os"
+)
+
+// isTerminal reports whether f is a terminal whose lines the REPL can edit,
+// which it cannot on this system.
+func isTerminal(f *os.File) bool {
+	return false
+}
+
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this system")
+}
@@ -0,0 +1,22 @@
+// Package std holds the standard library of Dot: modules written in Dot
+// that are bundled into the binary and imported as "std/<name>".
+//
+// A module of the standard library can also use Go functions, which are
+// faster than the same code written in Dot. They are given to it as the
+// hash native, see eval.ModuleEnvironment.
+package std
+
+import "embed"
+
+//go:embed *.dot
+var files embed.FS
+
+// Source returns the source of the module called name, such as "strings"
+// for std/strings, and reports whether there is one.
+func Source(name string) (string, bool) {
+	src, err := files.ReadFile(name + ".dot")
+	if err != nil {
+		return "", false
+	}
+	return string(src), true
+}
@@ -1,10 +1,13 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 const (
 	IDENTIFIER = "IDENTIFIER"
 	INTEGER    = "INTEGER"
+	FLOAT      = "FLOAT"
 	TRUE       = "TRUE"
 	FALSE      = "FALSE"
 	LET        = "LET"
@@ -16,6 +19,24 @@ const (
 	RETURN     = "RETURN"
 	WHILE      = "WHILE"
 	FOR        = "FOR"
+	IN         = "IN"
+	TRY        = "TRY"
+	CATCH      = "CATCH"
+	FINALLY    = "FINALLY"
+	THROW      = "THROW"
+	BREAK      = "BREAK"
+	CONTINUE   = "CONTINUE"
+	IMPORT     = "IMPORT"
+	EXPORT     = "EXPORT"
+	AS         = "AS"
+
+	// A string with expressions in ${...} is read as a STRING_HEAD with
+	// the text before the first expression, the tokens of the expression,
+	// then a STRING_MIDDLE with the text up to the next expression or a
+	// STRING_TAIL with the text up to the closing quote.
+	STRING_HEAD   = "STRING_HEAD"
+	STRING_MIDDLE = "STRING_MIDDLE"
+	STRING_TAIL   = "STRING_TAIL"
 
 	PLUS        = "+"
 	MINUS       = "-"
@@ -40,6 +61,7 @@ const (
 	GTE         = ">="
 	BANG        = "!"
 	COLON       = ":"
+	DOT         = "."
 	LBRACKET    = "["
 	RBRACKET    = "]"
 	COMMENT     = "//"
@@ -47,21 +69,66 @@ const (
 	OR          = "||"
 
 	UNKNOWN = "UNKNOWN"
+	// ILLEGAL is a token the lexer could not read, such as an unterminated
+	// string. Its literal is the reason.
+	ILLEGAL = "ILLEGAL"
 )
 
+// Position is a location in Dot source. Offset is the 0-based byte offset
+// into the input, Line and Column are 1-based.
+type Position struct {
+	File   string
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position refers to an actual source location.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position as "file:line:column", leaving out the parts
+// that are not known.
+func (p Position) String() string {
+	s := p.File
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // position of the first character of the token
+	End     Position // position immediately after the token
 }
 
 var Keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"true":   TRUE,
-	"false":  FALSE,
-	"let":    LET,
-	"if":     IF,
-	"return": RETURN,
-	"else":   ELSE,
-	"while":  WHILE,
-	"for":    FOR,
+	"fn":       FUNCTION,
+	"true":     TRUE,
+	"false":    FALSE,
+	"let":      LET,
+	"if":       IF,
+	"return":   RETURN,
+	"else":     ELSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+	"export":   EXPORT,
+	"as":       AS,
 }
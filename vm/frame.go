@@ -0,0 +1,31 @@
+package vm
+
+import (
+	"dot/code"
+	"dot/object"
+	"dot/token"
+)
+
+// Frame is the activation of one call: the closure being run, its
+// instruction pointer and where its variables are kept.
+type Frame struct {
+	cl *object.Closure
+	ip int
+	// basePointer is the stack slot of the first variable of the call,
+	// which is its first argument
+	basePointer int
+	// cells hold the variables of the call that closures capture
+	cells []*object.Cell
+	// module is the absolute path of the module file the frame runs, if
+	// it runs one
+	module string
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// Pos returns the source span of the instruction being executed.
+func (f *Frame) Pos() (pos, end token.Position) {
+	return f.cl.Fn.Positions.Lookup(f.ip)
+}
@@ -0,0 +1,694 @@
+// Package vm runs bytecode produced by package compiler. It implements the
+// same language as the tree-walking evaluator in package eval and shares its
+// operator semantics and builtins.
+package vm
+
+import (
+	"dot/code"
+	"dot/compiler"
+	"dot/eval"
+	"dot/object"
+)
+
+// StackSize and MaxFrames are the sizes the stack and the frames start
+// with. Both grow as deeper calls need, up to the depth allowed by
+// object.Runtime.Enter.
+const StackSize = 2048
+const MaxFrames = 1024
+
+// operators gives the evaluator's operator for each opcode of one.
+var operators = [...]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpGreaterThan:  ">",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+	code.OpAnd:          "&&",
+	code.OpOr:           "||",
+	code.OpMinus:        "-",
+	code.OpPlus:         "+",
+	code.OpBang:         "!",
+}
+
+type VM struct {
+	runtime   *object.Runtime
+	constants []object.Object
+	// builtins holds, for the global variables of each environment that
+	// have been looked up while undefined, the builtins of the same name,
+	// or noBuiltin, so that calls of builtins do not go through the
+	// builtin table each time
+	builtins map[*object.Environment][]*object.Builtin
+
+	stack []object.Object
+	sp    int // always points to the next free slot; top of stack is stack[sp-1]
+
+	// frames are reused by later calls once their calls have returned
+	frames      []*Frame
+	framesIndex int
+	// bottom is the number of frames below those of the innermost run,
+	// which is a call made by a builtin if it is not zero
+	bottom int
+
+	handlers []handler
+
+	// caller is the method value of call, made once
+	caller object.Caller
+}
+
+// handler is an error handler installed by OpTry, together with the state
+// to restore when it catches an error.
+type handler struct {
+	catchIP     int
+	framesIndex int
+	sp          int
+}
+
+// noBuiltin marks a global variable without a builtin of the same name.
+var noBuiltin = &object.Builtin{}
+
+// New returns a virtual machine that runs bytecode with its global
+// variables kept in env.
+func New(bytecode *compiler.Bytecode, env *object.Environment) *VM {
+	env.Number(bytecode.Globals)
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+		Locals:       bytecode.Locals,
+		Cells:        bytecode.Cells,
+		Chains:       bytecode.Chains,
+	}
+	vm := &VM{
+		runtime:   env.Runtime(),
+		constants: bytecode.Constants,
+		builtins:  make(map[*object.Environment][]*object.Builtin),
+		stack:     make([]object.Object, StackSize),
+		frames:    make([]*Frame, MaxFrames),
+	}
+	vm.pushFrame(&object.Closure{Fn: mainFn, Env: env}, 0, 0)
+	vm.caller = vm.call
+	return vm
+}
+
+// Call calls fn with args on a new virtual machine, for a host program
+// calling into Dot. constants is the constant pool fn was compiled with and
+// env the global environment of the program that defined it.
+func Call(constants []object.Object, env *object.Environment, fn object.Object, args []object.Object) object.Object {
+	instructions := append(code.Make(code.OpCall, len(args)), code.Make(code.OpReturnValue)...)
+	vm := New(&compiler.Bytecode{Instructions: instructions, Constants: constants}, env)
+	vm.stack[0] = fn
+	copy(vm.stack[1:], args)
+	vm.sp = 1 + len(args)
+	return vm.Run()
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// pushFrame pushes a frame running cl, whose variables are kept from the
+// stack slot basePointer on. The first n of them, its arguments, are there
+// already; the others start out undefined.
+func (vm *VM) pushFrame(cl *object.Closure, basePointer int, n int) *Frame {
+	if vm.framesIndex >= len(vm.frames) {
+		vm.frames = append(vm.frames, make([]*Frame, len(vm.frames))...)
+	}
+	frame := vm.frames[vm.framesIndex]
+	if frame == nil {
+		frame = &Frame{}
+		vm.frames[vm.framesIndex] = frame
+	}
+	*frame = Frame{cl: cl, ip: -1, basePointer: basePointer}
+	if cl.Fn.Cells > 0 {
+		frame.cells = make([]*object.Cell, cl.Fn.Cells)
+	}
+	vm.framesIndex++
+
+	top := basePointer + cl.Fn.Locals
+	for top > len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	clear(vm.stack[basePointer+n : top])
+	vm.sp = top
+	return frame
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run executes the program and returns its value, which is an *object.Error
+// if the program failed.
+func (vm *VM) Run() object.Object {
+	return vm.run()
+}
+
+// call calls fn with args for a builtin, running the frames of the call
+// until it returns. Errors raised inside are caught only by the handlers
+// installed inside.
+func (vm *VM) call(fn object.Object, args []object.Object) object.Object {
+	sp, bottom := vm.sp, vm.bottom
+	defer func() { vm.sp, vm.bottom = sp, bottom }()
+	for _, o := range append([]object.Object{fn}, args...) {
+		if err := vm.push(o); err != nil {
+			return err
+		}
+	}
+	frames := vm.framesIndex
+	if err := vm.executeCall(len(args)); err != nil {
+		return err
+	}
+	if vm.framesIndex == frames {
+		// a builtin, which has pushed its result
+		return vm.pop()
+	}
+	vm.bottom = frames
+	return vm.run()
+}
+
+func (vm *VM) run() object.Object {
+	for {
+		frame := vm.currentFrame()
+		frame.ip++
+		ins := frame.Instructions()
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		if err := vm.runtime.Step(); err != nil {
+			if !vm.raise(err) {
+				return err
+			}
+			continue
+		}
+
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			idx := code.ReadUint32(ins[ip+1:])
+			frame.ip += 4
+			err = vm.push(vm.constants[idx])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpNull:
+			err = vm.push(eval.NULL)
+		case code.OpTrue:
+			err = vm.push(eval.TRUE)
+		case code.OpFalse:
+			err = vm.push(eval.FALSE)
+		case code.OpEmpty:
+			err = vm.push(eval.EMPTY)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+			code.OpLessEqual, code.OpGreaterEqual, code.OpAnd, code.OpOr:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.executeBinaryOperation(op, left, right))
+
+		case code.OpMinus, code.OpPlus, code.OpBang:
+			right := vm.pop()
+			err = vm.pushResult(eval.PrefixOperation(operators[op], right))
+
+		case code.OpJump:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			if !eval.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpGetLocal:
+			idx := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			err = vm.push(vm.stack[frame.basePointer+idx])
+		case code.OpGetCell:
+			idx := code.ReadUint32(ins[ip+1:])
+			frame.ip += 4
+			err = vm.push(frame.cells[idx].Value)
+		case code.OpGetFree:
+			idx := code.ReadUint32(ins[ip+1:])
+			frame.ip += 4
+			err = vm.push(frame.cl.Free[idx].Value)
+		case code.OpGetGlobal:
+			idx := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			err = vm.pushGlobal(frame.cl.Env, idx)
+
+		case code.OpSetLocal:
+			idx := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			vm.stack[frame.basePointer+idx] = vm.stack[vm.sp-1]
+		case code.OpSetCell:
+			idx := code.ReadUint32(ins[ip+1:])
+			frame.ip += 4
+			frame.cells[idx].Value = vm.stack[vm.sp-1]
+		case code.OpSetFree:
+			idx := code.ReadUint32(ins[ip+1:])
+			frame.ip += 4
+			frame.cl.Free[idx].Value = vm.stack[vm.sp-1]
+		case code.OpSetGlobal:
+			idx := code.ReadUint32(ins[ip+1:])
+			frame.ip += 4
+			frame.cl.Env.Slots[idx] = vm.stack[vm.sp-1]
+
+		case code.OpClearLocal:
+			idx := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			vm.stack[frame.basePointer+idx] = nil
+		case code.OpNewCell:
+			idx := code.ReadUint32(ins[ip+1:])
+			frame.ip += 4
+			frame.cells[idx] = &object.Cell{}
+
+		case code.OpGetName:
+			chain := frame.cl.Fn.Chains[code.ReadUint32(ins[ip+1:])]
+			frame.ip += 4
+			if v := vm.find(frame, chain.Path); v != nil {
+				err = vm.push(*v)
+			} else {
+				// the chains that can find nothing end with a global
+				err = vm.pushGlobal(frame.cl.Env, chain.Path[len(chain.Path)-1].Index)
+			}
+
+		case code.OpAssignName:
+			chain := frame.cl.Fn.Chains[code.ReadUint32(ins[ip+1:])]
+			frame.ip += 4
+			if v := vm.find(frame, chain.Path); v != nil {
+				*v = vm.stack[vm.sp-1]
+			} else {
+				err = object.NewError(object.NameError, "identifier not found: %s", chain.Name)
+			}
+
+		case code.OpSetName:
+			chain := frame.cl.Fn.Chains[code.ReadUint32(ins[ip+1:])]
+			frame.ip += 4
+			v := vm.find(frame, chain.Path)
+			if v == nil {
+				v = vm.variable(frame, chain.Path[0])
+			}
+			*v = vm.stack[vm.sp-1]
+
+		case code.OpArray:
+			numElements := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			err = vm.pushResult(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			hash, hashErr := vm.buildHash(vm.sp-numElements, vm.sp)
+			if hashErr != nil {
+				err = hashErr
+				break
+			}
+			vm.sp -= numElements
+			err = vm.pushResult(hash)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(eval.IndexOperation(left, index))
+
+		case code.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(eval.SliceOperation(left, low, high))
+
+		case code.OpInterpolate:
+			numValues := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			str := eval.Interpolate(vm.stack[vm.sp-numValues : vm.sp])
+			vm.sp -= numValues
+			err = vm.pushResult(str)
+
+		case code.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			container := vm.pop()
+			if err = vm.pushResult(eval.SetIndex(container, index, val)); err == nil {
+				// a hash grows with every new key
+				err = vm.runtime.CheckSize(container)
+			}
+
+		case code.OpClosure:
+			idx := code.ReadUint32(ins[ip+1:])
+			frame.ip += 4
+			err = vm.push(vm.newClosure(frame, vm.constants[idx].(*object.CompiledFunction)))
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			err = vm.executeCall(numArgs)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			frame := vm.popFrame()
+			if vm.framesIndex == 0 {
+				return returnValue
+			}
+			vm.runtime.Leave()
+			if frame.module != "" {
+				returnValue = vm.finishImport(frame)
+				vm.sp = frame.basePointer
+			} else {
+				// the function called is below its arguments
+				vm.sp = frame.basePointer - 1
+			}
+			if vm.framesIndex == vm.bottom {
+				return returnValue
+			}
+			err = vm.push(returnValue)
+
+		case code.OpTry:
+			catchIP := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			vm.handlers = append(vm.handlers, handler{catchIP: catchIP, framesIndex: vm.framesIndex, sp: vm.sp})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpCatch:
+			vm.stack[vm.sp-1] = eval.CaughtValue(vm.stack[vm.sp-1].(*object.Error))
+		case code.OpThrow:
+			val := vm.pop()
+			if thrown, ok := val.(*object.Error); ok {
+				// raised again after a finally block
+				err = thrown
+			} else {
+				err = eval.ThrowError(val)
+			}
+
+		case code.OpIter:
+			err = vm.pushResult(eval.Iterate(vm.pop()))
+		case code.OpIterNext:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			vars := code.ReadUint8(ins[ip+5:])
+			frame.ip += 5
+			it := vm.stack[vm.sp-1].(*object.Iterator)
+			key, value, ok := it.Next()
+			switch {
+			case !ok:
+				frame.ip = pos - 1
+			case vars == 1:
+				err = vm.push(it.Single(key, value))
+			default:
+				if err = vm.push(key); err == nil {
+					err = vm.push(value)
+				}
+			}
+
+		case code.OpImport:
+			path := vm.name(ins[ip+1:])
+			module := vm.constants[code.ReadUint32(ins[ip+5:])]
+			frame.ip += 8
+			err = vm.importModule(path, module)
+
+		default:
+			err = object.NewError(object.RuntimeError, "unknown opcode %d", op)
+		}
+
+		if err != nil && !vm.raise(err) {
+			return err
+		}
+	}
+}
+
+// raise gives err the position of the current instruction if it has none
+// and passes it to the innermost handler. It reports false if there is no
+// handler in the innermost run, leaving the run to stop with err.
+func (vm *VM) raise(err *object.Error) bool {
+	if !err.Pos.IsValid() {
+		err.Pos, err.End = vm.currentFrame().Pos()
+		err.Stack = vm.stackTrace()
+	}
+	if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].framesIndex <= vm.bottom {
+		vm.unwind(max(vm.bottom, 1))
+		return false
+	}
+	vm.catch(err)
+	return true
+}
+
+// unwind discards the frames above the first n, ending their calls and
+// the imports of the modules they run.
+func (vm *VM) unwind(n int) {
+	for vm.framesIndex > n {
+		if frame := vm.popFrame(); frame.module != "" {
+			vm.runtime.EndImport(frame.module, nil)
+		}
+		vm.runtime.Leave()
+	}
+}
+
+// catch passes err to the innermost handler, discarding the frames and
+// stack slots entered since it was installed.
+func (vm *VM) catch(err *object.Error) {
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.unwind(h.framesIndex)
+	vm.currentFrame().ip = h.catchIP - 1
+	vm.sp = h.sp
+	vm.push(err)
+}
+
+func (vm *VM) name(operand code.Instructions) string {
+	return vm.constants[code.ReadUint32(operand)].(*object.String).Value
+}
+
+// variable returns the variable at loc of the call frame runs.
+func (vm *VM) variable(frame *Frame, loc code.Location) *object.Object {
+	switch loc.Scope {
+	case code.LocalScope:
+		return &vm.stack[frame.basePointer+loc.Index]
+	case code.CellScope:
+		return &frame.cells[loc.Index].Value
+	case code.FreeScope:
+		return &frame.cl.Free[loc.Index].Value
+	default:
+		return &frame.cl.Env.Slots[loc.Index]
+	}
+}
+
+// find returns the first variable along path that is defined, or nil if
+// there is none.
+func (vm *VM) find(frame *Frame, path []code.Location) *object.Object {
+	for _, loc := range path {
+		if v := vm.variable(frame, loc); *v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// pushGlobal pushes global variable idx of env or, if it is not defined,
+// the builtin of the same name. If there is neither, it returns a
+// NameError.
+func (vm *VM) pushGlobal(env *object.Environment, idx int) *object.Error {
+	if val := env.Slots[idx]; val != nil {
+		return vm.push(val)
+	}
+	cache := vm.builtins[env]
+	if idx >= len(cache) {
+		cache = append(cache, make([]*object.Builtin, idx+1-len(cache))...)
+		vm.builtins[env] = cache
+	}
+	if cache[idx] == nil {
+		cache[idx] = noBuiltin
+		if fn, ok := eval.LookupBuiltin(vm.runtime, env.SlotName(idx)); ok {
+			cache[idx] = fn
+		}
+	}
+	if cache[idx] == noBuiltin {
+		return object.NewError(object.NameError, "identifier not found: %s", env.SlotName(idx))
+	}
+	return vm.push(cache[idx])
+}
+
+// newClosure creates a closure of fn in the call frame runs, capturing the
+// cells fn refers to.
+func (vm *VM) newClosure(frame *Frame, fn *object.CompiledFunction) *object.Closure {
+	cl := &object.Closure{Fn: fn, Env: frame.cl.Env}
+	if len(fn.Captures) > 0 {
+		cl.Free = make([]*object.Cell, len(fn.Captures))
+		for i, loc := range fn.Captures {
+			if loc.Scope == code.CellScope {
+				cl.Free[i] = frame.cells[loc.Index]
+			} else {
+				cl.Free[i] = frame.cl.Free[loc.Index]
+			}
+		}
+	}
+	return cl
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+// pushResult pushes the result of an operation unless it is an error, or
+// larger than the runtime allows, in which case the error is returned
+// instead.
+func (vm *VM) pushResult(o object.Object) *object.Error {
+	if err, ok := o.(*object.Error); ok {
+		return err
+	}
+	if err := vm.runtime.CheckSize(o); err != nil {
+		return err
+	}
+	return vm.push(o)
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// executeBinaryOperation compares 64-bit integers directly and leaves every
+// other operation to the evaluator's.
+func (vm *VM) executeBinaryOperation(op code.Opcode, left object.Object, right object.Object) object.Object {
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if !lok || !rok || l.IsBig() || r.IsBig() {
+		return eval.InfixOperation(operators[op], left, right)
+	}
+	switch op {
+	case code.OpLessThan:
+		return nativeBoolToBooleanObject(l.Value < r.Value)
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(l.Value > r.Value)
+	case code.OpLessEqual:
+		return nativeBoolToBooleanObject(l.Value <= r.Value)
+	case code.OpGreaterEqual:
+		return nativeBoolToBooleanObject(l.Value >= r.Value)
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(l.Value == r.Value)
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(l.Value != r.Value)
+	default:
+		return eval.InfixOperation(operators[op], left, right)
+	}
+}
+
+func nativeBoolToBooleanObject(b bool) *object.Boolean {
+	if b {
+		return eval.TRUE
+	}
+	return eval.FALSE
+}
+
+func (vm *VM) buildHash(startIndex int, endIndex int) (object.Object, *object.Error) {
+	hash := object.NewHash()
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, object.NewError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+	return hash, nil
+}
+
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		if err := vm.runtime.Permit(callee); err != nil {
+			return err
+		}
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		previous := vm.runtime.SetCaller(vm.caller)
+		result := callee.Fn(vm.runtime, args...)
+		vm.runtime.SetCaller(previous)
+		vm.sp = vm.sp - numArgs - 1
+		return vm.pushResult(result)
+	default:
+		return object.NewError(object.TypeError, "not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	params := cl.Fn.Parameters
+	if numArgs < len(params) {
+		return object.NewError(object.ArgumentError, "wrong number of arguments: want=%d, got=%d", len(params), numArgs)
+	}
+	if err := vm.runtime.Enter(); err != nil {
+		return err
+	}
+	vm.pushFrame(cl, vm.sp-numArgs, len(params))
+	return nil
+}
+
+// importModule pushes the module at path, or the frame running module, the
+// compiled module file, if it has not been imported yet.
+func (vm *VM) importModule(path string, module object.Object) *object.Error {
+	if m, ok := vm.runtime.Imported(path); ok {
+		return vm.push(m)
+	}
+	if err := vm.runtime.BeginImport(path); err != nil {
+		return err
+	}
+	fn, ok := module.(*object.CompiledFunction)
+	if !ok {
+		vm.runtime.EndImport(path, nil)
+		// a copy, since errors are given positions as they are raised
+		err := *module.(*object.Error)
+		if !err.Pos.IsValid() {
+			return &err
+		}
+		pos, _ := vm.currentFrame().Pos()
+		err.Stack = append(vm.stackTrace(), object.StackFrame{Function: object.ModuleFunction, Pos: pos})
+		return &err
+	}
+	if err := vm.runtime.Enter(); err != nil {
+		vm.runtime.EndImport(path, nil)
+		return err
+	}
+	env := eval.ModuleEnvironment(vm.runtime, path)
+	env.Number(fn.Globals)
+	frame := vm.pushFrame(&object.Closure{Fn: fn, Env: env}, vm.sp, 0)
+	frame.module = path
+	return nil
+}
+
+// finishImport returns the module run by frame, which has just returned,
+// and caches it for later imports.
+func (vm *VM) finishImport(frame *Frame) *object.Module {
+	m := &object.Module{Path: eval.DisplayPath(frame.module), Env: frame.cl.Env, Exports: frame.cl.Fn.Exports}
+	vm.runtime.EndImport(frame.module, m)
+	return m
+}
+
+// stackTrace returns the calls on the frame stack, outermost first, each
+// made at the instruction its caller is executing.
+func (vm *VM) stackTrace() []object.StackFrame {
+	stack := make([]object.StackFrame, 0, vm.framesIndex-1)
+	for i := 1; i < vm.framesIndex; i++ {
+		pos, _ := vm.frames[i-1].Pos()
+		stack = append(stack, object.StackFrame{Function: object.FunctionName(vm.frames[i].cl.Fn.Name), Pos: pos})
+	}
+	return stack
+}
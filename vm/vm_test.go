@@ -0,0 +1,185 @@
+package vm
+
+import (
+	"dot/ast"
+	"dot/compiler"
+	"dot/eval"
+	"dot/lexer"
+	"dot/object"
+	"dot/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every program in testdata starts with a "// result: ..." line giving the
+// String() of its value. Each one is run on both the evaluator and the
+// virtual machine, which must agree with the expected result and, for
+// errors, on the traceback.
+
+func parse(t *testing.T, filename string, input string) *ast.Program {
+	t.Helper()
+	p := parser.NewParser(lexer.NewFileLexer(filename, input))
+	program := p.ParseProgram()
+	for _, e := range p.Errors() {
+		t.Errorf("PARSER ERROR: %s", e)
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+	return program
+}
+
+func runVM(t *testing.T, program *ast.Program) object.Object {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(comp.Bytecode(), object.NewEnvironment()).Run()
+}
+
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test programs found in testdata")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input := string(content)
+			header, _, _ := strings.Cut(input, "\n")
+			expected, ok := strings.CutPrefix(header, "// result: ")
+			if !ok {
+				t.Fatalf("missing '// result:' header")
+			}
+			program := parse(t, file, input)
+
+			evaluated := eval.Eval(program, object.NewEnvironment())
+			if evaluated.String() != expected {
+				t.Errorf("eval: expected=%q, got=%q", expected, evaluated.String())
+			}
+			result := runVM(t, program)
+			if result.String() != expected {
+				t.Errorf("vm: expected=%q, got=%q", expected, result.String())
+			}
+			if evalErr, ok := evaluated.(*object.Error); ok {
+				vmErr, ok := result.(*object.Error)
+				if ok && vmErr.Traceback() != evalErr.Traceback() {
+					t.Errorf("tracebacks differ.\neval:\n%s\nvm:\n%s", evalErr.Traceback(), vmErr.Traceback())
+				}
+				if ok && vmErr.End != evalErr.End {
+					t.Errorf("error spans differ. eval ends at %s, vm at %s", evalErr.End, vmErr.End)
+				}
+			}
+		})
+	}
+}
+
+const fibonacci = `
+let fib = fn(n) {
+  if (n < 2) { return n }
+  fib(n - 1) + fib(n - 2)
+}
+fib(20)
+`
+
+const loop = `
+let sum = 0
+let i = 0
+while (i < 1000000) {
+  sum += i
+  i += 1
+}
+sum
+`
+
+func benchmarkEval(b *testing.B, input string) {
+	program := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	for i := 0; i < b.N; i++ {
+		eval.Eval(program, object.NewEnvironment())
+	}
+}
+
+func benchmarkVM(b *testing.B, input string) {
+	program := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		b.Fatal(err)
+	}
+	bytecode := comp.Bytecode()
+	for i := 0; i < b.N; i++ {
+		New(bytecode, object.NewEnvironment()).Run()
+	}
+}
+
+func BenchmarkFibonacciEval(b *testing.B) { benchmarkEval(b, fibonacci) }
+func BenchmarkFibonacciVM(b *testing.B)   { benchmarkVM(b, fibonacci) }
+func BenchmarkLoopEval(b *testing.B)      { benchmarkEval(b, loop) }
+func BenchmarkLoopVM(b *testing.B)        { benchmarkVM(b, loop) }
+
+// TestConcurrentRuns runs programs at the same time in environments of
+// their own, which share no runtime and so neither count each other's steps
+// and calls nor see each other's modules.
+func TestConcurrentRuns(t *testing.T) {
+	input := `import "std/math" as math
+let fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }
+let result = [fib(15), math.clamp(15, 0, 10)]
+result`
+	program := parse(t, "concurrent.dot", input)
+	engines := map[string]func() object.Object{
+		"eval": func() object.Object { return eval.Eval(program, object.NewEnvironment()) },
+		"vm":   func() object.Object { return runVM(t, program) },
+	}
+	results := make(chan string)
+	for i := 0; i < 4; i++ {
+		for _, run := range engines {
+			go func(run func() object.Object) { results <- run().String() }(run)
+		}
+	}
+	for i := 0; i < 4*len(engines); i++ {
+		if got := <-results; got != "[610, 10]" {
+			t.Errorf("wrong result. got=%s", got)
+		}
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	input := `let half = fn(n) {
+  if (n == 0) { return fn() { n + true }() }
+  half(n - 1)
+}
+half(2)`
+	expected := `Traceback (most recent call last):
+  at tb.dot, line 5, column 1, in <main>
+  at tb.dot, line 3, column 3, in half
+  [previous line repeated 1 more times]
+  at tb.dot, line 2, column 24, in half
+  at tb.dot, line 2, column 31, in <anonymous>
+TypeError: type mismatch: INTEGER + BOOLEAN`
+
+	program := parse(t, "tb.dot", input)
+	results := map[string]object.Object{
+		"eval": eval.Eval(program, object.NewEnvironment()),
+		"vm":   runVM(t, program),
+	}
+	for engine, result := range results {
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Fatalf("%s: expected an error, got=%s", engine, result)
+		}
+		if err.Traceback() != expected {
+			t.Errorf("%s: wrong traceback.\nexpected:\n%s\ngot:\n%s", engine, expected, err.Traceback())
+		}
+		if err.End.String() != "tb.dot:2:39" {
+			t.Errorf("%s: wrong end of error span. got=%s", engine, err.End)
+		}
+	}
+}